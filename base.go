@@ -38,10 +38,11 @@ func FillConsts(vm *VM, act *Parser) {
 		"ListLiteral":       int(ListLiteral),
 		"ParsedListLiteral": int(ParsedListLiteral),
 		"PointerLiteral":    int(PointerLiteral),
+		"NilLiteral":        int(NilLiteral),
+		"TypeHintLiteral":   int(TypeHintLiteral),
 	})
 
-	vm.Enviroment.DefineFunction("ParserAppendLiteral", func(p *Parser, obj any) []Bytecode {
-		keyed := obj.(map[string]any)
+	vm.Enviroment.DefineFunction("ParserAppendLiteral", func(p *Parser, keyed map[string]any) []Bytecode {
 		lit := Literal{
 			LiteralType: LiteralType(keyed["RTLiteralType"].(int)),
 		}
@@ -50,13 +51,23 @@ func FillConsts(vm *VM, act *Parser) {
 		case IntLiteral:
 			lit.Value = keyed["RTValue"].(int)
 		case DoubleLiteral:
-			lit.Value = keyed["RTValue"].(float32)
+			lit.Value = keyed["RTValue"].(float64)
 		case BoolLiteral:
 			lit.Value = keyed["RTValue"].(bool)
 		case StringLiteral:
 			lit.Value = keyed["RTValue"].(string)
 		case RefLiteral:
 			lit.Value = keyed["RTValue"].(string)
+		case NilLiteral:
+			lit.Value = nil
+		case TypeHintLiteral:
+			hint, err := ParseTypeHint(keyed["RTValue"].(string))
+
+			if err != nil {
+				panic(err)
+			}
+
+			lit.Value = hint
 		case ListLiteral:
 			tempList := keyed["RTValue"].([]any)
 
@@ -146,10 +157,10 @@ func FillConsts(vm *VM, act *Parser) {
 		}
 	})
 
-	vm.Enviroment.DefineFunction("AddScannerRule", func(obj any) {
+	vm.Enviroment.DefineFunction("AddScannerRule", func(obj map[string]any) {
 		rule := ScannerRule{}
 
-		for key, val := range obj.(map[string]any) {
+		for key, val := range obj {
 			key, found := strings.CutPrefix(key, "RT")
 
 			if !found {
@@ -157,6 +168,8 @@ func FillConsts(vm *VM, act *Parser) {
 			}
 
 			switch key {
+			case "Id":
+				rule.Id = val.(string)
 			case "Result":
 				rule.Result = TokenType(val.(int))
 			case "BaseRule":
@@ -262,11 +275,11 @@ func FillConsts(vm *VM, act *Parser) {
 		act.Scanner.Rules = append(act.Scanner.Rules, rule)
 	})
 
-	vm.Enviroment.DefineFunction("AddParserRule", func(postfix bool, obj any) {
+	vm.Enviroment.DefineFunction("AddParserRule", func(postfix bool, obj map[string]any) {
 		if !postfix {
 			rule := ParserRule{}
 
-			for key, val := range obj.(map[string]any) {
+			for key, val := range obj {
 				key, found := strings.CutPrefix(key, "RT")
 
 				if !found {
@@ -333,7 +346,7 @@ func FillConsts(vm *VM, act *Parser) {
 		} else {
 			rule := PostFixRule{}
 
-			for key, val := range obj.(map[string]any) {
+			for key, val := range obj {
 				key, found := strings.CutPrefix(key, "RT")
 
 				if !found {
@@ -0,0 +1,129 @@
+package parts
+
+import "fmt"
+
+// DefaultMaxCallDepth is the call depth limit used by VMs that didn't set their own.
+const DefaultMaxCallDepth = 1000
+
+// CallFrame is a single entry of the VM call stack.
+type CallFrame struct {
+	Function PartsCallable
+	Args     []*Literal
+
+	//Set by `return f(args)` in the function body, picked up by callFunctionVM
+	tail *tailCall
+}
+
+type tailCall struct {
+	fun  PartsCallable
+	args []*Literal
+	env  *VMEnviroment
+
+	//Name it was called by, for the Profiler
+	name string
+}
+
+// CallStack is shared between the VM and all of its sub VMs, so the depth is
+// tracked for the whole program instead of relying on the Go stack.
+type CallStack struct {
+	Frames   []*CallFrame
+	MaxDepth int
+}
+
+func NewCallStack() *CallStack {
+	return &CallStack{
+		Frames:   []*CallFrame{},
+		MaxDepth: DefaultMaxCallDepth,
+	}
+}
+
+func (s *CallStack) Depth() int {
+	return len(s.Frames)
+}
+
+func (s *CallStack) Top() *CallFrame {
+	if len(s.Frames) == 0 {
+		return nil
+	}
+
+	return s.Frames[len(s.Frames)-1]
+}
+
+func (s *CallStack) push(fun PartsCallable, args []*Literal) (*CallFrame, error) {
+	if s.MaxDepth > 0 && len(s.Frames) >= s.MaxDepth {
+		return nil, fmt.Errorf("maximum call depth exceeded (%d)", s.MaxDepth)
+	}
+
+	frame := &CallFrame{Function: fun, Args: args}
+
+	s.Frames = append(s.Frames, frame)
+
+	return frame, nil
+}
+
+func (s *CallStack) pop() {
+	s.Frames[len(s.Frames)-1] = nil
+	s.Frames = s.Frames[:len(s.Frames)-1]
+}
+
+func (vm *VM) callStack() *CallStack {
+	if vm.CallStack == nil {
+		vm.CallStack = NewCallStack()
+	}
+
+	return vm.CallStack
+}
+
+// SetMaxCallDepth limits how deep Parts functions can recurse, 0 disables the limit.
+// Calls in tail position (`return f(args)`) reuse the frame and don't count.
+func (vm *VM) SetMaxCallDepth(depth int) {
+	vm.callStack().MaxDepth = depth
+}
+
+// tailFrame returns the frame that `return f(args)` can reuse, nil if the
+// current code isn't a plain function body.
+func (vm *VM) tailFrame() *CallFrame {
+	if vm.Generator != nil || vm.CallStack == nil {
+		return nil
+	}
+
+	frame := vm.CallStack.Top()
+
+	if frame == nil {
+		return nil
+	}
+
+	if _, ok := frame.Function.(FunctionDeclaration); !ok {
+		return nil
+	}
+
+	return frame
+}
+
+// scope collapses scopes of the finished function into a single one, callee
+// still sees the caller's variables but tail calls don't grow the scope chain
+func (t *tailCall) scope(base *VMEnviroment) *VMEnviroment {
+	scopes := []*VMEnviroment{}
+
+	for env := t.env; env != base; env = env.Enclosing {
+		if env == nil {
+			return t.env
+		}
+
+		scopes = append(scopes, env)
+	}
+
+	values := make(map[string]*Literal)
+
+	for i := len(scopes) - 1; i >= 0; i-- {
+		for key, val := range scopes[i].Values {
+			values[key] = val
+		}
+
+		for _, local := range scopes[i].Locals {
+			values["RT"+local.Name] = local.Value
+		}
+	}
+
+	return &VMEnviroment{Enclosing: base, Values: values}
+}
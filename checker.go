@@ -0,0 +1,836 @@
+package parts
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var errUnknownBytecode = errors.New("unknown bytecode")
+
+var opSymbols = map[Bytecode]string{
+	B_OP_ADD: "+", B_OP_MIN: "-", B_OP_MUL: "*", B_OP_DIV: "/",
+	B_OP_EQ: "==", B_OP_GT: ">", B_OP_LT: "<", B_OP_MOD: "%",
+	B_OP_BIT_AND: "&", B_OP_BIT_OR: "|", B_OP_BIT_XOR: "^",
+	B_OP_SHL: "<<", B_OP_SHR: ">>", B_OP_POW: "**", B_OP_FLOOR_DIV: "//",
+	B_OP_GT_EQ: ">=", B_OP_LT_EQ: "<=",
+}
+
+type checkedValue struct {
+	Name      string
+	Type      TypeHint
+	Annotated bool
+	Fun       *FunctionDeclaration
+}
+
+type checkedFunction struct {
+	Name       string
+	ReturnType TypeHint
+	Generator  bool
+}
+
+type checkCursor struct {
+	Code []Bytecode
+	Idx  int
+}
+
+// Checker walks the bytecode the same way VM does, without running it. It
+// infers types where it can and collects every annotation mismatch it finds,
+// values it can't reason about are treated as Any.
+type Checker struct {
+	Literals []*Literal
+	Errors   []error
+
+	scopes    []map[string]*checkedValue
+	functions []checkedFunction
+	checked   map[int]bool
+}
+
+// Check verifies type annotations of the code, returned error joins all problems found
+func Check(code []Bytecode, literals []*Literal) error {
+	c := Checker{
+		Literals: literals,
+		scopes:   []map[string]*checkedValue{{}},
+		checked:  make(map[int]bool),
+	}
+
+	c.block(code)
+
+	return errors.Join(c.Errors...)
+}
+
+func CheckString(codeString, modulePath string) error {
+	parser := GetParserWithSource(codeString, modulePath)
+
+	code, err := parser.ParseAll()
+
+	if err != nil {
+		return errors.Join(errors.New("got error from within parser"), err)
+	}
+
+	literals := make([]*Literal, len(parser.Literals))
+
+	for idx, literal := range parser.Literals {
+		literals[idx] = &literal
+	}
+
+	return Check(code, literals)
+}
+
+func CheckStringWithSyntax(codeString, syntax, modulePath string) error {
+	syntaxVM, err := GetVMWithSource(syntax, modulePath)
+
+	if err != nil {
+		return errors.Join(errors.New("got error when parsing syntax code"), err)
+	}
+
+	parser := GetParserWithSource(codeString, modulePath)
+
+	FillConsts(syntaxVM, &parser)
+
+	if err = syntaxVM.Run(); err != nil {
+		return errors.Join(errors.New("got error while running syntax code"), err)
+	}
+
+	code, err := parser.ParseAll()
+
+	if err != nil {
+		return errors.Join(errors.New("got error from within syntax parser"), err)
+	}
+
+	literals := make([]*Literal, len(parser.Literals))
+
+	for idx, literal := range parser.Literals {
+		literals[idx] = &literal
+	}
+
+	return Check(code, literals)
+}
+
+func (c *Checker) report(format string, args ...any) {
+	err := fmt.Errorf(format, args...)
+
+	if len(c.functions) > 0 && c.functions[len(c.functions)-1].Name != "" {
+		err = fmt.Errorf("in '%s': %w", c.functions[len(c.functions)-1].Name, err)
+	}
+
+	c.Errors = append(c.Errors, err)
+}
+
+func (c *Checker) lookup(name string) *checkedValue {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if val, ok := c.scopes[i][name]; ok {
+			return val
+		}
+	}
+
+	return nil
+}
+
+func (c *Checker) pushScope() {
+	c.scopes = append(c.scopes, map[string]*checkedValue{})
+}
+
+func (c *Checker) popScope() {
+	if len(c.scopes) > 1 {
+		c.scopes = c.scopes[:len(c.scopes)-1]
+	}
+}
+
+// block checks code in its own scope, code with bytecode the checker doesn't know
+// (i.e. from syntax parts) is skipped
+func (c *Checker) block(code []Bytecode) {
+	depth := len(c.scopes)
+
+	c.pushScope()
+
+	cur := &checkCursor{Code: code}
+
+	for cur.Idx < len(cur.Code) {
+		if err := c.statement(cur); err != nil {
+			break
+		}
+	}
+
+	c.scopes = c.scopes[:depth]
+}
+
+func (c *Checker) statement(cur *checkCursor) error {
+	if cur.Code[cur.Idx] != B_DECLARE {
+		_, err := c.expr(cur, false)
+
+		return err
+	}
+
+	cur.Idx++
+
+	if cur.Idx >= len(cur.Code) || cur.Code[cur.Idx] != B_LITERAL {
+		return errUnknownBytecode
+	}
+
+	nameLiteral, err := c.readLiteral(cur)
+
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprint(nameLiteral.Value)
+	declared := &checkedValue{Name: name, Type: TypeHint{}}
+
+	c.scopes[len(c.scopes)-1][name] = declared
+
+	if next := c.peekLiteral(cur); next != nil && next.LiteralType == FunLiteral {
+		if decl, ok := next.Value.(FunctionDeclaration); ok {
+			literalIdx, err := c.literalIdx(cur)
+
+			if err != nil {
+				return err
+			}
+
+			//Declared before checking the body, so recursive calls are checked too
+			declared.Type = TypeHint{Name: "Fun"}
+			declared.Fun = &decl
+
+			if !c.checked[literalIdx] {
+				c.checked[literalIdx] = true
+				c.function(decl, name)
+			}
+
+			return nil
+		}
+	}
+
+	if cur.Idx < len(cur.Code) && cur.Code[cur.Idx] == B_TYPE_HINT {
+		cur.Idx++
+
+		hintLiteral, err := c.readLiteral(cur)
+
+		if err != nil {
+			return err
+		}
+
+		hint := hintLiteral.Value.(TypeHint)
+
+		value, err := c.expr(cur, false)
+
+		if err != nil {
+			return err
+		}
+
+		if !hint.Accepts(value.Type) {
+			c.report("'%s' declared as %s got %s", name, hint, value.Type)
+		}
+
+		declared.Type = hint
+		declared.Annotated = true
+		declared.Fun = value.Fun
+
+		return nil
+	}
+
+	value, err := c.expr(cur, false)
+
+	if err != nil {
+		return err
+	}
+
+	declared.Type = value.Type
+	declared.Fun = value.Fun
+
+	return nil
+}
+
+func (c *Checker) expr(cur *checkCursor, member bool) (checkedValue, error) {
+	anyValue := checkedValue{Type: TypeHint{Name: "Any"}}
+
+	if cur.Idx >= len(cur.Code) {
+		return anyValue, errUnknownBytecode
+	}
+
+	switch cur.Code[cur.Idx] {
+	case B_LITERAL:
+		literalIdx, err := c.literalIdx(cur)
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		literal := c.Literals[literalIdx]
+
+		switch literal.LiteralType {
+		case RefLiteral:
+			if member {
+				return anyValue, nil
+			}
+
+			name := fmt.Sprint(literal.Value)
+
+			if val := c.lookup(name); val != nil {
+				return *val, nil
+			}
+
+			return checkedValue{Name: name, Type: TypeHint{Name: "Any"}}, nil
+		case FunLiteral:
+			decl, ok := literal.Value.(FunctionDeclaration)
+
+			if !ok {
+				return checkedValue{Type: TypeHint{Name: "Fun"}}, nil
+			}
+
+			if !c.checked[literalIdx] {
+				c.checked[literalIdx] = true
+				c.function(decl, "")
+			}
+
+			return checkedValue{Type: TypeHint{Name: "Fun"}, Fun: &decl}, nil
+		case ListLiteral:
+			for _, entry := range literal.Value.(ListDefinition).Entries {
+				c.entry(entry, 1)
+			}
+		case ObjLiteral:
+			for _, entry := range literal.Value.(ObjDefinition).Entries {
+				c.entry(entry, 2)
+			}
+		}
+
+		return checkedValue{Type: TypeHintOf(literal)}, nil
+	case B_BIN_OP:
+		cur.Idx++
+
+		if cur.Idx >= len(cur.Code) {
+			return anyValue, errUnknownBytecode
+		}
+
+		op := cur.Code[cur.Idx]
+
+		cur.Idx++
+
+		left, err := c.expr(cur, member)
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		right, err := c.expr(cur, member)
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		return checkedValue{Type: c.binOp(op, left.Type, right.Type)}, nil
+	case B_DOT:
+		cur.Idx++
+
+		if _, err := c.expr(cur, false); err != nil {
+			return anyValue, err
+		}
+
+		if _, err := c.expr(cur, true); err != nil {
+			return anyValue, err
+		}
+
+		return anyValue, nil
+	case B_OPT_DOT:
+		cur.Idx++
+
+		if _, err := c.expr(cur, false); err != nil {
+			return anyValue, err
+		}
+
+		length, err := cur.decodeLen()
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		cur.Idx += length
+
+		return anyValue, nil
+	case B_OPT_CHAIN:
+		cur.Idx++
+
+		if _, err := cur.decodeLen(); err != nil {
+			return anyValue, err
+		}
+
+		if _, err := c.expr(cur, member); err != nil {
+			return anyValue, err
+		}
+
+		return anyValue, nil
+	case B_COALESCE:
+		cur.Idx++
+
+		left, err := c.expr(cur, member)
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		if _, err := cur.decodeLen(); err != nil {
+			return anyValue, err
+		}
+
+		right, err := c.expr(cur, member)
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		if left.Type.Name == "Nil" {
+			return right, nil
+		}
+
+		if left.Type.Name == right.Type.Name {
+			return checkedValue{Type: TypeHint{Name: right.Type.Name, Nullable: right.Type.Nullable}}, nil
+		}
+
+		return anyValue, nil
+	case B_RESOLVE:
+		cur.Idx++
+
+		if _, err := c.expr(cur, false); err != nil {
+			return anyValue, err
+		}
+
+		return anyValue, nil
+	case B_SET:
+		cur.Idx++
+
+		var target *checkedValue
+
+		if cur.Idx < len(cur.Code) && cur.Code[cur.Idx] == B_LITERAL {
+			literal, err := c.readLiteral(cur)
+
+			if err != nil {
+				return anyValue, err
+			}
+
+			if literal.LiteralType == RefLiteral {
+				target = c.lookup(fmt.Sprint(literal.Value))
+			}
+		} else if _, err := c.expr(cur, false); err != nil {
+			return anyValue, err
+		}
+
+		value, err := c.expr(cur, false)
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		if target != nil {
+			if target.Annotated {
+				if !target.Type.Accepts(value.Type) {
+					c.report("assigning %s to '%s' declared as %s", value.Type, target.Name, target.Type)
+				}
+			} else {
+				//Variables without annotation can change type, so they are no longer tracked
+				target.Type = TypeHint{Name: "Any"}
+				target.Fun = nil
+			}
+		}
+
+		return value, nil
+	case B_CALL:
+		cur.Idx++
+
+		callee, err := c.expr(cur, member)
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		if cur.Idx >= len(cur.Code) {
+			return anyValue, errUnknownBytecode
+		}
+
+		args := make([]checkedValue, cur.Code[cur.Idx])
+
+		cur.Idx++
+
+		for i := range args {
+			if args[i], err = c.expr(cur, false); err != nil {
+				return anyValue, err
+			}
+		}
+
+		if callee.Type.Name != "" && !callee.Type.IsAny() && callee.Type.Name != "Fun" && !callee.Type.Nullable {
+			c.report("calling '%s' of type %s", callee.Name, callee.Type)
+			return anyValue, nil
+		}
+
+		if callee.Fun == nil {
+			return anyValue, nil
+		}
+
+		return checkedValue{Type: c.call(callee, args)}, nil
+	case B_COND_JUMP:
+		cur.Idx++
+
+		condition, err := c.expr(cur, false)
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		if !condition.Type.IsAny() && !condition.Type.Nullable && condition.Type.Name != "Bool" && condition.Type.Name != "Nil" {
+			c.report("condition should be Bool got %s", condition.Type)
+		}
+
+		for idx := range 2 {
+			//Else branch is the length of the jump ending then branch
+			if idx == 1 && !cur.skip(B_JUMP) {
+				return anyValue, errUnknownBytecode
+			}
+
+			length, err := cur.decodeLen()
+
+			if err != nil {
+				return anyValue, err
+			}
+
+			if cur.Idx+length > len(cur.Code) {
+				return anyValue, errUnknownBytecode
+			}
+
+			c.block(cur.Code[cur.Idx : cur.Idx+length])
+
+			cur.Idx += length
+		}
+
+		return anyValue, nil
+	case B_LOOP:
+		start := cur.Idx
+
+		cur.Idx++
+
+		conditionLen, err := cur.decodeLen()
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		if cur.Idx+conditionLen > len(cur.Code) {
+			return anyValue, errUnknownBytecode
+		}
+
+		c.block(cur.Code[cur.Idx : cur.Idx+conditionLen])
+
+		cur.Idx += conditionLen
+
+		bodyEnd, loopEnd, err := cur.loopBody(start)
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		c.pushScope()
+		c.scopes[len(c.scopes)-1]["it"] = &checkedValue{Name: "it", Type: TypeHint{Name: "Any"}}
+		c.block(cur.Code[cur.Idx:bodyEnd])
+		c.popScope()
+
+		cur.Idx = loopEnd
+
+		return anyValue, nil
+	case B_YIELD, B_RAISE:
+		cur.Idx++
+
+		if _, err := c.expr(cur, false); err != nil {
+			return anyValue, err
+		}
+
+		return anyValue, nil
+	case B_RETURN:
+		cur.Idx++
+
+		value, err := c.expr(cur, false)
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		if len(c.functions) > 0 {
+			fun := c.functions[len(c.functions)-1]
+
+			if !fun.Generator && !fun.ReturnType.Accepts(value.Type) {
+				c.report("expected %s as return value got %s", fun.ReturnType, value.Type)
+			}
+		}
+
+		return anyValue, nil
+	case B_CONTINUE, B_BREAK, B_JUMP, B_JUMP_REV, B_LINE:
+		cur.Idx++
+
+		if _, err := cur.decodeLen(); err != nil {
+			return anyValue, err
+		}
+
+		return anyValue, nil
+	case B_NEW_SCOPE:
+		cur.Idx++
+		c.pushScope()
+
+		return anyValue, nil
+	case B_END_SCOPE:
+		cur.Idx++
+		c.popScope()
+
+		return anyValue, nil
+	case B_TYPE_HINT:
+		cur.Idx++
+
+		hintLiteral, err := c.readLiteral(cur)
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		hint := hintLiteral.Value.(TypeHint)
+
+		value, err := c.expr(cur, member)
+
+		if err != nil {
+			return anyValue, err
+		}
+
+		if !hint.Accepts(value.Type) {
+			c.report("expected %s got %s", hint, value.Type)
+		}
+
+		return checkedValue{Type: hint, Annotated: true, Fun: value.Fun}, nil
+	}
+
+	return anyValue, errUnknownBytecode
+}
+
+// entry checks code of list (one expression) or object entry (key and value)
+func (c *Checker) entry(code []Bytecode, exprCount int) {
+	cur := &checkCursor{Code: code}
+
+	for i := range exprCount {
+		if _, err := c.expr(cur, i == 0 && exprCount == 2); err != nil {
+			return
+		}
+	}
+}
+
+func (c *Checker) function(decl FunctionDeclaration, name string) {
+	c.pushScope()
+
+	for idx, param := range decl.Params {
+		val := &checkedValue{Name: param, Type: TypeHint{Name: "Any"}}
+
+		if idx < len(decl.ParamTypes) && decl.ParamTypes[idx].Name != "" {
+			val.Type = decl.ParamTypes[idx]
+			val.Annotated = true
+		}
+
+		c.scopes[len(c.scopes)-1][param] = val
+	}
+
+	c.functions = append(c.functions, checkedFunction{Name: name, ReturnType: decl.ReturnType, Generator: decl.Generator})
+	c.block(decl.Body)
+	c.functions = c.functions[:len(c.functions)-1]
+
+	c.popScope()
+}
+
+func (c *Checker) call(callee checkedValue, args []checkedValue) TypeHint {
+	fun := callee.Fun
+
+	if len(args) < len(fun.Params) {
+		c.report("'%s' expects %d arguments got %d", callee.Name, len(fun.Params), len(args))
+	}
+
+	for idx, hint := range fun.ParamTypes {
+		if idx >= len(args) {
+			break
+		}
+
+		if !hint.Accepts(args[idx].Type) {
+			c.report("argument %d ('%s') of '%s' expected %s got %s", idx+1, fun.Params[idx], callee.Name, hint, args[idx].Type)
+		}
+	}
+
+	if fun.Generator {
+		return TypeHint{Name: "Object"}
+	}
+
+	if fun.ReturnType.Name == "" {
+		return TypeHint{Name: "Any"}
+	}
+
+	return fun.ReturnType
+}
+
+func (c *Checker) binOp(op Bytecode, left, right TypeHint) TypeHint {
+	anyType := TypeHint{Name: "Any"}
+	boolType := TypeHint{Name: "Bool"}
+
+	if op == B_OP_EQ || op == B_OP_GT || op == B_OP_LT || op == B_OP_GT_EQ || op == B_OP_LT_EQ {
+		return boolType
+	}
+
+	if left.IsAny() || right.IsAny() || left.Nullable || right.Nullable {
+		return anyType
+	}
+
+	isNum := func(t TypeHint) bool { return t.Name == "Int" || t.Name == "Double" }
+	is := func(t TypeHint, name string) bool { return t.Name == name }
+
+	switch op {
+	case B_OP_ADD:
+		switch {
+		case isNum(left) && (isNum(right) || is(right, "Bool")):
+			return left
+		case is(left, "Bool") && isNum(right):
+			return right
+		case is(left, "Bool") && is(right, "Bool"):
+			return boolType
+		case is(left, "String") && (isNum(right) || is(right, "Bool") || is(right, "String")):
+			return left
+		case is(left, "List"):
+			return left
+		}
+	case B_OP_MIN:
+		if isNum(left) && (isNum(right) || is(right, "Bool")) {
+			return left
+		}
+	case B_OP_MUL:
+		switch {
+		case isNum(left) && (isNum(right) || is(right, "Bool")):
+			return left
+		case is(left, "Bool") && isNum(right):
+			return right
+		case is(left, "Bool") && is(right, "Bool"):
+			return boolType
+		}
+	case B_OP_DIV:
+		if isNum(left) && isNum(right) {
+			return left
+		}
+	case B_OP_MOD, B_OP_SHL, B_OP_SHR:
+		if is(left, "Int") && is(right, "Int") {
+			return left
+		}
+	case B_OP_BIT_AND, B_OP_BIT_OR, B_OP_BIT_XOR:
+		if (is(left, "Int") || is(left, "Bool")) && left.Name == right.Name {
+			return left
+		}
+	case B_OP_POW:
+		if isNum(left) && isNum(right) {
+			if is(left, "Double") || is(right, "Double") {
+				return TypeHint{Name: "Double"}
+			}
+
+			return anyType
+		}
+	case B_OP_FLOOR_DIV:
+		if isNum(left) && isNum(right) {
+			if is(left, "Int") && is(right, "Int") {
+				return left
+			}
+
+			return TypeHint{Name: "Double"}
+		}
+	default:
+		return anyType
+	}
+
+	c.report("operation '%s' not supported between %s and %s", opSymbols[op], left, right)
+
+	return anyType
+}
+
+func (c *Checker) peekLiteral(cur *checkCursor) *Literal {
+	if cur.Idx >= len(cur.Code) || cur.Code[cur.Idx] != B_LITERAL {
+		return nil
+	}
+
+	start := cur.Idx
+
+	literal, err := c.readLiteral(cur)
+
+	cur.Idx = start
+
+	if err != nil {
+		return nil
+	}
+
+	return literal
+}
+
+func (c *Checker) readLiteral(cur *checkCursor) (*Literal, error) {
+	idx, err := c.literalIdx(cur)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Literals[idx], nil
+}
+
+func (c *Checker) literalIdx(cur *checkCursor) (int, error) {
+	if cur.Idx >= len(cur.Code) || cur.Code[cur.Idx] != B_LITERAL {
+		return 0, errUnknownBytecode
+	}
+
+	cur.Idx++
+
+	idx, err := cur.decodeLen()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if idx >= len(c.Literals) {
+		return 0, errUnknownBytecode
+	}
+
+	return idx, nil
+}
+
+// skip moves past op when it's the next bytecode
+func (cur *checkCursor) skip(op Bytecode) bool {
+	if cur.Idx >= len(cur.Code) || cur.Code[cur.Idx] != op {
+		return false
+	}
+
+	cur.Idx++
+
+	return true
+}
+
+// loopBody reads body length of B_LOOP at start, returns where the body ends
+// without the reverse jump and where the loop ends after B_END_LOOP
+func (cur *checkCursor) loopBody(start int) (int, int, error) {
+	bodyLen, err := cur.decodeLen()
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	bodyEnd := cur.Idx + bodyLen
+	jump := joinCode([]Bytecode{B_JUMP_REV}, mustEncodeLen(bodyEnd-start))
+
+	if bodyEnd >= len(cur.Code) || bodyLen < len(jump) || !slices.Equal(cur.Code[bodyEnd-len(jump):bodyEnd], jump) || cur.Code[bodyEnd] != B_END_LOOP {
+		return 0, 0, errUnknownBytecode
+	}
+
+	return bodyEnd - len(jump), bodyEnd + 1, nil
+}
+
+func (cur *checkCursor) decodeLen() (int, error) {
+	vm := VM{Code: cur.Code, Idx: cur.Idx}
+
+	if vm.Idx >= len(vm.Code) || (vm.Code[vm.Idx] == 126 && vm.Idx+2 >= len(vm.Code)) || (vm.Code[vm.Idx] == 127 && vm.Idx+8 >= len(vm.Code)) {
+		return 0, errUnknownBytecode
+	}
+
+	value, err := vm.decodeLen()
+
+	cur.Idx = vm.Idx
+
+	return value, err
+}
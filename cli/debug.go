@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tfo-dot/parts"
+)
+
+const debugHelp = `Commands:
+  b [file:]line   break on the line, file defaults to the program
+  bf name         break on entering the function
+  c               continue
+  n               step over
+  s               step into
+  o               step out
+  bt              show call stack
+  vars            show variables of the current function
+  p name          print variable
+  last            print last expression
+  q               quit`
+
+// runDebug runs the program under the debugger, either with prompt on stdin or as DAP server
+func runDebug(args []string) {
+	var (
+		part string
+		dap  bool
+	)
+
+	debugFlags := flag.NewFlagSet("debug", flag.ExitOnError)
+	debugFlags.StringVar(&part, "part", "", "Path to syntax part")
+	debugFlags.BoolVar(&dap, "dap", false, "Serve Debug Adapter Protocol over stdio, program is given by the launch request")
+	debugFlags.Parse(args)
+
+	if dap {
+		runDAP()
+		return
+	}
+
+	if debugFlags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: parts debug [-part syntax.pts] file.pts")
+		os.Exit(1)
+	}
+
+	codePath := debugFlags.Arg(0)
+
+	codeData, err := os.ReadFile(codePath)
+
+	if err != nil {
+		panic(err)
+	}
+
+	prompt := &debugPrompt{
+		input:       bufio.NewScanner(os.Stdin),
+		program:     codePath,
+		breakpoints: map[string][]int{},
+	}
+
+	prompt.debugger = parts.NewDebugger(prompt.stopped, true)
+
+	options := parts.CompileOptions{Debugger: prompt.debugger, SyntaxPath: part}
+
+	if part != "" {
+		rawFile, err := os.ReadFile(part)
+
+		if err != nil {
+			panic(err)
+		}
+
+		options.Syntax = string(rawFile)
+	}
+
+	fmt.Println(debugHelp)
+
+	_, err = parts.RunStringWithOptions(string(codeData), codePath, options)
+
+	if err != nil && !errors.Is(err, parts.ErrDebugTerminated) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// runDAP serves the protocol on stdin/stdout, output of the program goes to output events
+func runDAP() {
+	dapOut := os.Stdout
+
+	r, w, err := os.Pipe()
+
+	if err != nil {
+		panic(err)
+	}
+
+	os.Stdout = w
+
+	server := parts.NewDAPServer(os.Stdin, dapOut)
+
+	go server.ForwardOutput(r)
+
+	if err := server.Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+type debugPrompt struct {
+	input    *bufio.Scanner
+	debugger *parts.Debugger
+	program  string
+
+	breakpoints map[string][]int
+	functions   []string
+}
+
+func (p *debugPrompt) stopped(stop parts.DebugStop) parts.DebugAction {
+	frame := stop.Frames[len(stop.Frames)-1]
+
+	fmt.Printf("Stopped (%s) at %s:%d in %s\n", stop.Reason, frame.Source, frame.Line, frame.Function)
+
+	for {
+		fmt.Print("> ")
+
+		if !p.input.Scan() {
+			return parts.DebugTerminate
+		}
+
+		command, arg, _ := strings.Cut(strings.TrimSpace(p.input.Text()), " ")
+		arg = strings.TrimSpace(arg)
+
+		switch command {
+		case "c":
+			return parts.DebugContinue
+		case "n":
+			return parts.DebugStepOver
+		case "s":
+			return parts.DebugStepInto
+		case "o":
+			return parts.DebugStepOut
+		case "q":
+			return parts.DebugTerminate
+		case "b":
+			source, rawLine, found := strings.Cut(arg, ":")
+
+			if !found {
+				source, rawLine = p.program, arg
+			}
+
+			line, err := strconv.Atoi(rawLine)
+
+			if err != nil {
+				fmt.Println("Expected line number")
+				continue
+			}
+
+			p.breakpoints[source] = append(p.breakpoints[source], line)
+			p.debugger.SetBreakpoints(source, p.breakpoints[source])
+		case "bf":
+			p.functions = append(p.functions, arg)
+			p.debugger.SetFunctionBreakpoints(p.functions)
+		case "bt":
+			for _, frame := range slices.Backward(stop.Frames) {
+				fmt.Printf("  %s at %s:%d\n", frame.Function, frame.Source, frame.Line)
+			}
+		case "vars":
+			for idx, scope := range frame.Scopes() {
+				if scope.Global {
+					continue
+				}
+
+				fmt.Printf("Scope %d:\n", idx)
+
+				names := make([]string, 0, len(scope.Variables))
+
+				for name := range scope.Variables {
+					names = append(names, name)
+				}
+
+				slices.Sort(names)
+
+				for _, name := range names {
+					fmt.Printf("  %s = %s\n", name, parts.DebugValue(scope.Variables[name]))
+				}
+			}
+		case "p":
+			found := false
+
+			for _, scope := range frame.Scopes() {
+				if value, ok := scope.Variables[arg]; ok {
+					fmt.Println(parts.DebugValue(value))
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				fmt.Printf("No variable %s\n", arg)
+			}
+		case "last":
+			fmt.Println(parts.DebugValue(stop.LastExpr))
+		case "":
+		default:
+			fmt.Println(debugHelp)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tfo-dot/parts"
+)
+
+// runGen writes Go structs and loader for the data files, types come from the schema or from the values in the files
+func runGen(args []string) {
+	var schemaPath, pkg, name, out string
+
+	genFlags := flag.NewFlagSet("gen", flag.ExitOnError)
+	genFlags.StringVar(&schemaPath, "schema", "", "Path to schema, used instead of the data files")
+	genFlags.StringVar(&pkg, "package", "main", "Package of the generated file")
+	genFlags.StringVar(&name, "type", "Config", "Name of the generated struct")
+	genFlags.StringVar(&out, "out", "", "Path to write the code to, stdout when empty")
+	genFlags.Parse(args)
+
+	if schemaPath == "" && genFlags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: parts gen [-package name] [-type Config] [-out file.go] (-schema schema.pts | data.pts...)")
+		os.Exit(1)
+	}
+
+	var (
+		schema *parts.Schema
+		err    error
+	)
+
+	//Output of the scripts would end up in the generated code
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+
+	if schemaPath != "" {
+		var rawSchema []byte
+
+		if rawSchema, err = os.ReadFile(schemaPath); err != nil {
+			panic(err)
+		}
+
+		schema, err = parts.ParseSchema(string(rawSchema), schemaPath)
+	} else {
+		vms := make([]*parts.VM, 0, genFlags.NArg())
+
+		for _, codePath := range genFlags.Args() {
+			vms = append(vms, runData(codePath))
+		}
+
+		schema, err = parts.InferSchema(vms...)
+	}
+
+	os.Stdout = stdout
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	code, err := parts.GenerateGo(schema, parts.GenerateOptions{Package: pkg, Name: name})
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if out == "" {
+		os.Stdout.Write(code)
+		return
+	}
+
+	if err := os.WriteFile(out, code, 0o644); err != nil {
+		panic(err)
+	}
+}
+
+// runData runs the file and returns VM with its globals
+func runData(codePath string) *parts.VM {
+	codeData, err := os.ReadFile(codePath)
+
+	if err != nil {
+		panic(err)
+	}
+
+	vm, err := parts.GetVMWithSource(string(codeData), codePath)
+
+	if err == nil {
+		err = vm.Run()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s:\n%s\n", codePath, err)
+		os.Exit(1)
+	}
+
+	return vm
+}
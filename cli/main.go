@@ -11,6 +11,21 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		runCheck(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "gen" {
+		runGen(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "debug" {
+		runDebug(os.Args[2:])
+		return
+	}
+
 	stat, _ := os.Stdin.Stat()
 	if (stat.Mode() & os.ModeCharDevice) == 0 {
 
@@ -21,17 +36,32 @@ func main() {
 		}
 
 		var (
-			part   string
-			decomp bool
-			timed  bool
+			part     string
+			decomp   bool
+			timed    bool
+			optimize bool
+			profile  string
+			trace    bool
+			cover    string
+			coverWeb string
+			name     string
 		)
 
 		flag.StringVar(&part, "part", "", "Path to syntax part")
+		flag.StringVar(&name, "name", "<stdin>", "Name of the code read from stdin, coverage refers to it by this name")
 		flag.BoolVar(&decomp, "decomp", false, "Show decompiled")
 		flag.BoolVar(&timed, "timed", false, "Measure and show time")
+		flag.BoolVar(&optimize, "optimize", false, "Optimize bytecode before running")
+		flag.StringVar(&profile, "profile", "", "Profile parsing and running, pprof output goes to the path")
+		flag.BoolVar(&trace, "trace", false, "Print execution trace to stderr")
+		flag.StringVar(&cover, "cover", "", "Collect line and branch coverage, coverprofile goes to the path")
+		flag.StringVar(&coverWeb, "coverhtml", "", "Collect coverage, annotated source goes to the path")
 
 		flag.Parse()
 
+		profiler := newProfiler(profile)
+		coverage := newCoverage(cover, coverWeb)
+
 		if decomp {
 			p := parts.GetParserWithSource(string(stdinBytes), "./")
 
@@ -41,6 +71,10 @@ func main() {
 				panic(err)
 			}
 
+			if optimize {
+				btc = optimizeParsed(btc, &p)
+			}
+
 			fmt.Printf("Bytecode: %v\n", btc)
 
 			println("Literals:")
@@ -64,7 +98,7 @@ func main() {
 		if part == "" {
 			startTime := time.Now()
 
-			_, err := parts.RunString(string(stdinBytes), "./")
+			_, err := parts.RunStringWithOptions(string(stdinBytes), "./", parts.CompileOptions{Source: name, Optimize: optimize, Profiler: profiler, Hooks: newTracer(trace), Coverage: coverage})
 
 			if err != nil {
 				panic(err)
@@ -73,6 +107,9 @@ func main() {
 			if timed {
 				fmt.Printf("Execution took - %s\n", time.Now().Sub(startTime).String())
 			}
+
+			writeProfile(profiler, profile)
+			writeCoverage(coverage, cover, coverWeb)
 		} else {
 			rawFile, err := os.ReadFile(part)
 
@@ -82,7 +119,7 @@ func main() {
 
 			startTime := time.Now()
 
-			_, err = parts.RunStringWithSyntax(string(stdinBytes), string(rawFile), "./")
+			_, err = parts.RunStringWithOptions(string(stdinBytes), "./", parts.CompileOptions{Source: name, Syntax: string(rawFile), SyntaxPath: part, Optimize: optimize, Profiler: profiler, Hooks: newTracer(trace), Coverage: coverage})
 
 			if err != nil {
 				panic(err)
@@ -91,6 +128,9 @@ func main() {
 			if timed {
 				fmt.Printf("Execution took - %s\n", time.Now().Sub(startTime).String())
 			}
+
+			writeProfile(profiler, profile)
+			writeCoverage(coverage, cover, coverWeb)
 		}
 
 		return
@@ -100,14 +140,27 @@ func main() {
 			part     string
 			decomp   bool
 			timed    bool
+			optimize bool
+			profile  string
+			trace    bool
+			cover    string
+			coverWeb string
 		)
 
 		flag.StringVar(&codePath, "code", "", "Path to code to execute")
 		flag.StringVar(&part, "part", "", "Path to syntax part")
 		flag.BoolVar(&decomp, "decomp", false, "Show decompiled")
 		flag.BoolVar(&timed, "timed", false, "Measure and show time")
+		flag.BoolVar(&optimize, "optimize", false, "Optimize bytecode before running")
+		flag.StringVar(&profile, "profile", "", "Profile parsing and running, pprof output goes to the path")
+		flag.BoolVar(&trace, "trace", false, "Print execution trace to stderr")
+		flag.StringVar(&cover, "cover", "", "Collect line and branch coverage, coverprofile goes to the path")
+		flag.StringVar(&coverWeb, "coverhtml", "", "Collect coverage, annotated source goes to the path")
 		flag.Parse()
 
+		profiler := newProfiler(profile)
+		coverage := newCoverage(cover, coverWeb)
+
 		if codePath == "" {
 			fmt.Println("Error: --code flag is required.")
 			os.Exit(1)
@@ -128,6 +181,10 @@ func main() {
 				panic(err)
 			}
 
+			if optimize {
+				btc = optimizeParsed(btc, &p)
+			}
+
 			fmt.Printf("Bytecode: %v", btc)
 
 			println("Literals:")
@@ -149,7 +206,7 @@ func main() {
 		if part == "" {
 			startTime := time.Now()
 
-			_, err := parts.RunString(string(codeData), codePath)
+			_, err := parts.RunStringWithOptions(string(codeData), codePath, parts.CompileOptions{Optimize: optimize, Profiler: profiler, Hooks: newTracer(trace), Coverage: coverage})
 
 			if err != nil {
 				panic(err)
@@ -158,6 +215,9 @@ func main() {
 			if timed {
 				fmt.Printf("Execution took - %s\n", time.Now().Sub(startTime).String())
 			}
+
+			writeProfile(profiler, profile)
+			writeCoverage(coverage, cover, coverWeb)
 		} else {
 			rawFile, err := os.ReadFile(part)
 
@@ -167,7 +227,7 @@ func main() {
 
 			startTime := time.Now()
 
-			_, err = parts.RunStringWithSyntax(string(codeData), string(rawFile), codePath)
+			_, err = parts.RunStringWithOptions(string(codeData), codePath, parts.CompileOptions{Syntax: string(rawFile), SyntaxPath: part, Optimize: optimize, Profiler: profiler, Hooks: newTracer(trace), Coverage: coverage})
 
 			if err != nil {
 				panic(err)
@@ -176,6 +236,201 @@ func main() {
 			if timed {
 				fmt.Printf("Execution took - %s\n", time.Now().Sub(startTime).String())
 			}
+
+			writeProfile(profiler, profile)
+			writeCoverage(coverage, cover, coverWeb)
+		}
+	}
+}
+
+// newProfiler returns profiler when there's a path to write it to
+func newProfiler(path string) *parts.Profiler {
+	if path == "" {
+		return nil
+	}
+
+	return parts.NewProfiler()
+}
+
+// writeProfile prints the report and writes pprof profile to the path
+func writeProfile(profiler *parts.Profiler, path string) {
+	if profiler == nil {
+		return
+	}
+
+	if err := profiler.Report(os.Stdout); err != nil {
+		panic(err)
+	}
+
+	out, err := os.Create(path)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer out.Close()
+
+	if err = profiler.WriteProfile(out); err != nil {
+		panic(err)
+	}
+}
+
+// newCoverage returns coverage when there's a path to write it to
+func newCoverage(profilePath, htmlPath string) *parts.Coverage {
+	if profilePath == "" && htmlPath == "" {
+		return nil
+	}
+
+	return parts.NewCoverage()
+}
+
+// writeCoverage prints the summary and writes coverprofile and HTML report to the paths that are set
+func writeCoverage(coverage *parts.Coverage, profilePath, htmlPath string) {
+	if coverage == nil {
+		return
+	}
+
+	fmt.Printf("Coverage: %s\n", coverage.Summary())
+
+	write := func(path string, writeTo func(w io.Writer) error) {
+		if path == "" {
+			return
+		}
+
+		out, err := os.Create(path)
+
+		if err != nil {
+			panic(err)
 		}
+
+		defer out.Close()
+
+		if err = writeTo(out); err != nil {
+			panic(err)
+		}
+	}
+
+	write(profilePath, coverage.WriteProfile)
+	write(htmlPath, coverage.WriteHTML)
+}
+
+// newTracer returns tracer writing to stderr, nil when not tracing
+func newTracer(trace bool) parts.Hooks {
+	if !trace {
+		return nil
+	}
+
+	return parts.NewTracer(os.Stderr)
+}
+
+// optimizeParsed runs the optimizer over parsed code, folded values are added to the parser literals
+func optimizeParsed(code []parts.Bytecode, p *parts.Parser) []parts.Bytecode {
+	literals := make([]*parts.Literal, len(p.Literals))
+
+	for idx := range p.Literals {
+		literals[idx] = &p.Literals[idx]
+	}
+
+	code, literals = parts.Optimize(code, literals)
+
+	p.Literals = make([]parts.Literal, len(literals))
+
+	for idx, literal := range literals {
+		p.Literals[idx] = *literal
+	}
+
+	return code
+}
+
+// runCheck verifies type annotations of the files (or stdin) without running them,
+// with schema the files are also ran and their globals validated
+func runCheck(args []string) {
+	var part, schemaPath string
+
+	checkFlags := flag.NewFlagSet("check", flag.ExitOnError)
+	checkFlags.StringVar(&part, "part", "", "Path to syntax part")
+	checkFlags.StringVar(&schemaPath, "schema", "", "Path to schema the files are validated against")
+	checkFlags.Parse(args)
+
+	var schema *parts.Schema
+
+	if schemaPath != "" {
+		rawSchema, err := os.ReadFile(schemaPath)
+
+		if err != nil {
+			panic(err)
+		}
+
+		if schema, err = parts.ParseSchema(string(rawSchema), schemaPath); err != nil {
+			fmt.Fprintf(os.Stderr, "%s:\n%s\n", schemaPath, err)
+			os.Exit(1)
+		}
+	}
+
+	syntax := ""
+
+	if part != "" {
+		rawFile, err := os.ReadFile(part)
+
+		if err != nil {
+			panic(err)
+		}
+
+		syntax = string(rawFile)
+	}
+
+	sources := map[string]string{}
+	paths := checkFlags.Args()
+
+	if len(paths) == 0 {
+		stdinBytes, err := io.ReadAll(os.Stdin)
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading all from stdin:", err)
+			os.Exit(1)
+		}
+
+		sources["<stdin>"] = string(stdinBytes)
+		paths = []string{"<stdin>"}
+	} else {
+		for _, codePath := range paths {
+			codeData, err := os.ReadFile(codePath)
+
+			if err != nil {
+				panic(err)
+			}
+
+			sources[codePath] = string(codeData)
+		}
+	}
+
+	failed := false
+
+	for _, codePath := range paths {
+		var err error
+
+		if syntax == "" {
+			err = parts.CheckString(sources[codePath], codePath)
+		} else {
+			err = parts.CheckStringWithSyntax(sources[codePath], syntax, codePath)
+		}
+
+		if err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "%s:\n%s\n", codePath, err)
+
+			continue
+		}
+
+		if schema != nil {
+			if err := schema.Validate(sources[codePath], codePath); err != nil {
+				failed = true
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+
+	if failed {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the CLI instead of the tests when the test binary is started by runCLI
+func TestMain(m *testing.M) {
+	if os.Getenv("PARTS_CLI") == "1" {
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func runCLI(t *testing.T, stdin string, args ...string) string {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "PARTS_CLI=1")
+	cmd.Stdin = strings.NewReader(stdin)
+
+	out, err := cmd.CombinedOutput()
+
+	if err != nil {
+		t.Fatalf("cli failed: %s\n%s", err, out)
+	}
+
+	return string(out)
+}
+
+func TestStdinCoverageName(t *testing.T) {
+	dir := t.TempDir()
+	profile := filepath.Join(dir, "cover.out")
+
+	runCLI(t, "let x = 1\nlet y = x + 1", "-cover", profile)
+
+	data, err := os.ReadFile(profile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "mode: count\n<stdin>:1.1,1.10 1 1\n<stdin>:2.1,2.14 1 1\n"; string(data) != expected {
+		t.Errorf("expected profile:\n%s\ngot:\n%s", expected, data)
+	}
+
+	runCLI(t, "let x = 1", "-cover", profile, "-name", "main.pts")
+
+	if data, err = os.ReadFile(profile); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(data), "mode: count\nmain.pts:1.1,") {
+		t.Errorf("expected lines under main.pts got:\n%s", data)
+	}
+}
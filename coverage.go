@@ -0,0 +1,300 @@
+package parts
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"slices"
+	"strings"
+)
+
+// CoverageLine is a single line with at least one statement or branch on it
+type CoverageLine struct {
+	Line int
+
+	//Statements starting on the line and how many times they ran
+	Statements int
+	Hits       int
+
+	//Ifs and loops on the line are counted together, True and False are
+	//how many times the condition went each way (loop entering the body is true)
+	Branch      bool
+	True, False int
+}
+
+// CoverageSummary counts covered lines and branches, each branch line has two branches
+type CoverageSummary struct {
+	Lines, LinesHit       int
+	Branches, BranchesHit int
+}
+
+func (s CoverageSummary) String() string {
+	return fmt.Sprintf("lines %s (%d/%d), branches %s (%d/%d)", percent(s.LinesHit, s.Lines), s.LinesHit, s.Lines, percent(s.BranchesHit, s.Branches), s.BranchesHit, s.Branches)
+}
+
+type coverageFile struct {
+	Source []string
+	Lines  map[int]*CoverageLine
+}
+
+// Coverage records which lines and branches ran. Statements and branches are
+// registered while parsing so the ones that never ran are known too, single
+// coverage is shared by the parser, the VM and the syntax part. Methods used by
+// the VM do nothing on nil coverage.
+type Coverage struct {
+	files map[string]*coverageFile
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{files: make(map[string]*coverageFile)}
+}
+
+func (c *Coverage) file(name string) *coverageFile {
+	file, ok := c.files[name]
+
+	if !ok {
+		file = &coverageFile{Lines: make(map[int]*CoverageLine)}
+		c.files[name] = file
+	}
+
+	return file
+}
+
+func (c *Coverage) line(name string, line int) *CoverageLine {
+	file := c.file(name)
+	entry, ok := file.Lines[line]
+
+	if !ok {
+		entry = &CoverageLine{Line: line}
+		file.Lines[line] = entry
+	}
+
+	return entry
+}
+
+// addSource keeps the code for the HTML report
+func (c *Coverage) addSource(name, source string) {
+	if c == nil {
+		return
+	}
+
+	c.file(name).Source = strings.Split(source, "\n")
+}
+
+func (c *Coverage) statement(name string, line int) {
+	if c == nil || line == 0 {
+		return
+	}
+
+	c.line(name, line).Statements++
+}
+
+func (c *Coverage) branchPoint(name string, line int) {
+	if c == nil || line == 0 {
+		return
+	}
+
+	c.line(name, line).Branch = true
+}
+
+func (c *Coverage) hit(name string, line int) {
+	if c == nil || line == 0 {
+		return
+	}
+
+	c.line(name, line).Hits++
+}
+
+func (c *Coverage) branch(name string, line int, taken bool) {
+	if c == nil || line == 0 {
+		return
+	}
+
+	entry := c.line(name, line)
+	entry.Branch = true
+
+	if taken {
+		entry.True++
+	} else {
+		entry.False++
+	}
+}
+
+// Files returns names of the covered code, sorted
+func (c *Coverage) Files() []string {
+	names := make([]string, 0, len(c.files))
+
+	for name := range c.files {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// Lines returns coverage of the file ordered by line
+func (c *Coverage) Lines(name string) []CoverageLine {
+	file, ok := c.files[name]
+
+	if !ok {
+		return []CoverageLine{}
+	}
+
+	lines := make([]CoverageLine, 0, len(file.Lines))
+
+	for _, line := range file.Lines {
+		lines = append(lines, *line)
+	}
+
+	slices.SortFunc(lines, func(a, b CoverageLine) int { return a.Line - b.Line })
+
+	return lines
+}
+
+// Summary counts everything when no names are given, otherwise only the files
+func (c *Coverage) Summary(names ...string) CoverageSummary {
+	if len(names) == 0 {
+		names = c.Files()
+	}
+
+	summary := CoverageSummary{}
+
+	for _, name := range names {
+		for _, line := range c.Lines(name) {
+			if line.Statements > 0 || line.Hits > 0 {
+				summary.Lines++
+
+				if line.Hits > 0 {
+					summary.LinesHit++
+				}
+			}
+
+			if line.Branch {
+				summary.Branches += 2
+
+				if line.True > 0 {
+					summary.BranchesHit++
+				}
+
+				if line.False > 0 {
+					summary.BranchesHit++
+				}
+			}
+		}
+	}
+
+	return summary
+}
+
+// WriteProfile writes Go coverprofile (mode: count), every line with statements is a block
+func (c *Coverage) WriteProfile(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "mode: count"); err != nil {
+		return err
+	}
+
+	for _, name := range c.Files() {
+		file := c.files[name]
+
+		for _, line := range c.Lines(name) {
+			if line.Statements == 0 && line.Hits == 0 {
+				continue
+			}
+
+			end := 2
+
+			if line.Line <= len(file.Source) {
+				end = max(end, len([]rune(file.Source[line.Line-1]))+1)
+			}
+
+			if _, err := fmt.Fprintf(w, "%s:%d.1,%d.%d %d %d\n", name, line.Line, line.Line, end, max(line.Statements, 1), line.Hits); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteHTML writes page with the code of every file, lines are marked as covered or not
+func (c *Coverage) WriteHTML(w io.Writer) error {
+	var b strings.Builder
+
+	b.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Parts coverage</title>
+<style>
+body { background: #1e1e1e; color: #aaa; font-family: sans-serif; }
+pre { font-family: monospace; line-height: 1.4; }
+.num { color: #666; display: inline-block; width: 4em; }
+.count { color: #666; display: inline-block; width: 6em; }
+.hit { color: #4c4; }
+.miss { color: #e44; }
+.partial { color: #db3; }
+</style>
+</head>
+<body>
+`)
+
+	fmt.Fprintf(&b, "<h1>Coverage: %s</h1>\n", html.EscapeString(c.Summary().String()))
+
+	for _, name := range c.Files() {
+		file := c.files[name]
+
+		fmt.Fprintf(&b, "<h2>%s - %s</h2>\n<pre>\n", html.EscapeString(name), html.EscapeString(c.Summary(name).String()))
+
+		source := file.Source
+
+		for line := range file.Lines {
+			for len(source) < line {
+				source = append(source, "")
+			}
+		}
+
+		for idx, text := range source {
+			class, count := "", ""
+
+			if line, ok := file.Lines[idx+1]; ok {
+				class = "hit"
+
+				if line.Hits == 0 && line.Statements > 0 {
+					class = "miss"
+				}
+
+				count = fmt.Sprintf("%dx", line.Hits)
+
+				if line.Branch {
+					if line.True == 0 || line.False == 0 {
+						class = "partial"
+
+						if line.Hits == 0 && line.True == 0 && line.False == 0 {
+							class = "miss"
+						}
+					}
+
+					count += fmt.Sprintf(" T%d F%d", line.True, line.False)
+				}
+			}
+
+			fmt.Fprintf(&b, "<span class=\"num\">%d</span><span class=\"count\">%s</span><span class=\"%s\">%s</span>\n", idx+1, count, class, html.EscapeString(text))
+		}
+
+		b.WriteString("</pre>\n")
+	}
+
+	b.WriteString("</body>\n</html>\n")
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+func percent(part, whole int) string {
+	if whole == 0 {
+		return "100.0%"
+	}
+
+	return fmt.Sprintf("%.1f%%", float64(part)*100/float64(whole))
+}
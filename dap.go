@@ -0,0 +1,481 @@
+package parts
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type dapMessage struct {
+	Seq  int    `json:"seq"`
+	Type string `json:"type"`
+
+	//Requests
+	Command   string          `json:"command,omitempty"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+
+	//Responses
+	RequestSeq int    `json:"request_seq,omitempty"`
+	Success    *bool  `json:"success,omitempty"`
+	Message    string `json:"message,omitempty"`
+
+	//Events
+	Event string `json:"event,omitempty"`
+
+	Body any `json:"body,omitempty"`
+}
+
+type dapLaunchArguments struct {
+	Program     string `json:"program"`
+	Syntax      string `json:"syntax"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// DAPServer runs single program under the Debugger and talks to the editor
+// with the Debug Adapter Protocol (messages with Content-Length header)
+type DAPServer struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	//Guards writing to out and seq
+	writeLock sync.Mutex
+	seq       int
+
+	debugger *Debugger
+	launch   dapLaunchArguments
+
+	//Guards everything below, program only touches it from the handler
+	lock    sync.Mutex
+	paused  bool
+	stop    DebugStop
+	refs    []any
+	actions chan DebugAction
+}
+
+func NewDAPServer(in io.Reader, out io.Writer) *DAPServer {
+	s := &DAPServer{
+		in:      bufio.NewReader(in),
+		out:     out,
+		actions: make(chan DebugAction),
+	}
+
+	s.debugger = NewDebugger(s.stopped, false)
+
+	return s
+}
+
+// Serve handles requests until the client disconnects or the input ends
+func (s *DAPServer) Serve() error {
+	for {
+		request, err := s.read()
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return errors.Join(errors.New("got error while reading request"), err)
+		}
+
+		if request.Type != "request" {
+			continue
+		}
+
+		body, err := s.handle(request)
+
+		if err != nil {
+			s.send(dapMessage{Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: dapBool(false), Message: err.Error()})
+			continue
+		}
+
+		s.send(dapMessage{Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: dapBool(true), Body: body})
+
+		switch request.Command {
+		case "initialize":
+			s.event("initialized", nil)
+		case "configurationDone":
+			go s.run()
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+// Output sends text shown in the debug console, category is "stdout", "stderr" or "console"
+func (s *DAPServer) Output(category, text string) {
+	s.event("output", map[string]any{"category": category, "output": text})
+}
+
+// ForwardOutput sends everything read from r as program output, for programs printing to redirected stdout
+func (s *DAPServer) ForwardOutput(r io.Reader) {
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := reader.ReadString('\n')
+
+		if line != "" {
+			s.Output("stdout", line)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *DAPServer) handle(request dapMessage) (any, error) {
+	switch request.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+		}, nil
+	case "launch":
+		if err := json.Unmarshal(request.Arguments, &s.launch); err != nil {
+			return nil, errors.Join(errors.New("got error while reading launch arguments"), err)
+		}
+
+		if s.launch.Program == "" {
+			return nil, errors.New("launch expects program")
+		}
+
+		if s.launch.StopOnEntry {
+			s.debugger.pending = StopEntry
+		}
+
+		return nil, nil
+	case "setBreakpoints":
+		var args struct {
+			Source      dapSource `json:"source"`
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		lines := make([]int, len(args.Breakpoints))
+		verified := make([]map[string]any, len(args.Breakpoints))
+
+		for idx, breakpoint := range args.Breakpoints {
+			lines[idx] = breakpoint.Line
+			verified[idx] = map[string]any{"verified": true, "line": breakpoint.Line}
+		}
+
+		s.debugger.SetBreakpoints(args.Source.Path, lines)
+
+		return map[string]any{"breakpoints": verified}, nil
+	case "setFunctionBreakpoints":
+		var args struct {
+			Breakpoints []struct {
+				Name string `json:"name"`
+			} `json:"breakpoints"`
+		}
+
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		names := make([]string, len(args.Breakpoints))
+		verified := make([]map[string]any, len(args.Breakpoints))
+
+		for idx, breakpoint := range args.Breakpoints {
+			names[idx] = breakpoint.Name
+			verified[idx] = map[string]any{"verified": true}
+		}
+
+		s.debugger.SetFunctionBreakpoints(names)
+
+		return map[string]any{"breakpoints": verified}, nil
+	case "configurationDone":
+		return nil, nil
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": 1, "name": "main"}}}, nil
+	case "stackTrace":
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		frames := make([]map[string]any, 0, len(s.stop.Frames))
+
+		for idx, frame := range slices.Backward(s.stop.Frames) {
+			frames = append(frames, map[string]any{
+				"id":     idx + 1,
+				"name":   frame.Function,
+				"line":   frame.Line,
+				"column": 1,
+				"source": dapSource{Name: frame.Source, Path: frame.Source},
+			})
+		}
+
+		return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		var args struct {
+			FrameId int `json:"frameId"`
+		}
+
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		if args.FrameId < 1 || args.FrameId > len(s.stop.Frames) {
+			return nil, fmt.Errorf("unknown frame %d", args.FrameId)
+		}
+
+		frame := s.stop.Frames[args.FrameId-1]
+		scopes := make([]map[string]any, 0)
+
+		for idx, scope := range frame.Scopes() {
+			name := fmt.Sprintf("Scope %d", idx)
+
+			if idx == 0 {
+				name = "Locals"
+			}
+
+			if scope.Global {
+				name = "Globals"
+			}
+
+			scopes = append(scopes, map[string]any{"name": name, "variablesReference": s.ref(scope), "expensive": scope.Global})
+		}
+
+		if frame.VM != nil {
+			last := DebugScope{Variables: map[string]*Literal{"LastExpr": frame.VM.LastExpr}}
+
+			scopes = append(scopes, map[string]any{"name": "Last expression", "variablesReference": s.ref(last), "expensive": false})
+		}
+
+		return map[string]any{"scopes": scopes}, nil
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		if args.VariablesReference < 1 || args.VariablesReference > len(s.refs) {
+			return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+		}
+
+		return map[string]any{"variables": s.variables(s.refs[args.VariablesReference-1])}, nil
+	case "continue", "next", "stepIn", "stepOut":
+		actions := map[string]DebugAction{"continue": DebugContinue, "next": DebugStepOver, "stepIn": DebugStepInto, "stepOut": DebugStepOut}
+
+		if err := s.resume(actions[request.Command]); err != nil {
+			return nil, err
+		}
+
+		if request.Command == "continue" {
+			return map[string]any{"allThreadsContinued": true}, nil
+		}
+
+		return nil, nil
+	case "disconnect", "terminate":
+		//Fails when the program isn't stopped, it's left running then
+		s.resume(DebugTerminate)
+
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported request %s", request.Command)
+}
+
+// run is the program, runs in it's own goroutine and blocks in stopped
+func (s *DAPServer) run() {
+	err := s.runProgram()
+	exitCode := 0
+
+	if err != nil && !errors.Is(err, ErrDebugTerminated) {
+		s.Output("stderr", err.Error()+"\n")
+		exitCode = 1
+	}
+
+	s.event("exited", map[string]any{"exitCode": exitCode})
+	s.event("terminated", nil)
+}
+
+func (s *DAPServer) runProgram() error {
+	code, err := os.ReadFile(s.launch.Program)
+
+	if err != nil {
+		return errors.Join(errors.New("got error while reading program"), err)
+	}
+
+	options := CompileOptions{Debugger: s.debugger, SyntaxPath: s.launch.Syntax}
+
+	if s.launch.Syntax != "" {
+		syntax, err := os.ReadFile(s.launch.Syntax)
+
+		if err != nil {
+			return errors.Join(errors.New("got error while reading syntax part"), err)
+		}
+
+		options.Syntax = string(syntax)
+	}
+
+	vm, err := GetVMWithOptions(string(code), s.launch.Program, options)
+
+	if err != nil {
+		return err
+	}
+
+	return vm.Run()
+}
+
+// stopped is the DebugHandler, waits for the client to resume
+func (s *DAPServer) stopped(stop DebugStop) DebugAction {
+	s.lock.Lock()
+	s.stop, s.refs, s.paused = stop, nil, true
+	s.lock.Unlock()
+
+	s.event("stopped", map[string]any{"reason": string(stop.Reason), "threadId": 1, "allThreadsStopped": true})
+
+	return <-s.actions
+}
+
+func (s *DAPServer) resume(action DebugAction) error {
+	s.lock.Lock()
+
+	if !s.paused {
+		s.lock.Unlock()
+
+		return errors.New("program isn't stopped")
+	}
+
+	s.paused = false
+	s.lock.Unlock()
+
+	s.actions <- action
+
+	return nil
+}
+
+// ref returns variablesReference of scope or value, valid until the program resumes
+func (s *DAPServer) ref(value any) int {
+	s.refs = append(s.refs, value)
+
+	return len(s.refs)
+}
+
+func (s *DAPServer) variables(value any) []dapVariable {
+	variables := make([]dapVariable, 0)
+
+	add := func(name string, value *Literal) {
+		variable := dapVariable{Name: name, Value: DebugValue(value)}
+
+		if value != nil && (value.LiteralType == ParsedObjLiteral || value.LiteralType == ParsedListLiteral) {
+			variable.VariablesReference = s.ref(value)
+		}
+
+		variables = append(variables, variable)
+	}
+
+	switch value := value.(type) {
+	case DebugScope:
+		names := make([]string, 0, len(value.Variables))
+
+		for name := range value.Variables {
+			names = append(names, name)
+		}
+
+		slices.Sort(names)
+
+		for _, name := range names {
+			add(name, value.Variables[name])
+		}
+	case *Literal:
+		obj := value.Value.(PartsIndexable)
+
+		for _, key := range orderedKeys(obj) {
+			name := strings.TrimPrefix(key, "RT")
+
+			if value.LiteralType == ParsedListLiteral {
+				name = strings.TrimPrefix(key, "IT")
+			}
+
+			add(name, obj.GetByKey(key))
+		}
+	}
+
+	return variables
+}
+
+func (s *DAPServer) event(name string, body any) {
+	s.send(dapMessage{Type: "event", Event: name, Body: body})
+}
+
+func (s *DAPServer) send(message dapMessage) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	s.seq++
+	message.Seq = s.seq
+
+	data, err := json.Marshal(message)
+
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func (s *DAPServer) read() (dapMessage, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+
+	if err != nil {
+		return dapMessage{}, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+
+	if err != nil {
+		return dapMessage{}, errors.Join(errors.New("got error while reading Content-Length"), err)
+	}
+
+	data := make([]byte, length)
+
+	if _, err := io.ReadFull(s.in, data); err != nil {
+		return dapMessage{}, err
+	}
+
+	var message dapMessage
+
+	if err := json.Unmarshal(data, &message); err != nil {
+		return dapMessage{}, errors.Join(errors.New("got error while decoding message"), err)
+	}
+
+	return message, nil
+}
+
+func dapBool(value bool) *bool {
+	return &value
+}
@@ -0,0 +1,262 @@
+package parts
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// StopReason tells why the program stopped, values match the ones used by DAP
+type StopReason string
+
+const (
+	StopEntry      StopReason = "entry"
+	StopStep       StopReason = "step"
+	StopBreakpoint StopReason = "breakpoint"
+	StopFunction   StopReason = "function breakpoint"
+)
+
+// DebugAction is what the program does after the stop
+type DebugAction int
+
+const (
+	DebugContinue DebugAction = iota
+	//Stop on the next line of the same function (or its caller after returning)
+	DebugStepOver
+	//Stop on the next line, wherever it is
+	DebugStepInto
+	//Stop on the next line of the caller
+	DebugStepOut
+	//Abort the program with an error
+	DebugTerminate
+)
+
+var ErrDebugTerminated = errors.New("program terminated by the debugger")
+
+// DebugFrame is single function call, it's VM is the last one that ran a line of it
+type DebugFrame struct {
+	Function string
+	Source   string
+	Line     int
+	VM       *VM
+}
+
+// DebugScope is single VMEnviroment, names are without the RT prefix
+type DebugScope struct {
+	Variables map[string]*Literal
+
+	//Outermost scope, holds the standard library
+	Global bool
+}
+
+// DebugStop is passed to the handler, frames are ordered from the top level code to the current function
+type DebugStop struct {
+	Reason   StopReason
+	Frames   []DebugFrame
+	LastExpr *Literal
+}
+
+// DebugHandler is called on every stop, program waits until it returns
+type DebugHandler func(stop DebugStop) DebugAction
+
+// Debugger stops the program on breakpoints and while stepping. Lines are only
+// known when the code was compiled with them (CompileOptions.Lines), single
+// debugger is shared by the VM, all of its sub VMs and the syntax part VMs so
+// rules called while parsing can be stepped through too. Methods do nothing on
+// nil debugger.
+type Debugger struct {
+	Handler DebugHandler
+
+	//Guards breakpoints, they can be changed while the program runs
+	lock        sync.Mutex
+	breakpoints map[string][]int
+	functions   []string
+
+	action      DebugAction
+	actionDepth int
+
+	//Set on entering function with a breakpoint, stops on it's first line (cleared when it returns without one)
+	pending StopReason
+
+	frames     []DebugFrame
+	terminated bool
+}
+
+func NewDebugger(handler DebugHandler, stopOnEntry bool) *Debugger {
+	d := &Debugger{
+		Handler:     handler,
+		breakpoints: make(map[string][]int),
+		frames:      []DebugFrame{{Function: "main"}},
+	}
+
+	if stopOnEntry {
+		d.pending = StopEntry
+	}
+
+	return d
+}
+
+// SetBreakpoints replaces line breakpoints of the source
+func (d *Debugger) SetBreakpoints(source string, lines []int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.breakpoints[debugSource(source)] = slices.Clone(lines)
+}
+
+// SetFunctionBreakpoints replaces function breakpoints, names are the ones functions are called by ("Array.Slice")
+func (d *Debugger) SetFunctionBreakpoints(names []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.functions = slices.Clone(names)
+}
+
+// Frames returns copy of the call stack, current function last
+func (d *Debugger) Frames() []DebugFrame {
+	return slices.Clone(d.frames)
+}
+
+func (d *Debugger) enter(fun PartsCallable, name string) {
+	if d == nil {
+		return
+	}
+
+	if name == "" {
+		name = "anonymous"
+	}
+
+	top := d.frames[len(d.frames)-1]
+
+	d.frames = append(d.frames, DebugFrame{Function: name, Source: top.Source, Line: top.Line})
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if _, ok := fun.(FunctionDeclaration); ok && slices.Contains(d.functions, name) && d.pending == "" {
+		d.pending = StopFunction
+	}
+}
+
+func (d *Debugger) exit() {
+	if d == nil || len(d.frames) == 1 {
+		return
+	}
+
+	d.frames = d.frames[:len(d.frames)-1]
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.pending == StopFunction {
+		d.pending = ""
+	}
+}
+
+// line is called on every B_LINE, stops when there's a reason to
+func (d *Debugger) line(vm *VM) error {
+	if d == nil {
+		return nil
+	}
+
+	if d.terminated {
+		return ErrDebugTerminated
+	}
+
+	depth := len(d.frames)
+	frame := &d.frames[depth-1]
+
+	frame.Source, frame.Line, frame.VM = vm.Source, vm.Line, vm
+
+	d.lock.Lock()
+	reason := d.pending
+
+	if reason == "" && slices.Contains(d.breakpoints[debugSource(vm.Source)], vm.Line) {
+		reason = StopBreakpoint
+	}
+
+	d.lock.Unlock()
+
+	if reason == "" {
+		switch {
+		case d.action == DebugStepInto,
+			d.action == DebugStepOver && depth <= d.actionDepth,
+			d.action == DebugStepOut && depth < d.actionDepth:
+			reason = StopStep
+		}
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	d.pending = ""
+
+	action := DebugContinue
+
+	if d.Handler != nil {
+		action = d.Handler(DebugStop{Reason: reason, Frames: d.Frames(), LastExpr: vm.LastExpr})
+	}
+
+	d.action, d.actionDepth = action, depth
+
+	if action == DebugTerminate {
+		d.terminated = true
+
+		return ErrDebugTerminated
+	}
+
+	return nil
+}
+
+// Scopes lists the VMEnviroment chain of the frame, innermost first
+func (f DebugFrame) Scopes() []DebugScope {
+	if f.VM == nil {
+		return []DebugScope{}
+	}
+
+	scopes := make([]DebugScope, 0)
+
+	for env := f.VM.Enviroment; env != nil; env = env.Enclosing {
+		scope := DebugScope{Variables: make(map[string]*Literal), Global: env.Enclosing == nil}
+
+		for key, value := range env.Values {
+			scope.Variables[strings.TrimPrefix(key, "RT")] = value
+		}
+
+		for _, local := range env.Locals {
+			scope.Variables[strings.TrimPrefix(local.Name, "RT")] = local.Value
+		}
+
+		scopes = append(scopes, scope)
+	}
+
+	return scopes
+}
+
+func debugSource(source string) string {
+	if source == "" {
+		return ""
+	}
+
+	return filepath.Clean(source)
+}
+
+// DebugValue formats value the way debugger shows it, strings are quoted
+func DebugValue(value *Literal) string {
+	if value == nil {
+		return "nil"
+	}
+
+	switch value.LiteralType {
+	case StringLiteral:
+		return fmt.Sprintf("%q", value.Value)
+	case ObjLiteral, ListLiteral:
+		return "<definition>"
+	}
+
+	return value.pretify()
+}
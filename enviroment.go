@@ -3,40 +3,55 @@ package parts
 import (
 	"errors"
 	"fmt"
+	"slices"
 )
 
 type VMEnviroment struct {
 	Enclosing *VMEnviroment
 
+	//Created on the first definition by name
 	Values map[string]*Literal
-}
 
-func (env *VMEnviroment) Define(key string, value *Literal) error {
-	key = fmt.Sprintf("RT%s", key)
+	//Names in the order they were defined
+	order []string
 
-	if _, ok := env.Values[key]; ok {
-		return fmt.Errorf("redefining variable in the same scope ('%s')", key)
-	}
+	//Variables with slots assigned by Resolve, still reachable by name
+	Locals []LocalVariable
 
-	env.Values[key] = value
+	//Set on scopes of loop iterations
+	loop *loopState
+}
 
-	return nil
+type LocalVariable struct {
+	Name  string
+	Value *Literal
+}
+
+func (env *VMEnviroment) Define(key string, value *Literal) error {
+	_, err := env.define(fmt.Sprintf("RT%s", key), value)
+
+	return err
 }
 
 func (env *VMEnviroment) Resolve(key string) (*Literal, error) {
-	if value, ok := env.Values[fmt.Sprintf("RT%s", key)]; ok {
-		return value, nil
-	}
+	value, err := env.resolve(fmt.Sprintf("RT%s", key))
 
-	if env.Enclosing != nil {
-		return env.Enclosing.Resolve(key)
+	if err != nil {
+		return nil, fmt.Errorf("undefined variable resolve '%s'", key)
 	}
 
-	return nil, fmt.Errorf("undefined variable resolve '%s'", key)
+	return value, nil
 }
 
-func (env *VMEnviroment) DefineFunction(key string, val any) error {
-	return env.Define(key, &Literal{FunLiteral, FFIFunction{val}})
+// DefineFunction defines Go function, names are the argument names (see NewFFIFunction)
+func (env *VMEnviroment) DefineFunction(key string, val any, names ...string) error {
+	ffi, err := NewFFIFunction(val, names...)
+
+	if err != nil {
+		return errors.Join(fmt.Errorf("got error while defining function '%s'", key), err)
+	}
+
+	return env.Define(key, &Literal{FunLiteral, ffi})
 }
 
 func (env *VMEnviroment) DefineNativeFunction(key string, val NativeMethod) error {
@@ -58,20 +73,44 @@ func (env *VMEnviroment) AppendValues(values map[string]any) error {
 }
 
 func (env *VMEnviroment) define(key string, value *Literal) (*Literal, error) {
-	if _, ok := env.Values[key]; ok {
+	if _, ok := env.Values[key]; ok || env.local(key) != -1 {
 		return nil, fmt.Errorf("redefining variable in the same scope ('%s')", key)
 	}
 
+	if env.Values == nil {
+		env.Values = make(map[string]*Literal)
+	}
+
 	env.Values[key] = value
+	env.order = append(env.order, key)
 
 	return value, nil
 }
 
+// local returns slot of the variable with given hashed name, -1 if there's none
+func (env *VMEnviroment) local(key string) int {
+	if len(env.Locals) == 0 || len(key) < 2 || key[:2] != "RT" {
+		return -1
+	}
+
+	for idx, local := range env.Locals {
+		if local.Name == key[2:] {
+			return idx
+		}
+	}
+
+	return -1
+}
+
 func (env *VMEnviroment) resolve(key string) (*Literal, error) {
 	if value, exists := env.Values[key]; exists {
 		return value, nil
 	}
 
+	if slot := env.local(key); slot != -1 {
+		return env.Locals[slot].Value, nil
+	}
+
 	if env.Enclosing != nil {
 		return env.Enclosing.resolve(key)
 	}
@@ -83,6 +122,12 @@ func (env *VMEnviroment) assign(key string, value *Literal) (*Literal, error) {
 	_, exists := env.Values[key]
 
 	if !exists {
+		if slot := env.local(key); slot != -1 {
+			env.Locals[slot].Value = value
+
+			return value, nil
+		}
+
 		if env.Enclosing == nil {
 			return nil, errors.New("setting to a variable that doesn't exist")
 		} else {
@@ -104,6 +149,10 @@ func (env *VMEnviroment) assignDot(vm *VM, key []*Literal, value *Literal) (*Lit
 
 	accessor, exists := env.Values[hash]
 
+	if slot := env.local(hash); !exists && slot != -1 {
+		accessor, exists = env.Locals[slot].Value, true
+	}
+
 	if !exists {
 		if env.Enclosing == nil {
 			return nil, errors.New("setting to a variable that doesn't exist (dot operation)")
@@ -133,6 +182,10 @@ func (env *VMEnviroment) assignDot(vm *VM, key []*Literal, value *Literal) (*Lit
 			return nil, errors.Join(errors.New("got error while hashing key"), err)
 		}
 
+		if ffi, ok := accessor.Value.(*FFIStruct); ok {
+			return value, ffi.assign(vm, keyHash, value)
+		}
+
 		if has := accessor.Value.(PartsIndexable).HasByKey(keyHash); has {
 			return accessor.Value.(PartsIndexable).SetByKey(keyHash, value), nil
 		} else {
@@ -146,6 +199,10 @@ func (env *VMEnviroment) assignDot(vm *VM, key []*Literal, value *Literal) (*Lit
 func (env *VMEnviroment) Has(key string) bool {
 	_, exists := env.Values[key]
 
+	if !exists {
+		exists = env.local(key) != -1
+	}
+
 	if !exists && env.Enclosing != nil {
 		return env.Enclosing.Has(key)
 	}
@@ -164,6 +221,20 @@ func (env *VMEnviroment) Append(other *VMEnviroment) {
 	env.Enclosing = other
 }
 
+// PartsObject returns the scope as object, keys are in the order they were defined
 func (env *VMEnviroment) PartsObject() PartsObject {
-	return PartsObject{Entries: env.Values}
+	return PartsObject{Entries: env.Values, Order: slices.Clone(env.order)}
+}
+
+func (env *VMEnviroment) declareLocal(name string, value *Literal) {
+	env.Locals = append(env.Locals, LocalVariable{Name: name, Value: value})
+}
+
+// enclosing returns the scope depth levels up, nil when the chain is shorter
+func (env *VMEnviroment) enclosing(depth int) *VMEnviroment {
+	for ; depth > 0 && env != nil; depth-- {
+		env = env.Enclosing
+	}
+
+	return env
 }
@@ -0,0 +1,399 @@
+package parts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// GenerateOptions control Go code written by GenerateGo
+type GenerateOptions struct {
+	//Package clause of the file, "main" when empty
+	Package string
+
+	//Name of the struct holding the globals, "Config" when empty. Nested
+	//structs are named after it and the field (ConfigLoot) and the loaders are
+	//Load<Name> and Load<Name>File.
+	Name string
+}
+
+// InferSchema builds schema from globals of VMs that already ran. Values seen
+// in every VM (or every element of a list) are required, Int and Double
+// together become Number and nil makes the type nullable.
+func InferSchema(vms ...*VM) (*Schema, error) {
+	var schema *Schema
+
+	for _, vm := range vms {
+		globals := &Schema{Type: "Object", Fields: make(map[string]*Schema)}
+
+		for key, value := range vm.Enviroment.Values {
+			name, ok := strings.CutPrefix(key, "RT")
+
+			if !ok {
+				continue
+			}
+
+			simplified, err := vm.simplifyLiteral(value, true)
+
+			if err != nil {
+				return nil, errors.Join(fmt.Errorf("got error while reading %s", name), err)
+			}
+
+			field := inferSchema(simplified)
+			field.Required = true
+
+			globals.Fields[name] = field
+		}
+
+		schema = mergeSchemas(schema, globals)
+	}
+
+	if schema == nil {
+		return &Schema{Fields: make(map[string]*Schema)}, nil
+	}
+
+	schema.Type = ""
+
+	return schema, nil
+}
+
+func inferSchema(value *Literal) *Schema {
+	switch value.LiteralType {
+	case NilLiteral:
+		return &Schema{Type: "Nil"}
+	case ParsedListLiteral:
+		var items *Schema
+
+		for _, item := range listValues(value.Value.(PartsIndexable)) {
+			items = mergeSchemas(items, inferSchema(item))
+		}
+
+		return &Schema{Type: "List", Items: items}
+	case ParsedObjLiteral:
+		obj := value.Value.(PartsIndexable)
+		schema := &Schema{Type: "Object", Fields: make(map[string]*Schema)}
+
+		for _, key := range objectKeys(obj) {
+			field := inferSchema(obj.GetByKey(key))
+			field.Required = true
+
+			schema.Fields[keyLiteral(key).pretify()] = field
+		}
+
+		return schema
+	}
+
+	return &Schema{Type: TypeHintOf(value).Name}
+}
+
+// mergeSchemas returns schema accepting values of both, nil is schema of empty list items
+func mergeSchemas(a, b *Schema) *Schema {
+	if a == nil {
+		return b
+	}
+
+	if b == nil {
+		return a
+	}
+
+	merged := &Schema{Required: a.Required && b.Required, Type: mergeTypes(a.Type, b.Type)}
+
+	if a.Items != nil || b.Items != nil {
+		merged.Items = mergeSchemas(a.Items, b.Items)
+	}
+
+	if a.Fields != nil || b.Fields != nil {
+		merged.Fields = make(map[string]*Schema)
+
+		for name, field := range a.Fields {
+			if other, ok := b.Fields[name]; ok {
+				merged.Fields[name] = mergeSchemas(field, other)
+			} else {
+				optional := *field
+				optional.Required = false
+				merged.Fields[name] = &optional
+			}
+		}
+
+		for name, field := range b.Fields {
+			if _, ok := a.Fields[name]; !ok {
+				optional := *field
+				optional.Required = false
+				merged.Fields[name] = &optional
+			}
+		}
+	}
+
+	return merged
+}
+
+func mergeTypes(a, b string) string {
+	aName, aNullable := strings.CutSuffix(a, "?")
+	bName, bNullable := strings.CutSuffix(b, "?")
+
+	nullable := aNullable || bNullable
+
+	switch {
+	case aName == "Nil":
+		aName, nullable = bName, true
+	case bName == "Nil":
+		bName, nullable = aName, true
+	}
+
+	name := ""
+
+	switch {
+	case aName == bName:
+		name = aName
+	case isNumberType(aName) && isNumberType(bName):
+		name = "Number"
+	}
+
+	if name == "" || name == "Any" || name == "Nil" || !nullable {
+		return name
+	}
+
+	return name + "?"
+}
+
+func isNumberType(name string) bool {
+	return name == "Int" || name == "Double" || name == "Number"
+}
+
+// GenerateGo writes Go file with structs for the schema (with `parts` tags
+// SchemaFor reads back) and loaders using Unmarshal. Functions are skipped.
+func GenerateGo(schema *Schema, options GenerateOptions) ([]byte, error) {
+	if options.Package == "" {
+		options.Package = "main"
+	}
+
+	if options.Name == "" {
+		options.Name = "Config"
+	}
+
+	if !isGoIdentifier(options.Name) {
+		return nil, fmt.Errorf("'%s' can't be used as type name", options.Name)
+	}
+
+	g := generator{names: map[string]bool{options.Name: true}}
+	g.structs = append(g.structs, generatedStruct{name: options.Name, schema: schema})
+
+	var body bytes.Buffer
+
+	//Nested structs are appended while writing the ones before them
+	for idx := 0; idx < len(g.structs); idx++ {
+		g.writeStruct(&body, g.structs[idx])
+	}
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "// Code generated by parts gen. DO NOT EDIT.\n\npackage %s\n\n", options.Package)
+	b.WriteString("import (\n\t\"errors\"\n\t\"os\"\n\n\t\"github.com/tfo-dot/parts\"\n)\n\n")
+	b.Write(body.Bytes())
+
+	fmt.Fprintf(&b, `// Load%[1]s runs the source and reads its globals into %[1]s
+func Load%[1]s(source string) (*%[1]s, error) {
+	value := &%[1]s{}
+
+	if err := parts.Unmarshal(source, value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// Load%[1]sFile is Load%[1]s for the file, imports are relative to it
+func Load%[1]sFile(path string) (*%[1]s, error) {
+	source, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	vm, err := parts.GetVMWithSource(string(source), path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = vm.Run(); err != nil {
+		return nil, errors.Join(errors.New("got error while running "+path), err)
+	}
+
+	value := &%[1]s{}
+
+	if err := parts.UnmarshalVM(vm, value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+`, options.Name)
+
+	formatted, err := format.Source(b.Bytes())
+
+	if err != nil {
+		return nil, errors.Join(errors.New("got error while formatting generated code"), err)
+	}
+
+	return formatted, nil
+}
+
+type generatedStruct struct {
+	name   string
+	schema *Schema
+}
+
+type generator struct {
+	structs []generatedStruct
+	//Type names already used
+	names map[string]bool
+}
+
+func (g *generator) writeStruct(b *bytes.Buffer, s generatedStruct) {
+	fmt.Fprintf(b, "type %s struct {\n", s.name)
+
+	used := make(map[string]bool)
+
+	for _, name := range sortedKeys(s.schema.Fields) {
+		field := s.schema.Fields[name]
+
+		//Keys that don't fit in the tag can't be read back
+		if strings.TrimSuffix(field.Type, "?") == "Fun" || strings.ContainsAny(name, ",\"`") {
+			continue
+		}
+
+		fieldName := uniqueName(goName(name), used)
+		goType := g.goType(s.name+fieldName, field)
+
+		fmt.Fprintf(b, "\t%s %s `parts:\"%s\"`\n", fieldName, goType, fieldTag(name, field))
+	}
+
+	b.WriteString("}\n\n")
+}
+
+// goType returns Go type for the schema, structs are named by name and written later
+func (g *generator) goType(name string, schema *Schema) string {
+	if schema == nil {
+		return "any"
+	}
+
+	typeName, nullable := strings.CutSuffix(schema.Type, "?")
+
+	goType := "any"
+
+	switch typeName {
+	case "Int":
+		goType = "int"
+	case "Double", "Number":
+		goType = "float64"
+	case "Bool":
+		goType = "bool"
+	case "String":
+		goType = "string"
+	case "List":
+		return "[]" + g.goType(name, schema.Items)
+	case "Object":
+		if len(schema.Fields) == 0 {
+			return "map[string]" + g.goType(name, schema.Values)
+		}
+
+		goType = uniqueName(name, g.names)
+		g.structs = append(g.structs, generatedStruct{name: goType, schema: schema})
+	}
+
+	if nullable && goType != "any" {
+		return "*" + goType
+	}
+
+	return goType
+}
+
+// fieldTag is the `parts` tag with options SchemaFor reads back
+func fieldTag(name string, schema *Schema) string {
+	options := []string{name}
+
+	if schema.Required {
+		options = append(options, "required")
+	}
+
+	if schema.Min != nil {
+		options = append(options, "min="+strconv.FormatFloat(*schema.Min, 'g', -1, 64))
+	}
+
+	if schema.Max != nil {
+		options = append(options, "max="+strconv.FormatFloat(*schema.Max, 'g', -1, 64))
+	}
+
+	if len(schema.Enum) > 0 {
+		values := make([]string, len(schema.Enum))
+
+		for idx, value := range schema.Enum {
+			values[idx] = fmt.Sprint(value)
+		}
+
+		enum := strings.Join(values, "|")
+
+		//Values with separators can't be written in the tag
+		if !strings.ContainsAny(enum, ",\"`") && len(strings.Split(enum, "|")) == len(values) {
+			options = append(options, "enum="+enum)
+		}
+	}
+
+	return strings.Join(options, ",")
+}
+
+// goName makes exported Go name from the key, `max_hp` is MaxHp
+func goName(key string) string {
+	var b strings.Builder
+
+	upper := true
+
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+
+		b.WriteRune(r)
+	}
+
+	name := b.String()
+
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "Field" + name
+	}
+
+	return name
+}
+
+func uniqueName(name string, used map[string]bool) string {
+	unique := name
+
+	for idx := 2; used[unique]; idx++ {
+		unique = name + strconv.Itoa(idx)
+	}
+
+	used[unique] = true
+
+	return unique
+}
+
+func isGoIdentifier(name string) bool {
+	for idx, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (idx == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+
+	return name != ""
+}
@@ -0,0 +1,177 @@
+package parts
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type generatorMessage struct {
+	Value *Literal
+	Err   error
+	Done  bool
+}
+
+// GeneratorState holds a suspended generator body. The body runs on its own
+// goroutine and hands control back and forth with the caller, so only one
+// side is ever running at a time.
+type GeneratorState struct {
+	vm      *VM
+	resume  chan bool
+	yields  chan generatorMessage
+	started bool
+	done    bool
+
+	//Set the generator is registered in, it leaves it once done
+	owner *generatorSet
+}
+
+// generatorSet keeps generators that didn't finish yet, it's shared with all
+// sub VMs so the ones left over can be closed once the program ends
+type generatorSet struct {
+	lock   sync.Mutex
+	states map[*GeneratorState]struct{}
+}
+
+func NewGenerator(vm *VM) *GeneratorState {
+	state := &GeneratorState{
+		vm:     vm,
+		resume: make(chan bool),
+		yields: make(chan generatorMessage),
+		owner:  vm.generatorSet(),
+	}
+
+	state.owner.add(state)
+
+	vm.Generator = state
+
+	return state
+}
+
+// generatorSet returns generators of the program, it's created on first use
+func (vm *VM) generatorSet() *generatorSet {
+	if vm.generators == nil {
+		vm.generators = &generatorSet{states: map[*GeneratorState]struct{}{}}
+	}
+
+	return vm.generators
+}
+
+func (s *generatorSet) add(state *GeneratorState) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.states[state] = struct{}{}
+}
+
+func (s *generatorSet) remove(state *GeneratorState) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.states, state)
+}
+
+// closeAll closes generators that are still suspended, so their goroutines can exit
+func (s *generatorSet) closeAll() {
+	s.lock.Lock()
+	states := make([]*GeneratorState, 0, len(s.states))
+
+	for state := range s.states {
+		states = append(states, state)
+	}
+
+	s.lock.Unlock()
+
+	for _, state := range states {
+		state.Close()
+	}
+}
+
+func (g *GeneratorState) Next() (*Literal, error) {
+	if g.done {
+		return NewOptionNone(), nil
+	}
+
+	if !g.started {
+		g.started = true
+		go g.run()
+	} else {
+		g.resume <- true
+	}
+
+	msg := <-g.yields
+
+	if msg.Err != nil {
+		g.finish()
+		return nil, errors.Join(errors.New("got error while running generator body"), msg.Err)
+	}
+
+	if msg.Done {
+		g.finish()
+		return NewOptionNone(), nil
+	}
+
+	return NewOptionSome(msg.Value), nil
+}
+
+func (g *GeneratorState) Close() {
+	if g.started && !g.done {
+		g.resume <- false
+		<-g.yields
+	}
+
+	g.finish()
+}
+
+func (g *GeneratorState) finish() {
+	g.done = true
+
+	if g.owner != nil {
+		g.owner.remove(g)
+	}
+}
+
+func (g *GeneratorState) Iterator() *Literal {
+	return &Literal{ParsedObjLiteral, PartsSpecialObject{
+		Hash: "Parts.Iterator",
+		Internal: &PartsObject{
+			Entries: map[string]*Literal{
+				"RTnext": {FunLiteral, NativeMethod{
+					Args: []string{},
+					Body: func(vm *VM, args []*Literal) (*Literal, error) {
+						return g.Next()
+					},
+				}},
+				"RTclose": {FunLiteral, NativeMethod{
+					Args: []string{},
+					Body: func(vm *VM, args []*Literal) (*Literal, error) {
+						g.Close()
+						return nil, nil
+					},
+				}},
+			},
+		},
+	}}
+}
+
+func (g *GeneratorState) run() {
+	defer func() {
+		if r := recover(); r != nil {
+			g.yields <- generatorMessage{Err: fmt.Errorf("generator panicked: %v", r), Done: true}
+		}
+	}()
+
+	err := g.vm.Run()
+
+	g.yields <- generatorMessage{Err: err, Done: true}
+}
+
+func (g *GeneratorState) yield(value *Literal) error {
+	g.yields <- generatorMessage{Value: value}
+
+	if !<-g.resume {
+		return errors.New("generator closed")
+	}
+
+	return nil
+}
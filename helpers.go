@@ -26,19 +26,86 @@ func GetParserWithSource(source, modulePath string) Parser {
 	}
 }
 
+// CompileOptions control how the source is turned into code for the VM
+type CompileOptions struct {
+	//Source of the syntax part ran before parsing, empty when there's none
+	Syntax string
+
+	//Run Optimize over the parsed code
+	Optimize bool
+
+	//Records time spent in rules while parsing and in functions while running
+	Profiler *Profiler
+
+	//Emit B_LINE before every statement, always on when debugging
+	Lines bool
+
+	//Stops on breakpoints, applies to the syntax part as well
+	Debugger *Debugger
+
+	//Path of the syntax part, breakpoints in it are set with this path
+	SyntaxPath string
+
+	//Observe the VM, applies to the syntax part as well
+	Hooks Hooks
+
+	//Collects line and branch coverage, applies to the syntax part as well
+	Coverage *Coverage
+
+	//Name of the code in positions (debugger, coverage), module path when empty
+	Source string
+}
+
 func GetVMWithSource(source string, path string) (*VM, error) {
-	parser := GetParserWithSource(source, path)
+	return GetVMWithOptions(source, path, CompileOptions{})
+}
 
-	code, err := parser.ParseAll()
+// GetVMWithOptions compiles the source and returns VM ready to run it
+func GetVMWithOptions(source, modulePath string, options CompileOptions) (*VM, error) {
+	parser := GetParserWithSource(source, modulePath)
 
-	if err != nil {
-		return nil, errors.Join(errors.New("got error from within parser"), err)
+	parser.Profiler = options.Profiler
+	parser.Scanner.Profiler = options.Profiler
+	name := options.Source
+
+	if name == "" {
+		name = modulePath
 	}
 
-	literals := make([]*Literal, len(parser.Literals))
+	parser.Lines = options.Lines || options.Debugger != nil || options.Coverage != nil
+	parser.Debugger = options.Debugger
+	parser.Coverage = options.Coverage
+	parser.Source = name
 
-	for idx, literal := range parser.Literals {
-		literals[idx] = &literal
+	options.Coverage.addSource(name, source)
+
+	if options.Syntax != "" {
+		syntaxSource := options.SyntaxPath
+
+		if syntaxSource == "" {
+			syntaxSource = "<syntax>"
+		}
+
+		syntaxVM, err := GetVMWithOptions(options.Syntax, modulePath, CompileOptions{Debugger: options.Debugger, Hooks: options.Hooks, Coverage: options.Coverage, Source: syntaxSource})
+
+		if err != nil {
+			return nil, errors.Join(errors.New("got error when parsing syntax code"), err)
+		}
+
+		//Rules from the syntax part call into this VM while parsing
+		syntaxVM.Profiler = options.Profiler
+
+		FillConsts(syntaxVM, &parser)
+
+		if err = syntaxVM.Run(); err != nil {
+			return nil, errors.Join(errors.New("got error while running syntax code"), err)
+		}
+	}
+
+	code, literals, err := Compile(&parser, options)
+
+	if err != nil {
+		return nil, err
 	}
 
 	vmEnv := VMEnviroment{
@@ -55,16 +122,24 @@ func GetVMWithSource(source string, path string) (*VM, error) {
 		Code:     code,
 		Literals: literals,
 		Meta:     parser.Meta,
+		Profiler: options.Profiler,
+		Debugger: options.Debugger,
+		Hooks:    options.Hooks,
+		Coverage: options.Coverage,
+		Source:   name,
 	}, nil
 }
 
-func RunString(codeString, modulePath string) (*VM, error) {
-	parser := GetParserWithSource(codeString, modulePath)
-
+// Compile parses everything left in the parser, code and literals can be passed straight to the VM
+func Compile(parser *Parser, options CompileOptions) ([]Bytecode, []*Literal, error) {
 	code, err := parser.ParseAll()
 
 	if err != nil {
-		return nil, errors.Join(errors.New("got error from within parser"), err)
+		if options.Syntax != "" {
+			return nil, nil, errors.Join(errors.New("got error from within syntax parser"), err)
+		}
+
+		return nil, nil, errors.Join(errors.New("got error from within parser"), err)
 	}
 
 	literals := make([]*Literal, len(parser.Literals))
@@ -73,101 +148,211 @@ func RunString(codeString, modulePath string) (*VM, error) {
 		literals[idx] = &literal
 	}
 
-	vmEnv := VMEnviroment{
-		Enclosing: nil,
-		Values:    StandardLibrary,
+	if options.Optimize {
+		code, literals = Optimize(code, literals)
 	}
 
-	vm := VM{
-		Enviroment: &VMEnviroment{
-			Enclosing: &vmEnv,
-			Values:    make(map[string]*Literal),
-		},
-		Idx:      0,
-		Code:     code,
-		Literals: literals,
-		Meta:     parser.Meta,
-	}
+	return Resolve(code, literals), literals, nil
+}
 
-	err = vm.Run()
+func RunString(codeString, modulePath string) (*VM, error) {
+	return RunStringWithOptions(codeString, modulePath, CompileOptions{})
+}
+
+func RunStringWithSyntax(codeString, syntax, modulePath string) (*VM, error) {
+	return RunStringWithOptions(codeString, modulePath, CompileOptions{Syntax: syntax})
+}
+
+func RunStringWithOptions(codeString, modulePath string, options CompileOptions) (*VM, error) {
+	vm, err := GetVMWithOptions(codeString, modulePath, options)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &vm, nil
+	if err = vm.Run(); err != nil {
+		return nil, err
+	}
+
+	return vm, nil
 }
 
-func RunStringWithSyntax(codeString, syntax, modulePath string) (*VM, error) {
-	syntaxVM, err := GetVMWithSource(syntax, modulePath)
+func RunAndRead[T any](code string, out *T) error {
+	vm, err := GetVMWithSource(code, "./")
+
+	if err != nil {
+		return err
+	}
+
+	err = vm.Run()
 
 	if err != nil {
-		return nil, errors.Join(errors.New("got error when parsing syntax code"), err)
+		return err
 	}
 
-	parser := GetParserWithSource(codeString, modulePath)
+	ReadFromParts(vm, out)
 
-	FillConsts(syntaxVM, &parser)
+	return nil
+}
 
-	err = syntaxVM.Run()
+// RaisedError is returned by Call when the function returns Result.Error
+type RaisedError struct {
+	Function string
+	Value    *Literal
+}
+
+func (e *RaisedError) Error() string {
+	return fmt.Sprintf("%s returned error: %s", e.Function, e.Value.pretify())
+}
+
+// Get returns variable converted to Go types, fields of objects can be read as "handlers.onSpawn"
+func (vm *VM) Get(name string) (any, error) {
+	value, err := vm.lookup(name)
 
 	if err != nil {
-		return nil, errors.Join(errors.New("got error while running syntax code"), err)
+		return nil, err
 	}
 
-	code, err := parser.ParseAll()
+	return value.ToGoTypes(vm)
+}
+
+// Call calls function by name (same as in Get) with arguments converted from Go,
+// Result.Ok is unwrapped and Result.Error is returned as *RaisedError
+func (vm *VM) Call(name string, args ...any) (any, error) {
+	callVM, res, err := vm.call(name, args)
+
+	if err != nil || res == nil {
+		return nil, err
+	}
+
+	return res.ToGoTypes(callVM)
+}
+
+// CallAs is Call with the result decoded into T the same way Unmarshal decodes fields
+func CallAs[T any](vm *VM, name string, args ...any) (T, error) {
+	var out T
+
+	callVM, res, err := vm.call(name, args)
+
+	if err != nil || res == nil {
+		return out, err
+	}
+
+	d := decoder{vm: callVM}
+
+	if err := d.decode("result", res, reflect.ValueOf(&out).Elem()); err != nil {
+		return out, errors.Join(fmt.Errorf("got error while converting result of '%s'", name), err)
+	}
+
+	return out, nil
+}
+
+// call returns unwrapped result of the function and the VM it ran in
+func (vm *VM) call(name string, args []any) (*VM, *Literal, error) {
+	value, err := vm.lookup(name)
 
 	if err != nil {
-		return nil, errors.Join(errors.New("got error from within syntax parser"), err)
+		return nil, nil, err
 	}
 
-	literals := make([]*Literal, len(parser.Literals))
+	if value.LiteralType != FunLiteral {
+		return nil, nil, fmt.Errorf("'%s' is not a function, got %s", name, TypeHintOf(value))
+	}
 
-	for idx, literal := range parser.Literals {
-		literals[idx] = &literal
+	callVM, res, err := vm.callFromGo(value.Value.(PartsCallable), args)
+
+	if err != nil {
+		return nil, nil, errors.Join(fmt.Errorf("got error while calling '%s'", name), err)
 	}
 
-	vmEnv := VMEnviroment{
-		Enclosing: nil,
-		Values:    StandardLibrary,
+	if res == nil {
+		return callVM, nil, nil
 	}
 
-	vm := VM{
-		Enviroment: &VMEnviroment{
-			Enclosing: &vmEnv,
-			Values:    make(map[string]*Literal),
-		},
-		Idx:      0,
-		Code:     code,
-		Literals: literals,
-		Meta:     parser.Meta,
+	if IsResultError(res) {
+		return nil, nil, &RaisedError{Function: name, Value: res.Value.(PartsIndexable).GetByKey("RTValue")}
 	}
 
-	err = vm.Run()
+	if IsResultOK(res) {
+		res = res.Value.(PartsIndexable).GetByKey("RTValue")
+	}
+
+	return callVM, res, nil
+}
+
+// lookup resolves dotted name starting from the VM enviroment
+func (vm *VM) lookup(name string) (*Literal, error) {
+	segments := strings.Split(name, ".")
+
+	value, err := vm.Enviroment.Resolve(segments[0])
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &vm, nil
+	for idx, part := range segments[1:] {
+		value, err = vm.simplifyLiteral(value, true)
+
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("got error while resolving '%s'", strings.Join(segments[:idx+1], ".")), err)
+		}
+
+		indexable, ok := value.Value.(PartsIndexable)
+
+		if !ok || value.LiteralType != ParsedObjLiteral {
+			return nil, fmt.Errorf("'%s' is not an object", strings.Join(segments[:idx+1], "."))
+		}
+
+		if !indexable.HasByKey("RT" + part) {
+			return nil, fmt.Errorf("key not found: %s", strings.Join(segments[:idx+2], "."))
+		}
+
+		value = indexable.GetByKey("RT" + part)
+	}
+
+	return vm.simplifyLiteral(value, true)
 }
 
-func RunAndRead[T any](code string, out *T) error {
-	vm, err := GetVMWithSource(code, "./")
+// callFromGo converts arguments, checks them against parameter types and calls the function
+func (vm *VM) callFromGo(fun PartsCallable, args []any) (*VM, *Literal, error) {
+	values := make([]*Literal, len(args))
+	declaration, typed := fun.(FunctionDeclaration)
 
-	if err != nil {
-		return err
+	for idx, val := range args {
+		lit, err := LiteralFromGo(val)
+
+		if err != nil {
+			return nil, nil, errors.Join(errors.New("got error while converting from go value to parts"), err)
+		}
+
+		resolvedExpr, err := vm.simplifyLiteral(lit, true)
+
+		if err != nil {
+			return nil, nil, errors.Join(errors.New("got error while converting from go value to parts"), err)
+		}
+
+		if typed && idx < len(declaration.ParamTypes) {
+			if err := declaration.ParamTypes[idx].Check(resolvedExpr); err != nil {
+				return nil, nil, errors.Join(fmt.Errorf("invalid argument %d ('%s')", idx+1, declaration.Params[idx]), err)
+			}
+		}
+
+		values[idx] = resolvedExpr
 	}
 
-	err = vm.Run()
+	callVM, res, err := vm.callFunctionVM(fun, values)
 
 	if err != nil {
-		return err
+		return nil, nil, errors.Join(errors.New("got error while calling function in parts"), err)
 	}
 
-	ReadFromParts(vm, out)
+	if typed && !declaration.Generator {
+		if err := declaration.ReturnType.Check(res); err != nil {
+			return nil, nil, errors.Join(errors.New("invalid return value"), err)
+		}
+	}
 
-	return nil
+	return callVM, res, nil
 }
 
 func ReadFromParts[T any](vm *VM, out *T) {
@@ -242,7 +427,7 @@ func FillField[T any](fieldIdx int, vm *VM, out *T) {
 		fieldValue.Set(reflect.ValueOf(val.(string)).Convert(field.Type))
 	case reflect.Slice:
 		if rawVal.LiteralType == ParsedListLiteral {
-			FillSlice(fieldIdx, val.([]any), vm, out)
+			FillSlice(fieldIdx, rawVal.Value.(PartsIndexable), vm, out)
 		} else {
 			panic(errors.New("trying to assign element as list"))
 		}
@@ -251,6 +436,12 @@ func FillField[T any](fieldIdx int, vm *VM, out *T) {
 			panic(errors.New("wrong variable type"))
 		}
 
+		//Go struct handed to the script, copied back as it is
+		if ffi, ok := rawVal.Value.(*FFIStruct); ok && ffi.Value.Type() == field.Type {
+			fieldValue.Set(ffi.Value)
+			return
+		}
+
 		FillStruct(val.(map[string]any), vm, fieldValue.Addr().Interface())
 	case reflect.Func:
 		fieldValue.Set(reflect.ValueOf(val))
@@ -323,7 +514,7 @@ func FillStruct[T any](data map[string]any, vm *VM, out T) {
 				fieldValue.Set(reflect.ValueOf(val.(string)).Convert(field.Type))
 			case reflect.Slice:
 				if val, ok := val.([]any); ok {
-					FillSlice(i, val, vm, out)
+					fillSlice(fieldValue, val, vm)
 				} else {
 					panic(errors.New("trying to assign element as list"))
 				}
@@ -370,31 +561,52 @@ func FillStruct[T any](data map[string]any, vm *VM, out T) {
 	}
 }
 
-func FillSlice[T any](fieldIdx int, data []any, vm *VM, out T) {
+// FillSlice fills the slice field from Parts list, elements are read the same way Unmarshal reads them
+func FillSlice[T any](fieldIdx int, list PartsIndexable, vm *VM, out T) {
 	fieldValue := reflect.ValueOf(out).Elem().Field(fieldIdx)
+	values := listValues(list)
+	data := make([]any, len(values))
 
-	if fieldValue.Kind() == reflect.Slice && fieldValue.Type().Elem().Kind() == reflect.Struct {
-		newSlice := reflect.MakeSlice(fieldValue.Type(), 0, len(data))
+	for idx, value := range values {
+		val, err := value.ToGoTypes(vm)
 
-		for i := range data {
-			newStruct := reflect.New(fieldValue.Type().Elem()).Elem()
-
-			if val, ok := data[i].(map[string]any); ok {
-				FillStruct(val, vm, newStruct.Addr().Interface())
-			} else {
-				panic(errors.New("wrong variable type"))
-			}
-
-			newSlice = reflect.Append(newSlice, newStruct)
+		if err != nil {
+			panic(err)
 		}
 
-		return
+		data[idx] = val
 	}
 
+	fillSlice(fieldValue, data, vm)
+}
+
+// fillSlice sets the slice to converted values, structs are filled from objects
+func fillSlice(fieldValue reflect.Value, data []any, vm *VM) {
 	newSlice := reflect.MakeSlice(fieldValue.Type(), 0, len(data))
 
 	for i := range data {
-		newSlice = reflect.Append(newSlice, reflect.ValueOf(data[i]).Convert(fieldValue.Type().Elem()))
+		if fieldValue.Type().Elem().Kind() != reflect.Struct {
+			newSlice = reflect.Append(newSlice, reflect.ValueOf(data[i]).Convert(fieldValue.Type().Elem()))
+
+			continue
+		}
+
+		//Go struct handed to the script, copied back as it is
+		if raw := reflect.ValueOf(data[i]); raw.IsValid() && raw.Type() == fieldValue.Type().Elem() {
+			newSlice = reflect.Append(newSlice, raw)
+
+			continue
+		}
+
+		newStruct := reflect.New(fieldValue.Type().Elem()).Elem()
+
+		if val, ok := data[i].(map[string]any); ok {
+			FillStruct(val, vm, newStruct.Addr().Interface())
+		} else {
+			panic(errors.New("wrong variable type"))
+		}
+
+		newSlice = reflect.Append(newSlice, newStruct)
 	}
 
 	fieldValue.Set(newSlice)
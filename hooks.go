@@ -0,0 +1,103 @@
+package parts
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Hooks observe what the VM does, they are called on the VM goroutine before
+// it continues. When VM.Hooks is nil the VM only pays for the nil check, embed
+// BaseHooks to implement just some of the methods.
+type Hooks interface {
+	//Before running instruction at idx of the current code (function body or the program)
+	OnInstruction(op Bytecode, idx int)
+	//Before calling function, args are already evaluated
+	OnCall(fn PartsCallable, args []*Literal)
+	//After function returned, tail calls return nil from the caller before calling the next function
+	OnReturn(value *Literal)
+	OnScopeEnter()
+	OnScopeExit()
+	//Value is the Result error the function returns with
+	OnRaise(value *Literal)
+}
+
+// BaseHooks does nothing
+type BaseHooks struct{}
+
+func (BaseHooks) OnInstruction(op Bytecode, idx int)       {}
+func (BaseHooks) OnCall(fn PartsCallable, args []*Literal) {}
+func (BaseHooks) OnReturn(value *Literal)                  {}
+func (BaseHooks) OnScopeEnter()                            {}
+func (BaseHooks) OnScopeExit()                             {}
+func (BaseHooks) OnRaise(value *Literal)                   {}
+
+var opcodeNames = []string{
+	"B_DECLARE", "B_SET", "B_LITERAL", "B_RETURN", "B_RAISE", "B_NEW_SCOPE", "B_END_SCOPE", "B_DOT",
+	"B_CALL", "B_RESOLVE", "B_COND_JUMP", "B_BIN_OP", "B_LOOP", "B_CONTINUE", "B_BREAK", "B_OPT_DOT",
+	"B_COALESCE", "B_YIELD", "B_TYPE_HINT", "B_JUMP", "B_JUMP_REV", "B_LOAD_LOCAL", "B_STORE_LOCAL",
+	"B_DECLARE_LOCAL", "B_LINE", "B_END_LOOP", "B_OPT_CHAIN",
+}
+
+// OpcodeName returns name of the instruction as used in docs/bytecode.md
+func OpcodeName(op Bytecode) string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
+	}
+
+	return fmt.Sprintf("B_UNKNOWN(%d)", op)
+}
+
+// Tracer writes every hook as a line, indented by calls and scopes
+type Tracer struct {
+	Out io.Writer
+
+	//Skip OnInstruction, only calls, scopes and raises are written
+	SkipInstructions bool
+
+	depth int
+}
+
+func NewTracer(out io.Writer) *Tracer {
+	return &Tracer{Out: out}
+}
+
+func (t *Tracer) OnInstruction(op Bytecode, idx int) {
+	if !t.SkipInstructions {
+		t.write("%s @%d", OpcodeName(op), idx)
+	}
+}
+
+func (t *Tracer) OnCall(fn PartsCallable, args []*Literal) {
+	values := make([]string, len(args))
+
+	for idx, arg := range args {
+		values[idx] = DebugValue(arg)
+	}
+
+	t.write("call %s with (%s)", DebugValue(&Literal{FunLiteral, fn}), strings.Join(values, ", "))
+	t.depth++
+}
+
+func (t *Tracer) OnReturn(value *Literal) {
+	t.depth = max(t.depth-1, 0)
+	t.write("return %s", DebugValue(value))
+}
+
+func (t *Tracer) OnScopeEnter() {
+	t.write("scope {")
+	t.depth++
+}
+
+func (t *Tracer) OnScopeExit() {
+	t.depth = max(t.depth-1, 0)
+	t.write("}")
+}
+
+func (t *Tracer) OnRaise(value *Literal) {
+	t.write("raise %s", DebugValue(value))
+}
+
+func (t *Tracer) write(format string, args ...any) {
+	fmt.Fprintf(t.Out, "%s%s\n", strings.Repeat("  ", t.depth), fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,171 @@
+package parts
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// PartsList is the value of ParsedListLiteral, elements are kept in order in
+// a slice. Keys are hashed ints ("IT0", "IT1", ...) like everywhere else.
+type PartsList struct {
+	Values []*Literal
+}
+
+func NewPartsList(values ...*Literal) *PartsList {
+	return &PartsList{Values: values}
+}
+
+// listValues returns elements of the list in order, lists not backed by
+// PartsList are read key by key
+func listValues(list PartsIndexable) []*Literal {
+	if list, ok := list.(*PartsList); ok {
+		return list.Values
+	}
+
+	values := make([]*Literal, list.Length())
+
+	for idx := range values {
+		values[idx] = list.GetByKey(fmt.Sprintf("IT%d", idx))
+	}
+
+	return values
+}
+
+func (l *PartsList) Get(key *Literal) *Literal {
+	if key.LiteralType == IntLiteral {
+		return l.At(key.Value.(int))
+	}
+
+	hash, err := HashLiteral(*key)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return l.GetByKey(hash)
+}
+
+func (l *PartsList) Set(key *Literal, value *Literal) *Literal {
+	hash, err := HashLiteral(*key)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return l.SetByKey(hash, value)
+}
+
+func (l *PartsList) Has(key *Literal) bool {
+	if key.LiteralType == IntLiteral {
+		return key.Value.(int) >= 0 && key.Value.(int) < len(l.Values)
+	}
+
+	hash, err := HashLiteral(*key)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return l.HasByKey(hash)
+}
+
+func (l *PartsList) GetByKey(key string) *Literal {
+	idx, ok := listIndex(key)
+
+	if !ok {
+		return nil
+	}
+
+	return l.At(idx)
+}
+
+// SetByKey replaces the element, setting past the end appends and fills the gap with nil
+func (l *PartsList) SetByKey(key string, value *Literal) *Literal {
+	idx, ok := listIndex(key)
+
+	if !ok {
+		panic(fmt.Errorf("invalid list index '%s'", key))
+	}
+
+	for len(l.Values) < idx {
+		l.Values = append(l.Values, &Literal{NilLiteral, nil})
+	}
+
+	if idx == len(l.Values) {
+		l.Values = append(l.Values, value)
+	} else {
+		l.Values[idx] = value
+	}
+
+	return value
+}
+
+func (l *PartsList) HasByKey(key string) bool {
+	idx, ok := listIndex(key)
+
+	return ok && idx < len(l.Values)
+}
+
+func (l *PartsList) GetAll() map[string]*Literal {
+	entries := make(map[string]*Literal, len(l.Values))
+
+	for idx, value := range l.Values {
+		entries[fmt.Sprintf("IT%d", idx)] = value
+	}
+
+	return entries
+}
+
+func (l *PartsList) Keys() []string {
+	keys := make([]string, len(l.Values))
+
+	for idx := range l.Values {
+		keys[idx] = fmt.Sprintf("IT%d", idx)
+	}
+
+	return keys
+}
+
+func (l *PartsList) Length() int {
+	return len(l.Values)
+}
+
+func (l *PartsList) TypeHash() string {
+	return ""
+}
+
+// At returns the element, nil when index is out of range
+func (l *PartsList) At(idx int) *Literal {
+	if idx < 0 || idx >= len(l.Values) {
+		return nil
+	}
+
+	return l.Values[idx]
+}
+
+func (l *PartsList) Append(values ...*Literal) {
+	l.Values = append(l.Values, values...)
+}
+
+// Slice returns a new list with elements from start up to end, same as the Go slice expression
+func (l *PartsList) Slice(start, end int) (*PartsList, error) {
+	if start < 0 || end > len(l.Values) || start > end {
+		return nil, fmt.Errorf("slice bounds out of range [%d:%d] with length %d", start, end, len(l.Values))
+	}
+
+	return NewPartsList(append([]*Literal{}, l.Values[start:end]...)...), nil
+}
+
+func listIndex(key string) (int, bool) {
+	if len(key) < 3 || key[:2] != "IT" {
+		return 0, false
+	}
+
+	idx, err := strconv.Atoi(key[2:])
+
+	if err != nil || idx < 0 {
+		return 0, false
+	}
+
+	return idx, true
+}
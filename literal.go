@@ -1,9 +1,12 @@
 package parts
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -22,6 +25,8 @@ const (
 	ListLiteral
 	ParsedListLiteral
 	PointerLiteral
+	NilLiteral
+	TypeHintLiteral
 )
 
 type Literal struct {
@@ -39,7 +44,7 @@ func (l *Literal) ToGoTypes(vm *VM) (any, error) {
 	case IntLiteral:
 		return l.Value.(int), nil
 	case DoubleLiteral:
-		return l.Value.(float32), nil
+		return l.Value.(float64), nil
 	case BoolLiteral:
 		return l.Value.(bool), nil
 	case StringLiteral:
@@ -63,31 +68,13 @@ func (l *Literal) ToGoTypes(vm *VM) (any, error) {
 		funcObj := l.Value.(PartsCallable)
 
 		val := func(args ...any) (any, error) {
-			values := make([]*Literal, len(args))
-
-			for idx, val := range args {
-				lit, err := LiteralFromGo(val)
-
-				if err != nil {
-					return nil, errors.Join(errors.New("got error while converting from go value to parts"), err)
-				}
-
-				resolvedExpr, err := capturedVM.simplifyLiteral(lit, true)
-
-				if err != nil {
-					return nil, errors.Join(errors.New("got error while converting from go value to parts"), err)
-				}
-
-				values[idx] = resolvedExpr
-			}
-
-			tempVM, res, err := capturedVM.callFunctionVM(funcObj, values)
+			tempVM, res, err := capturedVM.callFromGo(funcObj, args)
 
 			if err != nil {
-				return nil, errors.Join(errors.New("got error while calling function in parts"), err)
+				return nil, err
 			}
 
-			if res == nil {
+			if res != nil {
 				gofied, err := res.ToGoTypes(tempVM)
 
 				if err != nil {
@@ -123,6 +110,10 @@ func (l *Literal) ToGoTypes(vm *VM) (any, error) {
 		return entryMap, nil
 
 	case ParsedObjLiteral:
+		if ffi, ok := l.Value.(*FFIStruct); ok {
+			return ffi.Interface(), nil
+		}
+
 		entryMap := make(map[string]any)
 
 		for key, entry := range l.Value.(PartsIndexable).GetAll() {
@@ -145,11 +136,10 @@ func (l *Literal) ToGoTypes(vm *VM) (any, error) {
 
 		return temp.ToGoTypes(vm)
 	case ParsedListLiteral:
-		entriesList := make([]any, len(l.Value.(PartsIndexable).GetAll()))
-
-		for i := range len(l.Value.(PartsIndexable).GetAll()) {
-			entry := l.Value.(PartsIndexable).GetByKey(fmt.Sprintf("IT%d", i))
+		values := listValues(l.Value.(PartsIndexable))
+		entriesList := make([]any, len(values))
 
+		for i, entry := range values {
 			val, err := entry.ToGoTypes(vm)
 
 			if err != nil {
@@ -162,6 +152,8 @@ func (l *Literal) ToGoTypes(vm *VM) (any, error) {
 		return entriesList, nil
 	case PointerLiteral:
 		return l.Value, nil
+	case NilLiteral:
+		return nil, nil
 	}
 
 	return nil, errors.New("invalid type to convert")
@@ -232,7 +224,11 @@ func (l *Literal) opAdd(other *Literal) (*Literal, error) {
 			return nil, fmt.Errorf("operation not supported - add (string, %d)", other.LiteralType)
 		}
 	case ListLiteral, ParsedListLiteral:
-		l.Value.(PartsIndexable).SetByKey(fmt.Sprintf("IT%d", l.Value.(PartsIndexable).Length()), other)
+		if list, ok := l.Value.(*PartsList); ok {
+			list.Append(other)
+		} else {
+			l.Value.(PartsIndexable).SetByKey(fmt.Sprintf("IT%d", l.Value.(PartsIndexable).Length()), other)
+		}
 
 		return l, nil
 	case FunLiteral, ObjLiteral, ParsedObjLiteral:
@@ -386,6 +382,17 @@ func (l *Literal) opDiv(other *Literal) (*Literal, error) {
 }
 
 func (l *Literal) opEq(other *Literal) (*Literal, error) {
+	return l.equal(other, map[eqPair]bool{})
+}
+
+// eqPair is a pair of objects (or lists) being compared, seeing it again means both sides contain a cycle
+type eqPair struct {
+	left, right any
+}
+
+// equal is opEq with the pairs of objects and lists that are being compared, they're assumed to be equal
+// while their entries are checked
+func (l *Literal) equal(other *Literal, comparing map[eqPair]bool) (*Literal, error) {
 	if l.LiteralType != other.LiteralType {
 		return &Literal{BoolLiteral, false}, nil
 	}
@@ -403,15 +410,91 @@ func (l *Literal) opEq(other *Literal) (*Literal, error) {
 		return &Literal{BoolLiteral, l.Value.(bool) == other.Value.(bool)}, nil
 	case StringLiteral:
 		return &Literal{BoolLiteral, l.Value.(string) == other.Value.(string)}, nil
-	case ObjLiteral, ParsedObjLiteral:
+	case NilLiteral:
+		return &Literal{BoolLiteral, true}, nil
+	case ParsedObjLiteral, ParsedListLiteral:
+		left, right := l.Value.(PartsIndexable), other.Value.(PartsIndexable)
+
+		leftId, lok := identity(left)
+		rightId, rok := identity(right)
+
+		if lok && rok {
+			if leftId == rightId {
+				return &Literal{BoolLiteral, true}, nil
+			}
+
+			pair := eqPair{leftId, rightId}
+
+			if comparing[pair] {
+				return &Literal{BoolLiteral, true}, nil
+			}
+
+			comparing[pair] = true
+
+			defer delete(comparing, pair)
+		}
+
+		if l.LiteralType == ParsedObjLiteral {
+			return objEq(left, right, comparing)
+		}
+
+		return listEq(left, right, comparing)
+	case ObjLiteral:
 		return nil, errors.New("object check not implemented")
-	case ListLiteral, ParsedListLiteral:
+	case ListLiteral:
 		return nil, errors.New("list check not implemented")
 	default:
 		return nil, errors.New("equality cannot be checked")
 	}
 }
 
+// objEq compares entries of both objects, order they were set in doesn't matter
+func objEq(left, right PartsIndexable, comparing map[eqPair]bool) (*Literal, error) {
+	if left.TypeHash() != right.TypeHash() || left.Length() != right.Length() {
+		return &Literal{BoolLiteral, false}, nil
+	}
+
+	for key := range left.GetAll() {
+		if !right.HasByKey(key) {
+			return &Literal{BoolLiteral, false}, nil
+		}
+
+		eq, err := left.GetByKey(key).equal(right.GetByKey(key), comparing)
+
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("got error while comparing key %s", key), err)
+		}
+
+		if !eq.Value.(bool) {
+			return eq, nil
+		}
+	}
+
+	return &Literal{BoolLiteral, true}, nil
+}
+
+func listEq(leftList, rightList PartsIndexable, comparing map[eqPair]bool) (*Literal, error) {
+	left, right := listValues(leftList), listValues(rightList)
+
+	if len(left) != len(right) {
+		return &Literal{BoolLiteral, false}, nil
+	}
+
+	for idx := range left {
+		eq, err := left[idx].equal(right[idx], comparing)
+
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("got error while comparing element %d", idx), err)
+		}
+
+		if !eq.Value.(bool) {
+			return eq, nil
+		}
+	}
+
+	return &Literal{BoolLiteral, true}, nil
+}
+
 func (l *Literal) opGt(other *Literal) (*Literal, error) {
 	if l.LiteralType != other.LiteralType {
 		return &Literal{BoolLiteral, false}, nil
@@ -466,15 +549,188 @@ func (l *Literal) opLt(other *Literal) (*Literal, error) {
 	}
 }
 
+// opGtEq is `>=` as the parser spells it out, `(l > other) + (l == other)`
+func (l *Literal) opGtEq(other *Literal) (*Literal, error) {
+	return l.orEq(other, l.opGt)
+}
+
+// opLtEq is `<=` as the parser spells it out, `(l < other) + (l == other)`
+func (l *Literal) opLtEq(other *Literal) (*Literal, error) {
+	return l.orEq(other, l.opLt)
+}
+
+func (l *Literal) orEq(other *Literal, cmp func(*Literal) (*Literal, error)) (*Literal, error) {
+	ord, err := cmp(other)
+
+	if err != nil {
+		return nil, err
+	}
+
+	eq, err := l.opEq(other)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ord.opAdd(eq)
+}
+
 func (l *Literal) opMod(other *Literal) (*Literal, error) {
 	if l.LiteralType == IntLiteral && other.LiteralType == l.LiteralType {
+		if other.Value.(int) == 0 {
+			return nil, errors.New("dividing by zero")
+		}
+
 		return &Literal{IntLiteral, l.Value.(int) % other.Value.(int)}, nil
 	} else {
 		return nil, fmt.Errorf("operation not supported - mod (dbl|bool|str|ref|fun|obj|ptr, %d)", other.LiteralType)
 	}
 }
 
+func (l *Literal) opBitAnd(other *Literal) (*Literal, error) {
+	if l.LiteralType == BoolLiteral && other.LiteralType == BoolLiteral {
+		return &Literal{BoolLiteral, l.Value.(bool) && other.Value.(bool)}, nil
+	}
+
+	if l.LiteralType == IntLiteral && other.LiteralType == IntLiteral {
+		return &Literal{IntLiteral, l.Value.(int) & other.Value.(int)}, nil
+	}
+
+	return nil, fmt.Errorf("operation not supported - bitwise and (%d, %d), expected two ints or two bools", l.LiteralType, other.LiteralType)
+}
+
+func (l *Literal) opBitOr(other *Literal) (*Literal, error) {
+	if l.LiteralType == BoolLiteral && other.LiteralType == BoolLiteral {
+		return &Literal{BoolLiteral, l.Value.(bool) || other.Value.(bool)}, nil
+	}
+
+	if l.LiteralType == IntLiteral && other.LiteralType == IntLiteral {
+		return &Literal{IntLiteral, l.Value.(int) | other.Value.(int)}, nil
+	}
+
+	return nil, fmt.Errorf("operation not supported - bitwise or (%d, %d), expected two ints or two bools", l.LiteralType, other.LiteralType)
+}
+
+func (l *Literal) opBitXor(other *Literal) (*Literal, error) {
+	if l.LiteralType == BoolLiteral && other.LiteralType == BoolLiteral {
+		return &Literal{BoolLiteral, l.Value.(bool) != other.Value.(bool)}, nil
+	}
+
+	if l.LiteralType == IntLiteral && other.LiteralType == IntLiteral {
+		return &Literal{IntLiteral, l.Value.(int) ^ other.Value.(int)}, nil
+	}
+
+	return nil, fmt.Errorf("operation not supported - bitwise xor (%d, %d), expected two ints or two bools", l.LiteralType, other.LiteralType)
+}
+
+func (l *Literal) opShiftLeft(other *Literal) (*Literal, error) {
+	if l.LiteralType != IntLiteral || other.LiteralType != IntLiteral {
+		return nil, fmt.Errorf("operation not supported - shift left (%d, %d), expected two ints", l.LiteralType, other.LiteralType)
+	}
+
+	if other.Value.(int) < 0 {
+		return nil, fmt.Errorf("negative shift count (%d)", other.Value.(int))
+	}
+
+	return &Literal{IntLiteral, l.Value.(int) << other.Value.(int)}, nil
+}
+
+func (l *Literal) opShiftRight(other *Literal) (*Literal, error) {
+	if l.LiteralType != IntLiteral || other.LiteralType != IntLiteral {
+		return nil, fmt.Errorf("operation not supported - shift right (%d, %d), expected two ints", l.LiteralType, other.LiteralType)
+	}
+
+	if other.Value.(int) < 0 {
+		return nil, fmt.Errorf("negative shift count (%d)", other.Value.(int))
+	}
+
+	return &Literal{IntLiteral, l.Value.(int) >> other.Value.(int)}, nil
+}
+
+func (l *Literal) opPow(other *Literal) (*Literal, error) {
+	if l.LiteralType == IntLiteral && other.LiteralType == IntLiteral && other.Value.(int) >= 0 {
+		base, exp, result := l.Value.(int), other.Value.(int), 1
+
+		for exp > 0 {
+			if exp&1 == 1 {
+				result *= base
+			}
+
+			base *= base
+			exp >>= 1
+		}
+
+		return &Literal{IntLiteral, result}, nil
+	}
+
+	lhs, lok := l.asFloat()
+	rhs, rok := other.asFloat()
+
+	if !lok || !rok {
+		return nil, fmt.Errorf("operation not supported - power (%d, %d), expected numbers", l.LiteralType, other.LiteralType)
+	}
+
+	return &Literal{DoubleLiteral, math.Pow(lhs, rhs)}, nil
+}
+
+func (l *Literal) opFloorDiv(other *Literal) (*Literal, error) {
+	if l.LiteralType == IntLiteral && other.LiteralType == IntLiteral {
+		lhs, rhs := l.Value.(int), other.Value.(int)
+
+		if rhs == 0 {
+			return nil, errors.New("dividing by zero")
+		}
+
+		quotient := lhs / rhs
+
+		if (lhs%rhs != 0) && ((lhs < 0) != (rhs < 0)) {
+			quotient--
+		}
+
+		return &Literal{IntLiteral, quotient}, nil
+	}
+
+	lhs, lok := l.asFloat()
+	rhs, rok := other.asFloat()
+
+	if !lok || !rok {
+		return nil, fmt.Errorf("operation not supported - floor div (%d, %d), expected numbers", l.LiteralType, other.LiteralType)
+	}
+
+	if rhs == 0 {
+		return nil, errors.New("dividing by zero")
+	}
+
+	return &Literal{DoubleLiteral, math.Floor(lhs / rhs)}, nil
+}
+
+func (l *Literal) asFloat() (float64, bool) {
+	switch l.LiteralType {
+	case IntLiteral:
+		return float64(l.Value.(int)), true
+	case DoubleLiteral:
+		return l.Value.(float64), true
+	}
+
+	return 0, false
+}
+
 func (l *Literal) pretify() string {
+	return l.pretifyWith(nil)
+}
+
+// pretifyWith calls `__str` of objects when there's VM to run it
+func (l *Literal) pretifyWith(vm *VM) string {
+	return l.pretifyPath(vm, map[any]bool{})
+}
+
+// pretifyPath is pretifyWith that knows objects and lists it's printing,
+// one that contains itself (like Go struct pointing to itself) is shown as <cycle>
+func (l *Literal) pretifyPath(vm *VM, path map[any]bool) string {
+	if l == nil {
+		return "nil"
+	}
+
 	switch l.LiteralType {
 	case IntLiteral:
 		return fmt.Sprintf("%d", l.Value.(int))
@@ -485,18 +741,48 @@ func (l *Literal) pretify() string {
 	case StringLiteral:
 		return l.Value.(string)
 	case ParsedObjLiteral:
+		if fun, ok := metamethod(l, "__str"); ok && vm != nil {
+			return vm.metaString(fun, l)
+		}
+
 		var parts []string
 
-		for key, value := range l.Value.(PartsIndexable).GetAll() {
-			parts = append(parts, fmt.Sprintf("%q: %s", key, value.pretify()))
+		obj := l.Value.(PartsIndexable)
+
+		id, tracked := identity(obj)
+
+		if tracked {
+			if path[id] {
+				return "<cycle>"
+			}
+
+			path[id] = true
+			defer delete(path, id)
+		}
+
+		for _, key := range orderedKeys(obj) {
+			parts = append(parts, fmt.Sprintf("%q: %s", key, obj.GetByKey(key).pretifyPath(vm, path)))
 		}
 
 		return "|>" + strings.Join(parts, ", ") + "<|"
 	case ParsedListLiteral:
 		var parts []string
 
-		for _, value := range l.Value.(PartsIndexable).GetAll() {
-			parts = append(parts, value.pretify())
+		list := l.Value.(PartsIndexable)
+
+		id, tracked := identity(list)
+
+		if tracked {
+			if path[id] {
+				return "<cycle>"
+			}
+
+			path[id] = true
+			defer delete(path, id)
+		}
+
+		for _, value := range listValues(list) {
+			parts = append(parts, value.pretifyPath(vm, path))
 		}
 
 		return "[" + strings.Join(parts, ", ") + "]"
@@ -504,15 +790,50 @@ func (l *Literal) pretify() string {
 		return fmt.Sprintf("<ref to '%s'>", l.Value)
 	case FunLiteral:
 		funcObj := l.Value.(PartsCallable)
-		return fmt.Sprintf("func(%s)", strings.Join(funcObj.GetArguments(), ","))
+		args := funcObj.GetArguments()
+
+		if variadic, ok := funcObj.(VariadicCallable); ok {
+			if name, ok := variadic.Variadic(); ok {
+				args = append(args, "..."+name)
+			}
+		}
+
+		return fmt.Sprintf("func(%s)", strings.Join(args, ","))
 	case PointerLiteral:
 		return fmt.Sprintf("<pointer>")
+	case NilLiteral:
+		return "nil"
+	case TypeHintLiteral:
+		return l.Value.(TypeHint).String()
 	default:
 		panic(fmt.Errorf("Cant pretify that (%d)", l.LiteralType))
 	}
 }
 
+type ffiIdentity struct {
+	Address uintptr
+	Type    reflect.Type
+}
+
+// identity returns value telling objects apart, Go structs are the same object
+// when they are at the same address (their FFIStruct is made on every access)
+func identity(obj PartsIndexable) (any, bool) {
+	if ffi, ok := obj.(*FFIStruct); ok {
+		return ffiIdentity{ffi.Value.Addr().Pointer(), ffi.Value.Type()}, true
+	}
+
+	if !reflect.TypeOf(obj).Comparable() {
+		return nil, false
+	}
+
+	return obj, true
+}
+
 func LiteralFromGo(value any) (*Literal, error) {
+	if value == nil {
+		return &Literal{NilLiteral, nil}, nil
+	}
+
 	typeOf := reflect.TypeOf(value)
 
 	switch typeOf.Kind() {
@@ -525,11 +846,11 @@ func LiteralFromGo(value any) (*Literal, error) {
 		v := reflect.ValueOf(value)
 		return &Literal{IntLiteral, int(v.Uint())}, nil
 	case reflect.Float32, reflect.Float64:
-		return &Literal{DoubleLiteral, value.(float64)}, nil
+		return &Literal{DoubleLiteral, reflect.ValueOf(value).Float()}, nil
 	case reflect.String:
 		return &Literal{StringLiteral, value}, nil
 	case reflect.Func:
-		return &Literal{FunLiteral, FFIFunction{value}}, nil
+		return &Literal{FunLiteral, FFIFunction{Function: value}}, nil
 	case reflect.Array, reflect.Slice:
 
 		reflectVal := reflect.ValueOf(value)
@@ -544,100 +865,283 @@ func LiteralFromGo(value any) (*Literal, error) {
 	case reflect.Map:
 		return &Literal{ParsedObjLiteral, NewFFIMap(value)}, nil
 	case reflect.Pointer:
+		if reflect.ValueOf(value).IsNil() {
+			return &Literal{NilLiteral, nil}, nil
+		}
+
+		if isFFIStruct(typeOf.Elem()) {
+			return &Literal{ParsedObjLiteral, NewFFIStruct(value)}, nil
+		}
+
 		return &Literal{PointerLiteral, value}, nil
 	case reflect.Struct:
+		if isFFIStruct(typeOf) {
+			return &Literal{ParsedObjLiteral, NewFFIStruct(value)}, nil
+		}
+
 		return &Literal{PointerLiteral, value}, nil
 	}
 
 	return nil, errors.New("value type not supported for conversion")
 }
 
+// FFIFunction calls Go function with arguments converted from Parts. Leading
+// *VM and context.Context parameters are passed by the VM, `...T` takes the
+// rest of the arguments and `any` or *Literal parameters get Parts values as
+// they are.
 type FFIFunction struct {
 	Function any
 }
 
+// NamedFFIFunction is FFIFunction with names of the arguments (variadic one last),
+// they are used in errors and pretify instead of val_N
+type NamedFFIFunction struct {
+	FFIFunction
+
+	Names []string
+}
+
+// NewFFIFunction checks that the function can be called from Parts and that there's a name for every argument
+func NewFFIFunction(function any, names ...string) (NamedFFIFunction, error) {
+	ffi := NamedFFIFunction{FFIFunction{function}, names}
+
+	funcType := reflect.TypeOf(function)
+
+	if funcType == nil || funcType.Kind() != reflect.Func {
+		return NamedFFIFunction{}, fmt.Errorf("expected function got %T", function)
+	}
+
+	if len(names) == 0 {
+		return ffi, nil
+	}
+
+	if count := funcType.NumIn() - ffiInjected(funcType); len(names) != count {
+		return NamedFFIFunction{}, fmt.Errorf("got %d argument names for function with %d arguments", len(names), count)
+	}
+
+	for idx, name := range names {
+		if name == "" || slices.Contains(names[:idx], name) {
+			return NamedFFIFunction{}, fmt.Errorf("argument names should be unique and not empty, got '%s'", name)
+		}
+	}
+
+	return ffi, nil
+}
+
+func (ffi NamedFFIFunction) Call(vm *VM) error {
+	return ffi.run(vm, ffi.Names)
+}
+
+func (ffi NamedFFIFunction) GetArguments() []string {
+	return ffi.arguments(ffi.Names)
+}
+
+func (ffi NamedFFIFunction) Variadic() (string, bool) {
+	return ffi.variadic(ffi.Names)
+}
+
 func (ffi FFIFunction) Call(vm *VM) error {
+	return ffi.run(vm, nil)
+}
+
+// run calls the function and sets its result as the return value, names are the argument names
+func (ffi FFIFunction) run(vm *VM, names []string) error {
+	funcOut, err := ffi.call(vm, names)
+
+	if err != nil {
+		return err
+	}
+
+	if len(funcOut) == 0 {
+		vm.ReturnValue = &Literal{NilLiteral, nil}
+		vm.ExitCode = ReturnCode
+		vm.EarlyExit = true
+
+		return nil
+	}
+
+	if len(funcOut) == 2 {
+		if err, ok := funcOut[1].Interface().(error); ok && err != nil {
+			vm.ReturnValue = NewResultError(&Literal{StringLiteral, err.Error()})
+			vm.ExitCode = ReturnCode
+			vm.EarlyExit = true
+
+			return nil
+		}
+	}
+
+	resConverted, err := LiteralFromGo(funcOut[0].Interface())
+
+	if err != nil {
+		return err
+	}
+
+	vm.ReturnValue = resConverted
+	vm.ExitCode = ReturnCode
+	vm.EarlyExit = true
+
+	return nil
+}
+
+// call converts arguments from the enviroment and calls the Go function
+func (ffi FFIFunction) call(vm *VM, names []string) ([]reflect.Value, error) {
 	funcVal := reflect.ValueOf(ffi.Function)
 	funcType := funcVal.Type()
 
 	if funcType.Kind() != reflect.Func {
-		return errors.New("Not a function in FFIFunction (GetArguments)")
+		return nil, errors.New("Not a function in FFIFunction (GetArguments)")
 	}
 
 	switch funcType.NumOut() {
 	case 0:
 	case 1:
 	case 2:
-		errorType := reflect.TypeOf((*error)(nil)).Elem()
 		if funcType.Out(1) != errorType {
-			return errors.New("Function with two return values must have error as the second type")
+			return nil, errors.New("Function with two return values must have error as the second type")
 		}
 	default:
-		return errors.New("Function should return one, two (with error), or zero values")
+		return nil, errors.New("Function should return one, two (with error), or zero values")
 	}
 
-	args := ffi.GetArguments()
-	values := make([]reflect.Value, len(args))
+	injected := ffiInjected(funcType)
+	args := ffi.arguments(names)
+	values := make([]reflect.Value, 0, funcType.NumIn())
+
+	for idx := range injected {
+		if funcType.In(idx) == vmType {
+			values = append(values, reflect.ValueOf(vm))
+		} else {
+			values = append(values, reflect.ValueOf(vm.context()))
+		}
+	}
 
 	for idx, key := range args {
 		val, err := vm.Enviroment.resolve(fmt.Sprintf("RT%s", key))
 
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		converted, err := val.ToGoTypes(vm)
+		converted, err := ffi.argument(vm, val, funcType.In(injected+idx), idx, names)
 
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		reflectNew := reflect.New(funcType.In(idx)).Elem()
+		values = append(values, converted)
+	}
 
-		reflectNew.Set(reflect.ValueOf(converted))
+	if name, ok := ffi.variadic(names); ok {
+		rest, err := vm.Enviroment.resolve(fmt.Sprintf("RT%s", name))
 
-		values[idx] = reflectNew
-	}
+		if err != nil {
+			return nil, err
+		}
 
-	funcOut := funcVal.Call(values)
+		elemType := funcType.In(funcType.NumIn() - 1).Elem()
 
-	if len(funcOut) == 0 {
-		vm.ReturnValue = &Literal{ParsedObjLiteral, &PartsSpecialObject{
-			Internal: &PartsObject{},
-			Hash:     "Option.None",
-		}}
+		for idx, val := range listValues(rest.Value.(PartsIndexable)) {
+			converted, err := ffi.argument(vm, val, elemType, len(args)+idx, names)
 
-		return nil
+			if err != nil {
+				return nil, err
+			}
+
+			values = append(values, converted)
+		}
 	}
 
-	if len(funcOut) == 2 {
-		if err, ok := funcOut[1].Interface().(error); ok && err != nil {
-			vm.ReturnValue = &Literal{ParsedObjLiteral, &PartsSpecialObject{
-				Internal: &PartsObject{Entries: map[string]*Literal{"RTValue": {LiteralType: StringLiteral, Value: err.Error()}}},
-				Hash:     "Result.Error",
-			}}
+	return funcVal.Call(values), nil
+}
 
-			vm.ExitCode = ReturnCode
-			vm.EarlyExit = true
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
 
-			return nil
-		}
+// FFIMethod is exported Go method bound to it's receiver, called as `value.Method(args)`.
+// Methods returning error always return Result, Ok holds the other value (or nil).
+type FFIMethod struct {
+	FFIFunction
+
+	Name string
+}
+
+func (ffi FFIMethod) Call(vm *VM) error {
+	funcType := reflect.TypeOf(ffi.Function)
+
+	if funcType.NumOut() == 0 || funcType.Out(funcType.NumOut()-1) != errorType {
+		return ffi.FFIFunction.Call(vm)
 	}
 
-	resConverted, err := LiteralFromGo(funcOut[0].Interface())
+	funcOut, err := ffi.call(vm, nil)
 
 	if err != nil {
 		return err
 	}
 
-	vm.ReturnValue = resConverted
 	vm.ExitCode = ReturnCode
 	vm.EarlyExit = true
 
+	if err, ok := funcOut[len(funcOut)-1].Interface().(error); ok && err != nil {
+		vm.ReturnValue = NewResultError(&Literal{StringLiteral, err.Error()})
+
+		return nil
+	}
+
+	value := &Literal{NilLiteral, nil}
+
+	if len(funcOut) == 2 {
+		if value, err = LiteralFromGo(funcOut[0].Interface()); err != nil {
+			return err
+		}
+	}
+
+	vm.ReturnValue = NewResultOK(value)
+
 	return nil
 }
 
+// ffiMethod looks up exported method of the value, pointer receivers are used
+// when the value is addressable. Key is hashed name (with the RT prefix).
+func ffiMethod(value reflect.Value, key string) (*Literal, bool) {
+	if !value.IsValid() || len(key) < 3 || key[0:2] != "RT" {
+		return nil, false
+	}
+
+	name := key[2:]
+	method := value.MethodByName(name)
+
+	if !method.IsValid() && value.CanAddr() {
+		method = value.Addr().MethodByName(name)
+	}
+
+	if !method.IsValid() {
+		return nil, false
+	}
+
+	return &Literal{FunLiteral, FFIMethod{FFIFunction{Function: method.Interface()}, name}}, true
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
 func (ffi FFIFunction) GetArguments() []string {
+	return ffi.arguments(nil)
+}
+
+// Variadic returns name the rest of the arguments are declared under
+func (ffi FFIFunction) Variadic() (string, bool) {
+	return ffi.variadic(nil)
+}
+
+// arguments returns names the arguments are declared under, val_N for the ones without name
+func (ffi FFIFunction) arguments(names []string) []string {
 	funcVal := reflect.ValueOf(ffi.Function)
 	funcType := funcVal.Type()
 
@@ -645,18 +1149,104 @@ func (ffi FFIFunction) GetArguments() []string {
 		panic("Not a function in FFIFunction (GetArguments)")
 	}
 
-	numIn := funcType.NumIn()
+	numIn := funcType.NumIn() - ffiInjected(funcType)
+
+	if funcType.IsVariadic() {
+		numIn--
+	}
+
 	args := make([]string, numIn)
 
 	for i := range numIn {
-		args[i] = fmt.Sprintf("val_%d", i)
+		args[i] = argumentName(names, i)
 	}
 
 	return args
 }
 
-func ConvertListToParts(list []any) *PartsObject {
-	values := PartsObject{Entries: make(map[string]*Literal)}
+func (ffi FFIFunction) variadic(names []string) (string, bool) {
+	funcType := reflect.TypeOf(ffi.Function)
+
+	if !funcType.IsVariadic() {
+		return "", false
+	}
+
+	return argumentName(names, funcType.NumIn()-ffiInjected(funcType)-1), true
+}
+
+func argumentName(names []string, idx int) string {
+	if idx < len(names) {
+		return names[idx]
+	}
+
+	return fmt.Sprintf("val_%d", idx)
+}
+
+var (
+	vmType      = reflect.TypeOf((*VM)(nil))
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	literalType = reflect.TypeOf((*Literal)(nil))
+)
+
+// ffiInjected counts leading *VM and context.Context parameters
+func ffiInjected(funcType reflect.Type) int {
+	count := 0
+
+	for count < funcType.NumIn() && (funcType.In(count) == vmType || funcType.In(count) == contextType) {
+		count++
+	}
+
+	return count
+}
+
+// argument converts value for parameter of the type, idx is counted from the first Parts argument
+func (ffi FFIFunction) argument(vm *VM, val *Literal, target reflect.Type, idx int, names []string) (reflect.Value, error) {
+	reflectNew := reflect.New(target).Elem()
+
+	//Raw values, the function decides what to do with them
+	if target == literalType || (target.Kind() == reflect.Interface && target.NumMethod() == 0) {
+		//*Literal given to the script by Go comes back as it is
+		if raw, ok := val.Value.(*Literal); ok && val.LiteralType == PointerLiteral && target == literalType {
+			val = raw
+		}
+
+		reflectNew.Set(reflect.ValueOf(val))
+
+		return reflectNew, nil
+	}
+
+	name := strconv.Itoa(idx + 1)
+
+	if len(names) > 0 {
+		name = "'" + argumentName(names, idx) + "'"
+	}
+
+	converted, err := val.ToGoTypes(vm)
+
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	if converted != nil {
+		convertedVal := reflect.ValueOf(converted)
+
+		switch {
+		case convertedVal.Type().AssignableTo(reflectNew.Type()):
+			reflectNew.Set(convertedVal)
+		case isNumberKind(convertedVal.Kind()) && isNumberKind(reflectNew.Kind()):
+			reflectNew.Set(convertedVal.Convert(reflectNew.Type()))
+		default:
+			return reflect.Value{}, fmt.Errorf("invalid argument %s, expected %s (%s) got %s", name, TypeHintFromGo(reflectNew.Type()), reflectNew.Type(), TypeHintOf(val))
+		}
+	} else if !slices.Contains([]reflect.Kind{reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func}, reflectNew.Kind()) {
+		return reflect.Value{}, fmt.Errorf("invalid argument %s, expected %s (%s) got Nil", name, TypeHintFromGo(reflectNew.Type()), reflectNew.Type())
+	}
+
+	return reflectNew, nil
+}
+
+func ConvertListToParts(list []any) *PartsList {
+	values := make([]*Literal, len(list))
 
 	for idx, val := range list {
 		converted, err := LiteralFromGo(val)
@@ -665,10 +1255,10 @@ func ConvertListToParts(list []any) *PartsObject {
 			panic(err)
 		}
 
-		values.SetByKey(fmt.Sprintf("IT%d", idx), converted)
+		values[idx] = converted
 	}
 
-	return &values
+	return NewPartsList(values...)
 }
 
 type FFIMap struct {
@@ -742,6 +1332,19 @@ func (ffi *FFIMap) GetAll() map[string]*Literal {
 	return temp
 }
 
+// Keys returns keys sorted, Go maps don't keep any order
+func (ffi *FFIMap) Keys() []string {
+	keys := make([]string, 0, ffi.Entries.Len())
+
+	for key := range ffi.GetAll() {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
 func (ffi *FFIMap) GetByKey(key string) *Literal {
 	val := returnExpected(key)
 
@@ -802,6 +1405,8 @@ func returnExpected(key string) any {
 		return key[2:]
 	case "RT":
 		return key[2:]
+	case "NT":
+		return nil
 	default:
 		panic("Invalid hash")
 	}
@@ -822,9 +1427,15 @@ func HashLiteral(literal Literal) (string, error) {
 	case StringLiteral:
 		return fmt.Sprintf("ST%s", literal.Value.(string)), nil
 	case RefLiteral:
+		if name, ok := literal.Value.(string); ok {
+			return "RT" + name, nil
+		}
+
 		return fmt.Sprintf("RT%s", literal.Value), nil
 	case PointerLiteral:
 		return fmt.Sprintf("PT%s", reflect.ValueOf(literal.Value).Type().String()), nil
+	case NilLiteral:
+		return "NT", nil
 	}
 
 	return "", fmt.Errorf("literal not hashable %d", literal.LiteralType)
@@ -833,3 +1444,211 @@ func HashLiteral(literal Literal) (string, error) {
 func NewFFIMap(val any) *FFIMap {
 	return &FFIMap{reflect.ValueOf(val)}
 }
+
+// FFIStruct exposes exported fields of Go struct as object entries, names
+// follow `parts` tags ("-" hides the field). Struct behind a pointer is edited
+// in place, struct passed by value is copied first so only the copy changes.
+// Exported methods (of the pointer too) can be called but aren't entries.
+type FFIStruct struct {
+	//Addressable struct value
+	Value reflect.Value
+
+	//Pointer the struct came from, returned back to Go instead of a copy
+	Pointer reflect.Value
+
+	fields []ffiField
+}
+
+type ffiField struct {
+	Name  string
+	Index []int
+}
+
+func NewFFIStruct(val any) *FFIStruct {
+	reflectVal := reflect.ValueOf(val)
+
+	if reflectVal.Kind() == reflect.Pointer {
+		return newFFIStruct(reflectVal.Elem(), reflectVal)
+	}
+
+	copied := reflect.New(reflectVal.Type()).Elem()
+	copied.Set(reflectVal)
+
+	return newFFIStruct(copied, reflect.Value{})
+}
+
+func newFFIStruct(value, pointer reflect.Value) *FFIStruct {
+	ffi := &FFIStruct{Value: value, Pointer: pointer}
+
+	for _, field := range reflect.VisibleFields(value.Type()) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+
+		name := field.Name
+
+		if tag, has := field.Tag.Lookup("parts"); has {
+			if tagName, _ := parseTag(tag); tagName == "-" {
+				continue
+			} else if tagName != "" {
+				name = tagName
+			}
+		}
+
+		ffi.fields = append(ffi.fields, ffiField{Name: name, Index: field.Index})
+	}
+
+	return ffi
+}
+
+// isFFIStruct tells if values of the type are shown as objects, Literal itself is passed through untouched
+func isFFIStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != reflect.TypeOf(Literal{})
+}
+
+// Interface returns the Go value, pointer when the struct came from one
+func (ffi *FFIStruct) Interface() any {
+	if ffi.Pointer.IsValid() {
+		return ffi.Pointer.Interface()
+	}
+
+	return ffi.Value.Interface()
+}
+
+func (ffi *FFIStruct) field(key string) (reflect.Value, bool) {
+	if len(key) < 2 || (key[0:2] != "RT" && key[0:2] != "ST") {
+		return reflect.Value{}, false
+	}
+
+	for _, field := range ffi.fields {
+		if field.Name == key[2:] {
+			//Embedded nil pointer
+			value, err := ffi.Value.FieldByIndexErr(field.Index)
+
+			return value, err == nil
+		}
+	}
+
+	return reflect.Value{}, false
+}
+
+func (ffi *FFIStruct) Get(key *Literal) *Literal {
+	hash, err := HashLiteral(*key)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return ffi.GetByKey(hash)
+}
+
+func (ffi *FFIStruct) Set(key *Literal, value *Literal) *Literal {
+	hash, err := HashLiteral(*key)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return ffi.SetByKey(hash, value)
+}
+
+func (ffi *FFIStruct) Has(key *Literal) bool {
+	hash, err := HashLiteral(*key)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return ffi.HasByKey(hash)
+}
+
+func (ffi *FFIStruct) Length() int {
+	return len(ffi.fields)
+}
+
+func (ffi *FFIStruct) GetAll() map[string]*Literal {
+	temp := make(map[string]*Literal, len(ffi.fields))
+
+	for _, key := range ffi.Keys() {
+		temp[key] = ffi.GetByKey(key)
+	}
+
+	return temp
+}
+
+// Keys returns fields in the order they are declared
+func (ffi *FFIStruct) Keys() []string {
+	keys := make([]string, 0, len(ffi.fields))
+
+	for _, field := range ffi.fields {
+		if _, ok := ffi.field("RT" + field.Name); ok {
+			keys = append(keys, "RT"+field.Name)
+		}
+	}
+
+	return keys
+}
+
+func (ffi *FFIStruct) GetByKey(key string) *Literal {
+	value, ok := ffi.field(key)
+
+	if !ok {
+		method, _ := ffiMethod(ffi.Value, key)
+
+		return method
+	}
+
+	//Nested structs are edited in place as well
+	if isFFIStruct(value.Type()) {
+		return &Literal{ParsedObjLiteral, newFFIStruct(value, value.Addr())}
+	}
+
+	lit, err := LiteralFromGo(value.Interface())
+
+	if err != nil {
+		panic(err)
+	}
+
+	return lit
+}
+
+func (ffi *FFIStruct) SetByKey(key string, value *Literal) *Literal {
+	if err := ffi.assign(&VM{Enviroment: &VMEnviroment{}}, key, value); err != nil {
+		panic(err)
+	}
+
+	return value
+}
+
+// assign decodes the value into the field the same way Unmarshal does, so
+// lists, objects and structs can be set as well
+func (ffi *FFIStruct) assign(vm *VM, key string, value *Literal) error {
+	field, ok := ffi.field(key)
+
+	if !ok {
+		return fmt.Errorf("no field %s", key[2:])
+	}
+
+	d := decoder{vm: vm}
+
+	if err := d.decode(key[2:], value, field); err != nil {
+		return errors.Join(fmt.Errorf("can't set field %s (%s)", key[2:], field.Type()), err)
+	}
+
+	return nil
+}
+
+// HasByKey is true for fields and methods, methods aren't listed in Keys
+func (ffi *FFIStruct) HasByKey(key string) bool {
+	if _, ok := ffi.field(key); ok {
+		return true
+	}
+
+	_, ok := ffiMethod(ffi.Value, key)
+
+	return ok
+}
+
+func (ffi *FFIStruct) TypeHash() string {
+	return ""
+}
@@ -0,0 +1,463 @@
+package parts
+
+import (
+	"bytes"
+	"cmp"
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PartsMarshaler is implemented by types that write themselves as Parts expression
+type PartsMarshaler interface {
+	MarshalParts() ([]byte, error)
+}
+
+// MarshalError points to the value that couldn't be written, Path is like "loot.items[2].name"
+type MarshalError struct {
+	Path string
+	Err  error
+}
+
+func (e *MarshalError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+func (e *MarshalError) Unwrap() error {
+	return e.Err
+}
+
+type MarshalOptions struct {
+	//Used once per nesting level, objects and arrays are written in single line when it's empty
+	Indent string
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*PartsMarshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Marshal writes struct (or map with string keys) as `let` declarations that
+// Unmarshal reads back, it uses the same `parts` tags (omitempty skips empty
+// values) and tabs for indentation.
+func Marshal(v any) ([]byte, error) {
+	return MarshalWithOptions(v, MarshalOptions{Indent: "\t"})
+}
+
+func MarshalWithOptions(v any, options MarshalOptions) ([]byte, error) {
+	e := encoder{options: options, seen: map[marshalVisit]bool{}}
+
+	value := reflect.ValueOf(v)
+
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+
+	entries, err := e.entries("", value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !isIdentifier(entry.name) {
+			return nil, &MarshalError{Path: entry.name, Err: fmt.Errorf("'%s' can't be used as variable name", entry.name)}
+		}
+
+		e.b.WriteString("let " + entry.name + " = ")
+
+		if err := e.value(entry.name, entry.value, 0); err != nil {
+			return nil, err
+		}
+
+		e.b.WriteByte('\n')
+	}
+
+	return e.b.Bytes(), nil
+}
+
+type encoder struct {
+	options MarshalOptions
+	b       bytes.Buffer
+	//Pointers, maps and slices that are being written, seeing one again means there's a cycle
+	seen map[marshalVisit]bool
+}
+
+// marshalVisit identifies pointer, map or slice, slices of different length (or type) sharing memory aren't the same value
+type marshalVisit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+type marshalEntry struct {
+	name  string
+	value reflect.Value
+}
+
+// entries lists fields of struct (in order) or map entries (sorted by key)
+func (e *encoder) entries(path string, value reflect.Value) ([]marshalEntry, error) {
+	switch value.Kind() {
+	case reflect.Struct:
+		return e.fields(value), nil
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			break
+		}
+
+		entries := make([]marshalEntry, 0, value.Len())
+
+		for _, key := range value.MapKeys() {
+			entries = append(entries, marshalEntry{key.String(), value.MapIndex(key)})
+		}
+
+		slices.SortFunc(entries, func(a, b marshalEntry) int { return strings.Compare(a.name, b.name) })
+
+		return entries, nil
+	}
+
+	if !value.IsValid() {
+		return nil, &MarshalError{Path: path, Err: fmt.Errorf("expected struct or map got nil")}
+	}
+
+	return nil, &MarshalError{Path: path, Err: fmt.Errorf("expected struct or map with string keys got %s", value.Type())}
+}
+
+func (e *encoder) fields(value reflect.Value) []marshalEntry {
+	entries := make([]marshalEntry, 0, value.NumField())
+
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		options := tagOptions("")
+
+		if tag, has := field.Tag.Lookup("parts"); has {
+			var tagName string
+
+			tagName, options = parseTag(tag)
+
+			if tagName == "-" {
+				continue
+			} else if tagName != "" {
+				name = tagName
+			}
+		}
+
+		fieldValue := value.Field(i)
+
+		//Embedded struct without a name has it's fields next to the others
+		if field.Anonymous && name == field.Name && field.Type.Kind() == reflect.Struct {
+			entries = append(entries, e.fields(fieldValue)...)
+
+			continue
+		}
+
+		if options.Contains("omitempty") && isEmptyValue(fieldValue) {
+			continue
+		}
+
+		entries = append(entries, marshalEntry{name, fieldValue})
+	}
+
+	return entries
+}
+
+func (e *encoder) value(path string, value reflect.Value, depth int) error {
+	if !value.IsValid() {
+		e.b.WriteString("nil")
+
+		return nil
+	}
+
+	if value.Type().Implements(marshalerType) && (value.Kind() != reflect.Pointer || !value.IsNil()) {
+		text, err := value.Interface().(PartsMarshaler).MarshalParts()
+
+		if err != nil {
+			return &MarshalError{Path: path, Err: err}
+		}
+
+		e.b.Write(text)
+
+		return nil
+	}
+
+	if value.Type() == durationType {
+		return e.text(path, value.Interface().(time.Duration).String())
+	}
+
+	if value.Type().Implements(textMarshalerType) && (value.Kind() != reflect.Pointer || !value.IsNil()) {
+		text, err := value.Interface().(encoding.TextMarshaler).MarshalText()
+
+		if err != nil {
+			return &MarshalError{Path: path, Err: err}
+		}
+
+		return e.text(path, string(text))
+	}
+
+	if kind := value.Kind(); (kind == reflect.Pointer || kind == reflect.Map || kind == reflect.Slice) && !value.IsNil() {
+		visit := marshalVisit{value.Pointer(), value.Type(), 0}
+
+		if kind == reflect.Slice {
+			visit.len = value.Len()
+		}
+
+		if e.seen[visit] {
+			return &MarshalError{Path: path, Err: fmt.Errorf("encountered a cycle via %s", value.Type())}
+		}
+
+		e.seen[visit] = true
+
+		defer delete(e.seen, visit)
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			e.b.WriteString("nil")
+
+			return nil
+		}
+
+		return e.value(path, value.Elem(), depth)
+	case reflect.Bool:
+		e.b.WriteString(strconv.FormatBool(value.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value.Uint() > math.MaxInt64 {
+			return &MarshalError{Path: path, Err: fmt.Errorf("%d overflows Int", value.Uint())}
+		}
+
+		e.int(int64(value.Uint()))
+	case reflect.Float32, reflect.Float64:
+		//There are no Double literals, Unmarshal accepts Int for floats
+		f := value.Float()
+
+		if f != math.Trunc(f) || math.Abs(f) > math.MaxInt64 {
+			return &MarshalError{Path: path, Err: fmt.Errorf("%v can't be written, only whole numbers are supported", f)}
+		}
+
+		e.int(int64(f))
+	case reflect.String:
+		return e.text(path, value.String())
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			e.b.WriteString("nil")
+
+			return nil
+		}
+
+		return e.list(path, value, depth)
+	case reflect.Map:
+		if value.IsNil() {
+			e.b.WriteString("nil")
+
+			return nil
+		}
+
+		keys := value.MapKeys()
+
+		switch value.Type().Key().Kind() {
+		case reflect.String:
+			slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			slices.SortFunc(keys, func(a, b reflect.Value) int { return cmp.Compare(a.Int(), b.Int()) })
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			slices.SortFunc(keys, func(a, b reflect.Value) int { return cmp.Compare(a.Uint(), b.Uint()) })
+		default:
+			return &MarshalError{Path: path, Err: fmt.Errorf("map keys should be strings or numbers got %s", value.Type().Key())}
+		}
+
+		entries := make([]marshalEntry, len(keys))
+
+		for idx, key := range keys {
+			entries[idx] = marshalEntry{fmt.Sprint(key.Interface()), value.MapIndex(key)}
+		}
+
+		return e.object(path, entries, value.Type().Key().Kind() != reflect.String, depth)
+	case reflect.Struct:
+		return e.object(path, e.fields(value), false, depth)
+	default:
+		return &MarshalError{Path: path, Err: fmt.Errorf("%s is not supported", value.Type())}
+	}
+
+	return nil
+}
+
+func (e *encoder) list(path string, value reflect.Value, depth int) error {
+	if value.Len() == 0 {
+		e.b.WriteString("[]")
+
+		return nil
+	}
+
+	e.b.WriteByte('[')
+
+	for idx := range value.Len() {
+		if idx > 0 {
+			e.b.WriteByte(',')
+
+			if e.options.Indent == "" {
+				e.b.WriteByte(' ')
+			}
+		}
+
+		e.newline(depth + 1)
+
+		if err := e.value(fmt.Sprintf("%s[%d]", path, idx), value.Index(idx), depth+1); err != nil {
+			return err
+		}
+	}
+
+	e.newline(depth)
+	e.b.WriteByte(']')
+
+	return nil
+}
+
+// object writes entries as `|> key: value <|`, numeric keys are written as they are
+func (e *encoder) object(path string, entries []marshalEntry, numeric bool, depth int) error {
+	if len(entries) == 0 {
+		e.b.WriteString("|><|")
+
+		return nil
+	}
+
+	e.b.WriteString("|>")
+
+	if e.options.Indent == "" {
+		e.b.WriteByte(' ')
+	}
+
+	for idx, entry := range entries {
+		if idx > 0 {
+			e.b.WriteByte(',')
+
+			if e.options.Indent == "" {
+				e.b.WriteByte(' ')
+			}
+		}
+
+		e.newline(depth + 1)
+
+		if numeric && strings.HasPrefix(entry.name, "-") {
+			return &MarshalError{Path: path, Err: fmt.Errorf("negative key %s can't be written", entry.name)}
+		}
+
+		if numeric || isIdentifier(entry.name) {
+			e.b.WriteString(entry.name)
+		} else if err := e.text(path, entry.name); err != nil {
+			return err
+		}
+
+		e.b.WriteString(": ")
+
+		entryPath := fmt.Sprintf("%s[%s]", path, entry.name)
+
+		if !numeric && isIdentifier(entry.name) {
+			entryPath = path + "." + entry.name
+		}
+
+		if err := e.value(entryPath, entry.value, depth+1); err != nil {
+			return err
+		}
+	}
+
+	if e.options.Indent == "" {
+		e.b.WriteByte(' ')
+	}
+
+	e.newline(depth)
+	e.b.WriteString("<|")
+
+	return nil
+}
+
+func (e *encoder) newline(depth int) {
+	if e.options.Indent == "" {
+		return
+	}
+
+	e.b.WriteByte('\n')
+	e.b.WriteString(strings.Repeat(e.options.Indent, depth))
+}
+
+// int writes negative numbers as subtraction, there's no unary minus
+func (e *encoder) int(n int64) {
+	if n < 0 {
+		e.b.WriteString("0 - " + strconv.FormatUint(uint64(-n), 10))
+
+		return
+	}
+
+	e.b.WriteString(strconv.FormatInt(n, 10))
+}
+
+var stringEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\t", "\\t", "\r", "\\r", "\b", "\\b", "\f", "\\f")
+
+// text quotes the string, backticks are used when it contains '"' (it can't be escaped)
+func (e *encoder) text(path string, text string) error {
+	quote := "\""
+
+	if strings.Contains(text, quote) {
+		quote = "`"
+
+		if strings.Contains(text, quote) {
+			return &MarshalError{Path: path, Err: fmt.Errorf("string can't contain both '\"' and '`'")}
+		}
+	}
+
+	e.b.WriteString(quote + stringEscaper.Replace(text) + quote)
+
+	return nil
+}
+
+// isIdentifier tells if the name can be written without quotes
+func isIdentifier(name string) bool {
+	if name == "" || isKeyword(name) {
+		return false
+	}
+
+	for _, r := range name {
+		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isKeyword(name string) bool {
+	for _, rule := range GetScannerRules() {
+		if rule.Id == "Keyword" {
+			_, has := rule.Mappings[name]
+
+			return has
+		}
+	}
+
+	return false
+}
+
+// isEmptyValue is what omitempty skips, same as in encoding/json
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return value.IsNil()
+	}
+
+	return value.IsZero()
+}
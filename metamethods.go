@@ -0,0 +1,224 @@
+package parts
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Metamethods are functions objects keep under keys like `__add`, the VM calls
+// them before failing on a value it can't handle. Both operands are passed to
+// the operator ones (left first), so `a + b` is `__add(a, b)`.
+var opMetamethods = map[Bytecode]string{
+	B_OP_ADD:       "__add",
+	B_OP_MIN:       "__sub",
+	B_OP_MUL:       "__mul",
+	B_OP_DIV:       "__div",
+	B_OP_MOD:       "__mod",
+	B_OP_POW:       "__pow",
+	B_OP_FLOOR_DIV: "__idiv",
+	B_OP_BIT_AND:   "__band",
+	B_OP_BIT_OR:    "__bor",
+	B_OP_BIT_XOR:   "__bxor",
+	B_OP_SHL:       "__shl",
+	B_OP_SHR:       "__shr",
+}
+
+// Limit for `__index` objects pointing to other objects
+const maxIndexDepth = 100
+
+// metamethod returns function stored under the name, host PartsIndexable values can provide them too
+func metamethod(value *Literal, name string) (PartsCallable, bool) {
+	if value == nil || value.LiteralType != ParsedObjLiteral {
+		return nil, false
+	}
+
+	obj := value.Value.(PartsIndexable)
+
+	if !obj.HasByKey("RT" + name) {
+		return nil, false
+	}
+
+	fun := obj.GetByKey("RT" + name)
+
+	if fun == nil || fun.LiteralType != FunLiteral {
+		return nil, false
+	}
+
+	return fun.Value.(PartsCallable), true
+}
+
+// findMetamethod checks the operands in order
+func findMetamethod(name string, operands ...*Literal) (PartsCallable, bool) {
+	for _, operand := range operands {
+		if fun, ok := metamethod(operand, name); ok {
+			return fun, true
+		}
+	}
+
+	return nil, false
+}
+
+func (vm *VM) callMetamethod(name string, fun PartsCallable, args ...*Literal) (*Literal, error) {
+	vm.callee = name
+
+	result, err := vm.callFunction(fun, args)
+
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("got error while calling %s", name), err)
+	}
+
+	if result == nil {
+		return &Literal{NilLiteral, nil}, nil
+	}
+
+	return result, nil
+}
+
+// runMetaOp runs operation through metamethods, false means applyOp should handle it
+func (vm *VM) runMetaOp(opcode Bytecode, left, right *Literal) (*Literal, bool, error) {
+	if left.LiteralType != ParsedObjLiteral && right.LiteralType != ParsedObjLiteral {
+		return nil, false, nil
+	}
+
+	switch opcode {
+	case B_OP_EQ:
+		return vm.metaEq(left, right)
+	case B_OP_LT:
+		return vm.metaCompare("__lt", left, right)
+	case B_OP_GT:
+		return vm.metaCompare("__lt", right, left)
+	case B_OP_LT_EQ:
+		return vm.metaLessEq(left, right)
+	case B_OP_GT_EQ:
+		return vm.metaLessEq(right, left)
+	}
+
+	name, ok := opMetamethods[opcode]
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	//String and object with `__str` are joined like two strings, even if the object has `__add`
+	if opcode == B_OP_ADD && (left.LiteralType == StringLiteral || right.LiteralType == StringLiteral) {
+		if _, ok := findMetamethod("__str", left, right); ok {
+			return &Literal{StringLiteral, left.pretifyWith(vm) + right.pretifyWith(vm)}, true, nil
+		}
+	}
+
+	if fun, ok := findMetamethod(name, left, right); ok {
+		result, err := vm.callMetamethod(name, fun, left, right)
+
+		return result, true, err
+	}
+
+	return nil, false, nil
+}
+
+// metaEq uses `__eq` only when both values are objects, others are never equal to an object
+func (vm *VM) metaEq(left, right *Literal) (*Literal, bool, error) {
+	if left.LiteralType != ParsedObjLiteral || right.LiteralType != ParsedObjLiteral {
+		return nil, false, nil
+	}
+
+	return vm.metaCompare("__eq", left, right)
+}
+
+func (vm *VM) metaCompare(name string, left, right *Literal) (*Literal, bool, error) {
+	fun, ok := findMetamethod(name, left, right)
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	result, err := vm.callMetamethod(name, fun, left, right)
+
+	if err != nil {
+		return nil, true, err
+	}
+
+	if result.LiteralType != BoolLiteral {
+		return nil, true, fmt.Errorf("expected %s to return Bool got %s", name, TypeHintOf(result))
+	}
+
+	return result, true, nil
+}
+
+// metaLessEq uses `__le` or `__lt` with `__eq` (structural equality without it)
+func (vm *VM) metaLessEq(left, right *Literal) (*Literal, bool, error) {
+	if result, ok, err := vm.metaCompare("__le", left, right); ok {
+		return result, ok, err
+	}
+
+	less, ok, err := vm.metaCompare("__lt", left, right)
+
+	if !ok || err != nil || less.Value.(bool) {
+		return less, ok, err
+	}
+
+	if equal, ok, err := vm.metaEq(left, right); ok {
+		return equal, true, err
+	}
+
+	equal, err := left.opEq(right)
+
+	return equal, true, err
+}
+
+// metaIndex looks up missing key through `__index`, function is called with the object and the key
+func (vm *VM) metaIndex(object *Literal, key string) (*Literal, bool, error) {
+	for range maxIndexDepth {
+		obj, ok := object.Value.(PartsIndexable)
+
+		if !ok || object.LiteralType != ParsedObjLiteral || !obj.HasByKey("RT__index") {
+			return nil, false, nil
+		}
+
+		index := obj.GetByKey("RT__index")
+
+		switch index.LiteralType {
+		case FunLiteral:
+			result, err := vm.callMetamethod("__index", index.Value.(PartsCallable), object, keyLiteral(key))
+
+			return result, true, err
+		case ParsedObjLiteral:
+			if fallback := index.Value.(PartsIndexable); fallback.HasByKey(key) {
+				return fallback.GetByKey(key), true, nil
+			}
+
+			object = index
+		default:
+			return nil, false, nil
+		}
+	}
+
+	return nil, false, fmt.Errorf("__index chain is longer than %d objects", maxIndexDepth)
+}
+
+// callable returns function to call for the value, objects with `__call` get themselves as the first argument
+func callable(value *Literal) (PartsCallable, *Literal, error) {
+	if value.LiteralType == FunLiteral {
+		return value.Value.(PartsCallable), nil, nil
+	}
+
+	if fun, ok := metamethod(value, "__call"); ok {
+		return fun, value, nil
+	}
+
+	return nil, nil, fmt.Errorf("expected function value got %d (%s)", value.LiteralType, value.pretify())
+}
+
+// metaString calls `__str`, errors are written in place of the value
+func (vm *VM) metaString(fun PartsCallable, value *Literal) string {
+	result, err := vm.callMetamethod("__str", fun, value)
+
+	if err != nil {
+		return fmt.Sprintf("<error in __str: %s>", err)
+	}
+
+	if result.LiteralType == StringLiteral {
+		return result.Value.(string)
+	}
+
+	return result.pretify()
+}
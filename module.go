@@ -0,0 +1,144 @@
+package parts
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Module is group of functions and constants scripts load with `import module "name"`.
+// It's object is built (and Init called) the first time any VM imports it and
+// then shared, so register modules once and not per script.
+type Module struct {
+	Name string
+
+	//Go functions are called through FFIFunction, PartsCallable values (like NativeMethod or FFIFunction with Names) are used as they are
+	Functions map[string]any
+	//Converted with LiteralFromGo, *Literal is used as it is
+	Constants map[string]any
+
+	//Called before the object is built, error fails every import of the module
+	Init func() error
+
+	once   sync.Once
+	object *Literal
+	err    error
+}
+
+var (
+	modulesLock sync.RWMutex
+	modules     = map[string]*Module{
+		ArrayModule.Name:  ArrayModule,
+		StringModule.Name: StringModule,
+		OptionModule.Name: OptionModule,
+		ResultModule.Name: ResultModule,
+	}
+)
+
+// RegisterModule makes the module importable by every VM
+func RegisterModule(module *Module) error {
+	modulesLock.Lock()
+	defer modulesLock.Unlock()
+
+	return addModule(modules, module)
+}
+
+// RegisterModule makes the module importable only by this VM (and functions it calls),
+// it's used instead of globally registered module with the same name
+func (vm *VM) RegisterModule(module *Module) error {
+	if vm.Modules == nil {
+		vm.Modules = make(map[string]*Module)
+	}
+
+	return addModule(vm.Modules, module)
+}
+
+func addModule(registry map[string]*Module, module *Module) error {
+	if module.Name == "" {
+		return errors.New("module without a name")
+	}
+
+	if _, ok := registry[module.Name]; ok {
+		return fmt.Errorf("module '%s' is already registered", module.Name)
+	}
+
+	registry[module.Name] = module
+
+	return nil
+}
+
+// importModule returns object of the module, VM modules are checked first
+func (vm *VM) importModule(name string) (*Literal, error) {
+	module, ok := vm.Modules[name]
+
+	if !ok {
+		modulesLock.RLock()
+		module, ok = modules[name]
+		modulesLock.RUnlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown module '%s'", name)
+	}
+
+	return module.load()
+}
+
+func (m *Module) load() (*Literal, error) {
+	m.once.Do(func() {
+		if m.Init != nil {
+			if err := m.Init(); err != nil {
+				m.err = errors.Join(fmt.Errorf("got error while initializing module '%s'", m.Name), err)
+				return
+			}
+		}
+
+		entries := make(map[string]*Literal, len(m.Functions)+len(m.Constants))
+
+		for name, value := range m.Constants {
+			if literal, ok := value.(*Literal); ok {
+				entries["RT"+name] = literal
+				continue
+			}
+
+			literal, err := LiteralFromGo(value)
+
+			if err != nil {
+				m.err = errors.Join(fmt.Errorf("got error while converting constant %s.%s", m.Name, name), err)
+				return
+			}
+
+			entries["RT"+name] = literal
+		}
+
+		for name, value := range m.Functions {
+			switch fun := value.(type) {
+			case PartsCallable:
+				entries["RT"+name] = &Literal{FunLiteral, fun}
+			default:
+				if value == nil || reflect.TypeOf(value).Kind() != reflect.Func {
+					m.err = fmt.Errorf("%s.%s is not a function", m.Name, name)
+					return
+				}
+
+				entries["RT"+name] = &Literal{FunLiteral, FFIFunction{Function: value}}
+			}
+		}
+
+		m.object = &Literal{ParsedObjLiteral, &PartsObject{Entries: entries}}
+	})
+
+	return m.object, m.err
+}
+
+// mustLoad is load for the built in modules, they can't fail
+func (m *Module) mustLoad() *Literal {
+	object, err := m.load()
+
+	if err != nil {
+		panic(err)
+	}
+
+	return object
+}
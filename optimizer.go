@@ -0,0 +1,716 @@
+package parts
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Optimizer rewrites parsed code before it's resolved. Operations on constants
+// are folded into literals, branches with constant conditions are replaced by
+// the branch that runs, empty scopes are dropped and operands duplicated by
+// `>=` and `<=` are evaluated once. That's the only deduplication done, other
+// repeated subexpressions are still evaluated every time. Last statement of
+// every block is left as it is (apart from folding), its value is what the
+// block evaluates to.
+type Optimizer struct {
+	Literals []*Literal
+
+	//Index of constants in Literals by literalKey, first `indexed` literals are in there
+	literalIdx map[string]int
+	indexed    int
+}
+
+// Optimize returns optimized code and the literal pool with folded values
+// appended, bodies of the functions, lists and objects in literals are replaced
+// as well. Code that can't be optimized is left as it is.
+func Optimize(code []Bytecode, literals []*Literal) ([]Bytecode, []*Literal) {
+	o := Optimizer{Literals: literals}
+
+	for _, literal := range literals {
+		switch value := literal.Value.(type) {
+		case FunctionDeclaration:
+			if body, err := o.block(&checkCursor{Code: value.Body}, len(value.Body)); err == nil {
+				value.Body = body
+				literal.Value = value
+			}
+		case ListDefinition:
+			if entries, err := o.entries(value.Entries, 1); err == nil {
+				literal.Value = ListDefinition{Entries: entries}
+			}
+		case ObjDefinition:
+			if entries, err := o.entries(value.Entries, 2); err == nil {
+				literal.Value = ObjDefinition{Entries: entries}
+			}
+		}
+	}
+
+	optimized, err := o.block(&checkCursor{Code: code}, len(code))
+
+	if err != nil {
+		return code, o.Literals
+	}
+
+	return optimized, o.Literals
+}
+
+// entries optimizes elements of lists (single value) and objects (key and value)
+func (o *Optimizer) entries(entries [][]Bytecode, exprs int) ([][]Bytecode, error) {
+	optimized := make([][]Bytecode, len(entries))
+
+	for idx, entry := range entries {
+		cur := &checkCursor{Code: entry}
+
+		for range exprs {
+			expr, err := o.expr(cur)
+
+			if err != nil {
+				return nil, err
+			}
+
+			optimized[idx] = joinCode(optimized[idx], expr)
+		}
+
+		if cur.Idx != len(entry) {
+			return nil, errUnknownBytecode
+		}
+	}
+
+	return optimized, nil
+}
+
+func (o *Optimizer) block(cur *checkCursor, end int) ([]Bytecode, error) {
+	statements, err := o.statements(cur, end)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return joinCode(statements...), nil
+}
+
+// statements optimizes code up to end, returned statements are never empty
+func (o *Optimizer) statements(cur *checkCursor, end int) ([][]Bytecode, error) {
+	type statement struct {
+		Code []Bytecode
+
+		//What runs instead when the value of the statement isn't used
+		Pruned [][]Bytecode
+		Prunes bool
+	}
+
+	parsed := []statement{}
+
+	for cur.Idx < end {
+		var (
+			stmt statement
+			err  error
+		)
+
+		switch cur.Code[cur.Idx] {
+		case B_COND_JUMP:
+			var condition, then, otherwise [][]Bytecode
+
+			if condition, then, otherwise, err = o.condJump(cur); err == nil {
+				stmt.Code, err = encodeCondJump(joinCode(condition...), joinCode(then...), joinCode(otherwise...))
+
+				if value, ok := o.constant(joinCode(condition...)); ok {
+					if value {
+						stmt.Pruned = then
+					} else {
+						stmt.Pruned = otherwise
+					}
+
+					stmt.Prunes = true
+				}
+			}
+		case B_LOOP:
+			var condition, body []Bytecode
+
+			if condition, body, err = o.loop(cur); err == nil {
+				stmt.Code, err = encodeLoop(condition, body)
+
+				if value, ok := o.constant(condition); ok && !value {
+					stmt.Prunes = true
+				}
+			}
+		default:
+			stmt.Code, err = o.statement(cur)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		parsed = append(parsed, stmt)
+	}
+
+	if cur.Idx != end {
+		return nil, errUnknownBytecode
+	}
+
+	statements := [][]Bytecode{}
+
+	for idx, stmt := range parsed {
+		tail := true
+
+		for _, next := range parsed[idx+1:] {
+			if !isScopeChange(next.Code) {
+				tail = false
+				break
+			}
+		}
+
+		code := [][]Bytecode{stmt.Code}
+
+		if stmt.Prunes && !tail {
+			code = stmt.Pruned
+		}
+
+		for _, part := range code {
+			//Scope that's closed right after it's opened doesn't do anything
+			if len(statements) > 0 && slices.Equal(part, []Bytecode{B_END_SCOPE}) && slices.Equal(statements[len(statements)-1], []Bytecode{B_NEW_SCOPE}) {
+				statements = statements[:len(statements)-1]
+				continue
+			}
+
+			statements = append(statements, part)
+		}
+	}
+
+	return statements, nil
+}
+
+func (o *Optimizer) statement(cur *checkCursor) ([]Bytecode, error) {
+	if cur.Code[cur.Idx] != B_DECLARE {
+		return o.expr(cur)
+	}
+
+	cur.Idx++
+
+	name, err := o.expr(cur)
+
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := o.expr(cur)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return joinCode([]Bytecode{B_DECLARE}, name, value), nil
+}
+
+func (o *Optimizer) expr(cur *checkCursor) ([]Bytecode, error) {
+	if cur.Idx >= len(cur.Code) {
+		return nil, errUnknownBytecode
+	}
+
+	op := cur.Code[cur.Idx]
+
+	switch op {
+	case B_LITERAL:
+		start := cur.Idx
+
+		if _, err := o.readLiteral(cur); err != nil {
+			return nil, err
+		}
+
+		return joinCode(cur.Code[start:cur.Idx]), nil
+	case B_BIN_OP:
+		if cur.Idx+1 >= len(cur.Code) {
+			return nil, errUnknownBytecode
+		}
+
+		binOp := cur.Code[cur.Idx+1]
+
+		cur.Idx += 2
+
+		left, err := o.expr(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := o.expr(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return o.binOp(binOp, left, right), nil
+	case B_DOT:
+		cur.Idx++
+
+		accessor, err := o.expr(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tail, err := o.dotTail(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_DOT}, accessor, tail), nil
+	case B_OPT_DOT, B_COALESCE:
+		cur.Idx++
+
+		left, err := o.expr(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := cur.decodeLen()
+
+		if err != nil {
+			return nil, err
+		}
+
+		end := cur.Idx + length
+
+		if end > len(cur.Code) {
+			return nil, errUnknownBytecode
+		}
+
+		var right []Bytecode
+
+		if op == B_OPT_DOT {
+			right, err = o.dotTail(cur)
+		} else {
+			right, err = o.expr(cur)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if cur.Idx != end {
+			return nil, errUnknownBytecode
+		}
+
+		return joinCode([]Bytecode{op}, left, mustEncodeLen(len(right)), right), nil
+	case B_OPT_CHAIN:
+		cur.Idx++
+
+		length, err := cur.decodeLen()
+
+		if err != nil {
+			return nil, err
+		}
+
+		end := cur.Idx + length
+
+		chain, err := o.expr(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if cur.Idx != end {
+			return nil, errUnknownBytecode
+		}
+
+		return joinCode([]Bytecode{B_OPT_CHAIN}, mustEncodeLen(len(chain)), chain), nil
+	case B_RESOLVE, B_YIELD, B_RAISE, B_RETURN:
+		cur.Idx++
+
+		value, err := o.expr(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{op}, value), nil
+	case B_SET:
+		cur.Idx++
+
+		target, err := o.expr(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := o.expr(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_SET}, target, value), nil
+	case B_CALL:
+		cur.Idx++
+
+		callee, err := o.expr(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		args, err := o.arguments(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_CALL}, callee, args), nil
+	case B_COND_JUMP:
+		//Value of the branch is used here, only its parts are optimized
+		condition, then, otherwise, err := o.condJump(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return encodeCondJump(joinCode(condition...), joinCode(then...), joinCode(otherwise...))
+	case B_LOOP:
+		condition, body, err := o.loop(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return encodeLoop(condition, body)
+	case B_NEW_SCOPE, B_END_SCOPE:
+		cur.Idx++
+
+		return []Bytecode{op}, nil
+	case B_CONTINUE, B_BREAK, B_JUMP, B_JUMP_REV:
+		//Code around can move, break and continue are linked again by encodeLoop
+		return loopJump(cur)
+	case B_LINE:
+		start := cur.Idx
+		cur.Idx++
+
+		if _, err := cur.decodeLen(); err != nil {
+			return nil, err
+		}
+
+		return joinCode(cur.Code[start:cur.Idx]), nil
+	case B_TYPE_HINT:
+		cur.Idx++
+
+		start := cur.Idx
+
+		if _, err := o.readLiteral(cur); err != nil {
+			return nil, err
+		}
+
+		hint := cur.Code[start:cur.Idx]
+
+		value, err := o.expr(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_TYPE_HINT}, hint, value), nil
+	}
+
+	return nil, errUnknownBytecode
+}
+
+// binOp folds operations on constants and merges `(a > b) + (a == b)` (the parser's `>=`) into a single
+// operation, no other repeated subexpressions are merged
+func (o *Optimizer) binOp(op Bytecode, left, right []Bytecode) []Bytecode {
+	if lhs, ok := o.literal(left); ok && isConstant(lhs) {
+		if rhs, ok := o.literal(right); ok && isConstant(rhs) {
+			if value, err := foldOp(op, lhs, rhs); err == nil {
+				return o.appendLiteral(value)
+			}
+		}
+	}
+
+	if op == B_OP_ADD && len(left) > 2 && len(right) > 2 && left[0] == B_BIN_OP && right[0] == B_BIN_OP && right[1] == B_OP_EQ {
+		merged := map[Bytecode]Bytecode{B_OP_GT: B_OP_GT_EQ, B_OP_LT: B_OP_LT_EQ}[left[1]]
+
+		//Operands are evaluated once instead of twice, only done when that can't be noticed
+		if merged != 0 && slices.Equal(left[2:], right[2:]) && o.pure(left[2:], 2) {
+			return joinCode([]Bytecode{B_BIN_OP, merged}, left[2:])
+		}
+	}
+
+	return joinCode([]Bytecode{B_BIN_OP, op}, left, right)
+}
+
+// foldOp applies op at compile time, operations that fail (or panic) are left for the runtime to report
+func foldOp(op Bytecode, lhs, rhs *Literal) (value *Literal, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, fmt.Errorf("folding panicked: %v", r)
+		}
+	}()
+
+	return applyOp(op, lhs, rhs)
+}
+
+// condJump optimizes condition and both branches of B_COND_JUMP
+func (o *Optimizer) condJump(cur *checkCursor) ([][]Bytecode, [][]Bytecode, [][]Bytecode, error) {
+	cur.Idx++
+
+	condition, err := o.expr(cur)
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	branches := [2][][]Bytecode{}
+
+	for idx := range branches {
+		//Else branch is the length of the jump ending then branch
+		if idx == 1 && !cur.skip(B_JUMP) {
+			return nil, nil, nil, errUnknownBytecode
+		}
+
+		length, err := cur.decodeLen()
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if cur.Idx+length > len(cur.Code) {
+			return nil, nil, nil, errUnknownBytecode
+		}
+
+		if branches[idx], err = o.statements(cur, cur.Idx+length); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return [][]Bytecode{condition}, branches[0], branches[1], nil
+}
+
+// loop optimizes condition and body of B_LOOP, reverse jump and B_END_LOOP are left out of the body
+func (o *Optimizer) loop(cur *checkCursor) ([]Bytecode, []Bytecode, error) {
+	start := cur.Idx
+
+	cur.Idx++
+
+	conditionLen, err := cur.decodeLen()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cur.Idx+conditionLen > len(cur.Code) {
+		return nil, nil, errUnknownBytecode
+	}
+
+	condition, err := o.block(cur, cur.Idx+conditionLen)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bodyEnd, loopEnd, err := cur.loopBody(start)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := o.block(cur, bodyEnd)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cur.Idx = loopEnd
+
+	return condition, body, nil
+}
+
+// dotTail optimizes what follows the accessor of B_DOT, assignment, method call or the key
+func (o *Optimizer) dotTail(cur *checkCursor) ([]Bytecode, error) {
+	if cur.Idx >= len(cur.Code) {
+		return nil, errUnknownBytecode
+	}
+
+	switch cur.Code[cur.Idx] {
+	case B_SET:
+		return o.expr(cur)
+	case B_CALL:
+		cur.Idx++
+
+		key, err := o.expr(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		args, err := o.arguments(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_CALL}, key, args), nil
+	}
+
+	return o.expr(cur)
+}
+
+// arguments optimizes argument count followed by the arguments of the call
+func (o *Optimizer) arguments(cur *checkCursor) ([]Bytecode, error) {
+	if cur.Idx >= len(cur.Code) {
+		return nil, errUnknownBytecode
+	}
+
+	count := cur.Code[cur.Idx]
+	code := []Bytecode{count}
+
+	cur.Idx++
+
+	for range count {
+		arg, err := o.expr(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		code = append(code, arg...)
+	}
+
+	return code, nil
+}
+
+// constant reports value of the condition that's known without running it
+func (o *Optimizer) constant(code []Bytecode) (bool, bool) {
+	literal, ok := o.literal(code)
+
+	if !ok {
+		return false, false
+	}
+
+	switch literal.LiteralType {
+	case BoolLiteral:
+		return literal.Value.(bool), true
+	case NilLiteral:
+		return false, true
+	}
+
+	return false, false
+}
+
+// pure reports whether count expressions from code can run twice without side effects
+func (o *Optimizer) pure(code []Bytecode, count int) bool {
+	cur := &checkCursor{Code: code}
+
+	var next func() bool
+
+	next = func() bool {
+		if cur.Idx >= len(cur.Code) {
+			return false
+		}
+
+		switch cur.Code[cur.Idx] {
+		case B_LITERAL:
+			literal, err := o.readLiteral(cur)
+
+			return err == nil && literal.LiteralType != ListLiteral && literal.LiteralType != ObjLiteral
+		case B_BIN_OP:
+			cur.Idx += 2
+
+			return next() && next()
+		case B_TYPE_HINT:
+			cur.Idx++
+
+			_, err := o.readLiteral(cur)
+
+			return err == nil && next()
+		}
+
+		return false
+	}
+
+	for range count {
+		if !next() {
+			return false
+		}
+	}
+
+	return cur.Idx == len(cur.Code)
+}
+
+// literal returns the literal when code is nothing more than a reference to it
+func (o *Optimizer) literal(code []Bytecode) (*Literal, bool) {
+	cur := &checkCursor{Code: code}
+
+	literal, err := o.readLiteral(cur)
+
+	if err != nil || cur.Idx != len(code) {
+		return nil, false
+	}
+
+	return literal, true
+}
+
+// appendLiteral adds value to the pool (reusing the same constant if it's there) and returns code referencing it
+func (o *Optimizer) appendLiteral(value *Literal) []Bytecode {
+	key, _ := literalKey(*value)
+
+	idx, ok := o.literalIndex()[key]
+
+	if !ok {
+		o.Literals = append(o.Literals, value)
+		idx = len(o.Literals) - 1
+	}
+
+	return joinCode([]Bytecode{B_LITERAL}, mustEncodeLen(idx))
+}
+
+// literalIndex returns the index of constants, literals appended since the last call are added first
+func (o *Optimizer) literalIndex() map[string]int {
+	if o.literalIdx == nil || o.indexed > len(o.Literals) {
+		o.literalIdx, o.indexed = make(map[string]int, len(o.Literals)), 0
+	}
+
+	for ; o.indexed < len(o.Literals); o.indexed++ {
+		if literal := o.Literals[o.indexed]; isConstant(literal) {
+			if key, ok := literalKey(*literal); ok {
+				if _, exists := o.literalIdx[key]; !exists {
+					o.literalIdx[key] = o.indexed
+				}
+			}
+		}
+	}
+
+	return o.literalIdx
+}
+
+func (o *Optimizer) readLiteral(cur *checkCursor) (*Literal, error) {
+	if cur.Idx >= len(cur.Code) || cur.Code[cur.Idx] != B_LITERAL {
+		return nil, errUnknownBytecode
+	}
+
+	cur.Idx++
+
+	idx, err := cur.decodeLen()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if idx >= len(o.Literals) {
+		return nil, errUnknownBytecode
+	}
+
+	return o.Literals[idx], nil
+}
+
+// isConstant reports whether literal is a value known before running the code
+func isConstant(literal *Literal) bool {
+	switch literal.LiteralType {
+	case IntLiteral, DoubleLiteral, BoolLiteral, StringLiteral, NilLiteral:
+		return true
+	}
+
+	return false
+}
+
+func isScopeChange(code []Bytecode) bool {
+	return len(code) == 1 && (code[0] == B_NEW_SCOPE || code[0] == B_END_SCOPE)
+}
@@ -3,6 +3,8 @@ package parts
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 )
 
 type Parser struct {
@@ -15,12 +17,40 @@ type Parser struct {
 	Literals   []Literal
 	Meta       map[string]string
 	ModulePath string
+
+	//Nil when not profiling
+	Profiler *Profiler
+
+	//Emit B_LINE before every statement
+	Lines bool
+
+	//Passed to VMs of the inline syntax blocks, nil when not debugging
+	Debugger *Debugger
+
+	//Lines and branches are registered under Source, nil when not collecting coverage
+	Coverage *Coverage
+	Source   string
+
+	//Line of the last B_LINE
+	line int
+
+	//Index of every literal in Literals by literalKey, first `indexed` literals are in there
+	literalIdx map[string]int
+	indexed    int
 }
 
 func (p *Parser) ParseAll() ([]Bytecode, error) {
 	bytecode := make([]Bytecode, 0)
 
 	for !(p.LastToken.Type == TokenInvalid && string(p.LastToken.Value) == "EOF") {
+		line, err := p.lineMarker()
+
+		if err != nil {
+			return []Bytecode{}, errors.Join(errors.New("got error while parsing whole code"), err)
+		}
+
+		bytecode = append(bytecode, line...)
+
 		temp, err := p.parse()
 
 		if err != nil {
@@ -33,6 +63,34 @@ func (p *Parser) ParseAll() ([]Bytecode, error) {
 	return bytecode, nil
 }
 
+// lineMarker returns B_LINE with the line of the next statement, nothing when lines are off
+func (p *Parser) lineMarker() ([]Bytecode, error) {
+	if !p.Lines {
+		return []Bytecode{}, nil
+	}
+
+	token, err := p.peek()
+
+	if err != nil {
+		return []Bytecode{}, err
+	}
+
+	if token.Line == 0 {
+		return []Bytecode{}, nil
+	}
+
+	p.line = token.Line
+	p.Coverage.statement(p.Source, token.Line)
+
+	encoded, err := encodeLen(token.Line)
+
+	if err != nil {
+		return []Bytecode{}, errors.Join(errors.New("got error while encoding line"), err)
+	}
+
+	return append([]Bytecode{B_LINE}, encoded...), nil
+}
+
 func (p *Parser) parse() ([]Bytecode, error) {
 	for _, rule := range p.Rules {
 		if rule.Rule(p) {
@@ -42,8 +100,12 @@ func (p *Parser) parse() ([]Bytecode, error) {
 				}
 			}
 
+			p.Profiler.enter(ProfileParserRule, rule.Id)
+
 			body, err := rule.Parse(p)
 
+			p.Profiler.exit()
+
 			if err != nil {
 				return []Bytecode{}, errors.Join(fmt.Errorf("got error while parsing rule - %s", rule.Id), err)
 			}
@@ -60,8 +122,12 @@ func (p *Parser) parse() ([]Bytecode, error) {
 								}
 							}
 
+							p.Profiler.enter(ProfileParserRule, pRule.Id)
+
 							body, err = pRule.Parse(p, body)
 
+							p.Profiler.exit()
+
 							if err != nil {
 								return nil, errors.Join(fmt.Errorf("error parsing postfix rule - (%s:%s)", rule.Id, pRule.Id), err)
 							}
@@ -92,6 +158,45 @@ func (p *Parser) parse() ([]Bytecode, error) {
 	return []Bytecode{}, fmt.Errorf("Unknown rule? (%d - %s)", currentToken.Type, string(currentToken.Value))
 }
 
+// parseChain applies postfix rules with the ids to the code for as long as they match,
+// it's used by rules that have to wrap the whole chain (like optional dot)
+func (p *Parser) parseChain(code []Bytecode, ids ...string) ([]Bytecode, error) {
+	for {
+		applied := false
+
+		for _, pRule := range p.PostFix {
+			if !slices.Contains(ids, pRule.Id) || !pRule.Rule(p) {
+				continue
+			}
+
+			if pRule.AdvanceToken {
+				if _, err := p.advance(); err != nil {
+					return nil, errors.Join(errors.New("error advancing after postfix rule check"), err)
+				}
+			}
+
+			p.Profiler.enter(ProfileParserRule, pRule.Id)
+
+			var err error
+
+			code, err = pRule.Parse(p, code)
+
+			p.Profiler.exit()
+
+			if err != nil {
+				return nil, errors.Join(fmt.Errorf("error parsing postfix rule - %s", pRule.Id), err)
+			}
+
+			applied = true
+			break
+		}
+
+		if !applied {
+			return code, nil
+		}
+	}
+}
+
 func (p *Parser) parseWithRule(id string) ([]Bytecode, error) {
 	for _, rule := range p.Rules {
 		if rule.Id == id {
@@ -102,8 +207,12 @@ func (p *Parser) parseWithRule(id string) ([]Bytecode, error) {
 					}
 				}
 
+				p.Profiler.enter(ProfileParserRule, rule.Id)
+
 				res, err := rule.Parse(p)
 
+				p.Profiler.exit()
+
 				if err != nil {
 					return []Bytecode{}, errors.Join(fmt.Errorf("got error while parsing rule - %s", rule.Id), err)
 				}
@@ -158,6 +267,31 @@ func (p *Parser) matchOperator(value string) bool {
 	return p.match(TokenOperator, value)
 }
 
+// parseTypeHint reads optional `: Type` annotation, returns zero TypeHint when there's none
+func (p *Parser) parseTypeHint() (TypeHint, error) {
+	if !p.matchOperator("COLON") {
+		return TypeHint{}, nil
+	}
+
+	typeToken, err := p.advance()
+
+	if err != nil {
+		return TypeHint{}, errors.Join(errors.New("got error while reading type annotation"), err)
+	}
+
+	if typeToken.Type != TokenIdentifier {
+		return TypeHint{}, fmt.Errorf("expected type name got '%s'", string(typeToken.Value))
+	}
+
+	name := string(typeToken.Value)
+
+	if p.matchOperator("QUESTION") {
+		name += "?"
+	}
+
+	return ParseTypeHint(name)
+}
+
 func (p *Parser) peek() (Token, error) {
 	if p.LastToken.Type == TokenInvalid {
 		token, err := p.Scanner.Next()
@@ -204,6 +338,18 @@ const (
 	B_LOOP
 	B_CONTINUE
 	B_BREAK
+	B_OPT_DOT
+	B_COALESCE
+	B_YIELD
+	B_TYPE_HINT
+	B_JUMP
+	B_JUMP_REV
+	B_LOAD_LOCAL
+	B_STORE_LOCAL
+	B_DECLARE_LOCAL
+	B_LINE
+	B_END_LOOP
+	B_OPT_CHAIN
 )
 
 type BinOp Bytecode
@@ -217,6 +363,15 @@ const (
 	B_OP_GT
 	B_OP_LT
 	B_OP_MOD
+	B_OP_BIT_AND
+	B_OP_BIT_OR
+	B_OP_BIT_XOR
+	B_OP_SHL
+	B_OP_SHR
+	B_OP_POW
+	B_OP_FLOOR_DIV
+	B_OP_GT_EQ
+	B_OP_LT_EQ
 )
 
 type ImportType Bytecode
@@ -226,8 +381,13 @@ const (
 )
 
 type FunctionDeclaration struct {
-	Params []string
-	Body   []Bytecode
+	Params    []string
+	Body      []Bytecode
+	Generator bool
+
+	//Optional annotations, same length as Params
+	ParamTypes []TypeHint
+	ReturnType TypeHint
 }
 
 type ObjDefinition struct {
@@ -238,40 +398,110 @@ type ListDefinition struct {
 	Entries [][]Bytecode
 }
 
+// parseImportString reads string literal after import keywords
+func (p *Parser) parseImportString() (string, error) {
+	tempBytecode, err := p.parseWithRule("ParseStr")
+
+	if err != nil {
+		return "", err
+	}
+
+	if tempBytecode[0] != B_LITERAL {
+		return "", errors.New("expected string literal")
+	}
+
+	tempBytecode = tempBytecode[1:]
+	stringIdx := -1
+
+	switch tempBytecode[0] {
+	case 126:
+		stringIdx = int(tempBytecode[1])<<8 | int(tempBytecode[2])
+	case 127:
+		stringIdx = int(tempBytecode[1])<<56 | int(tempBytecode[2])<<48 |
+			int(tempBytecode[3])<<40 | int(tempBytecode[4])<<32 |
+			int(tempBytecode[5])<<24 | int(tempBytecode[6])<<16 |
+			int(tempBytecode[7])<<8 | int(tempBytecode[8])
+	default:
+		stringIdx = int(tempBytecode[0])
+	}
+
+	if stringIdx == -1 {
+		return "", errors.New("expected string literal")
+	}
+
+	stringLiteral := p.Literals[stringIdx]
+
+	if stringLiteral.LiteralType != StringLiteral {
+		return "", errors.New("expected string literal")
+	}
+
+	return stringLiteral.Value.(string), nil
+}
+
 func (p *Parser) AppendLiteral(literal Literal) ([]Bytecode, error) {
-	existingIdx := -1
+	key, hashable := literalKey(literal)
 
-	if literal.LiteralType != ObjLiteral && literal.LiteralType != ListLiteral && literal.LiteralType != FunLiteral {
-		for idx, existingLiteral := range p.Literals {
-			if existingLiteral.LiteralType != literal.LiteralType {
-				continue
-			}
+	if hashable {
+		if existingIdx, ok := p.literalIndex()[key]; ok {
+			encoded, err := encodeLen(existingIdx)
 
-			if existingLiteral.Value == literal.Value {
-				existingIdx = idx
+			if err != nil {
+				return []Bytecode{}, errors.Join(errors.New("got error while encoding literal offset"), err)
 			}
+
+			return append([]Bytecode{B_LITERAL}, encoded...), nil
 		}
 	}
 
-	if existingIdx == -1 {
-		p.Literals = append(p.Literals, literal)
+	p.Literals = append(p.Literals, literal)
 
-		encoded, err := encodeLen(len(p.Literals) - 1)
+	encoded, err := encodeLen(len(p.Literals) - 1)
 
-		if err != nil {
-			return []Bytecode{}, errors.Join(errors.New("got error while encoding literal offset"), err)
-		}
+	if err != nil {
+		return []Bytecode{}, errors.Join(errors.New("got error while encoding literal offset"), err)
+	}
 
-		return append([]Bytecode{B_LITERAL}, encoded...), nil
-	} else {
-		encoded, err := encodeLen(existingIdx)
+	return append([]Bytecode{B_LITERAL}, encoded...), nil
+}
 
-		if err != nil {
-			return []Bytecode{}, errors.Join(errors.New("got error while encoding literal offset"), err)
+// literalIndex returns the index, literals appended to Literals directly since the last call are added first
+func (p *Parser) literalIndex() map[string]int {
+	if p.literalIdx == nil || p.indexed > len(p.Literals) {
+		p.literalIdx, p.indexed = make(map[string]int, len(p.Literals)), 0
+	}
+
+	for ; p.indexed < len(p.Literals); p.indexed++ {
+		if key, ok := literalKey(p.Literals[p.indexed]); ok {
+			if _, exists := p.literalIdx[key]; !exists {
+				p.literalIdx[key] = p.indexed
+			}
 		}
+	}
+
+	return p.literalIdx
+}
 
-		return append([]Bytecode{B_LITERAL}, encoded...), nil
+// literalKey identifies literal by its type and value, literals that are
+// neither constants nor definitions made by the parser aren't deduplicated
+func literalKey(literal Literal) (string, bool) {
+	prefix := strconv.Itoa(int(literal.LiteralType)) + ":"
+
+	switch value := literal.Value.(type) {
+	case string:
+		return prefix + value, true
+	case int:
+		return prefix + strconv.Itoa(value), true
+	case float64:
+		return prefix + strconv.FormatFloat(value, 'g', -1, 64), true
+	case bool:
+		return prefix + strconv.FormatBool(value), true
+	case nil:
+		return prefix, true
+	case FunctionDeclaration, ListDefinition, ObjDefinition, TypeHint:
+		return prefix + fmt.Sprintf("%#v", value), true
 	}
+
+	return "", false
 }
 
 func encodeLen(num int) ([]Bytecode, error) {
@@ -300,6 +530,302 @@ func encodeLen(num int) ([]Bytecode, error) {
 	}, nil
 }
 
+// encodeCondJump builds B_COND_JUMP, then branch is followed by the jump over the else branch
+func encodeCondJump(condition, then, otherwise []Bytecode) ([]Bytecode, error) {
+	thenLength, err := encodeLen(len(then))
+
+	if err != nil {
+		return []Bytecode{}, err
+	}
+
+	elseLength, err := encodeLen(len(otherwise))
+
+	if err != nil {
+		return []Bytecode{}, err
+	}
+
+	return joinCode([]Bytecode{B_COND_JUMP}, condition, thenLength, then, []Bytecode{B_JUMP}, elseLength, otherwise), nil
+}
+
+// encodeLoop builds B_LOOP, body gets reverse jump back to the loop and B_END_LOOP
+// appended. B_BREAK and B_CONTINUE of the body are linked here, break jumps to
+// B_END_LOOP and continue jumps back to B_LOOP.
+func encodeLoop(condition, body []Bytecode) ([]Bytecode, error) {
+	conditionLength, err := encodeLen(len(condition))
+
+	if err != nil {
+		return []Bytecode{}, err
+	}
+
+	markers, err := loopMarkers(body)
+
+	if err != nil {
+		return []Bytecode{}, errors.Join(errors.New("got error while linking break and continue"), err)
+	}
+
+	offsetSize, bodyLengthSize := 1, 1
+
+	for {
+		header := 1 + len(conditionLength) + len(condition) + bodyLengthSize
+
+		//Jump lands on B_LOOP, offset is counted from the end of B_JUMP_REV
+		offset, err := encodeLen(header + len(body) + 1 + offsetSize)
+
+		if err != nil {
+			return []Bytecode{}, err
+		}
+
+		bodyLength, err := encodeLen(len(body) + 1 + len(offset))
+
+		if err != nil {
+			return []Bytecode{}, err
+		}
+
+		if len(offset) != offsetSize || len(bodyLength) != bodyLengthSize {
+			offsetSize, bodyLengthSize = len(offset), len(bodyLength)
+			continue
+		}
+
+		linked := joinCode(body)
+		end := len(body) + 1 + len(offset)
+
+		for _, idx := range markers {
+			jumpEnd := idx + len(jumpMarker(B_BREAK))
+
+			if linked[idx] == B_BREAK {
+				linked[idx] = B_JUMP
+				copy(linked[idx+1:jumpEnd], encodeWideLen(end-jumpEnd))
+			} else {
+				linked[idx] = B_JUMP_REV
+				copy(linked[idx+1:jumpEnd], encodeWideLen(header+jumpEnd))
+			}
+		}
+
+		return joinCode(
+			[]Bytecode{B_LOOP},
+			conditionLength,
+			condition,
+			bodyLength,
+			linked,
+			[]Bytecode{B_JUMP_REV},
+			offset,
+			[]Bytecode{B_END_LOOP},
+		), nil
+	}
+}
+
+// jumpMarker returns B_BREAK or B_CONTINUE waiting to be linked by encodeLoop, offset
+// takes the widest encoding so linking it doesn't move any code
+func jumpMarker(op Bytecode) []Bytecode {
+	return joinCode([]Bytecode{op}, encodeWideLen(0))
+}
+
+// loopJump reads break or continue, linked or not, and returns it as the marker
+// so encodeLoop can link it again after the code around was rewritten
+func loopJump(cur *checkCursor) ([]Bytecode, error) {
+	op := cur.Code[cur.Idx]
+
+	cur.Idx++
+
+	if _, err := cur.decodeLen(); err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case B_JUMP, B_BREAK:
+		return jumpMarker(B_BREAK), nil
+	case B_JUMP_REV, B_CONTINUE:
+		return jumpMarker(B_CONTINUE), nil
+	}
+
+	return nil, errUnknownBytecode
+}
+
+// encodeWideLen encodes num the same way as encodeLen does for the largest values
+func encodeWideLen(num int) []Bytecode {
+	return []Bytecode{
+		127,
+		Bytecode(num >> 56),
+		Bytecode(num >> 48),
+		Bytecode(num >> 40),
+		Bytecode(num >> 32),
+		Bytecode(num >> 24),
+		Bytecode(num >> 16),
+		Bytecode(num >> 8),
+		Bytecode(num),
+	}
+}
+
+// loopMarkers returns positions of B_BREAK and B_CONTINUE that belong to the loop
+// with the body, nested loops are already linked so they're skipped
+func loopMarkers(body []Bytecode) ([]int, error) {
+	cur := &checkCursor{Code: body}
+	markers := []int{}
+
+	var expr func() error
+
+	exprs := func(count int) error {
+		for range count {
+			if err := expr(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	region := func() error {
+		length, err := cur.decodeLen()
+
+		if err != nil {
+			return err
+		}
+
+		end := cur.Idx + length
+
+		if end > len(cur.Code) {
+			return errUnknownBytecode
+		}
+
+		for cur.Idx < end {
+			if err := expr(); err != nil {
+				return err
+			}
+		}
+
+		if cur.Idx != end {
+			return errUnknownBytecode
+		}
+
+		return nil
+	}
+
+	expr = func() error {
+		if cur.Idx >= len(cur.Code) {
+			return errUnknownBytecode
+		}
+
+		op := cur.Code[cur.Idx]
+
+		cur.Idx++
+
+		switch op {
+		case B_LITERAL, B_JUMP, B_JUMP_REV, B_LINE:
+			_, err := cur.decodeLen()
+
+			return err
+		case B_BREAK, B_CONTINUE:
+			markers = append(markers, cur.Idx-1)
+
+			_, err := cur.decodeLen()
+
+			return err
+		case B_NEW_SCOPE, B_END_SCOPE, B_END_LOOP:
+			return nil
+		case B_LOAD_LOCAL:
+			if _, err := cur.decodeLen(); err != nil {
+				return err
+			}
+
+			_, err := cur.decodeLen()
+
+			return err
+		case B_STORE_LOCAL:
+			if _, err := cur.decodeLen(); err != nil {
+				return err
+			}
+
+			if _, err := cur.decodeLen(); err != nil {
+				return err
+			}
+
+			return expr()
+		case B_DECLARE_LOCAL:
+			if _, err := cur.decodeLen(); err != nil {
+				return err
+			}
+
+			return exprs(2)
+		case B_RESOLVE, B_YIELD, B_RAISE, B_RETURN:
+			return expr()
+		case B_DECLARE, B_SET, B_DOT, B_TYPE_HINT:
+			//What follows the accessor of B_DOT has the same layout as B_SET, B_CALL or a value,
+			//type annotation is a literal followed by the value
+			return exprs(2)
+		case B_BIN_OP:
+			cur.Idx++
+
+			return exprs(2)
+		case B_CALL:
+			if err := expr(); err != nil {
+				return err
+			}
+
+			if cur.Idx >= len(cur.Code) {
+				return errUnknownBytecode
+			}
+
+			count := int(cur.Code[cur.Idx])
+
+			cur.Idx++
+
+			return exprs(count)
+		case B_OPT_DOT, B_COALESCE:
+			if err := expr(); err != nil {
+				return err
+			}
+
+			return region()
+		case B_OPT_CHAIN:
+			return region()
+		case B_COND_JUMP:
+			if err := expr(); err != nil {
+				return err
+			}
+
+			if err := region(); err != nil {
+				return err
+			}
+
+			if cur.Idx >= len(cur.Code) || cur.Code[cur.Idx] != B_JUMP {
+				return errUnknownBytecode
+			}
+
+			cur.Idx++
+
+			return region()
+		case B_LOOP:
+			for range 2 {
+				length, err := cur.decodeLen()
+
+				if err != nil {
+					return err
+				}
+
+				cur.Idx += length
+			}
+
+			if cur.Idx >= len(cur.Code) || cur.Code[cur.Idx] != B_END_LOOP {
+				return errUnknownBytecode
+			}
+
+			cur.Idx++
+
+			return nil
+		}
+
+		return errUnknownBytecode
+	}
+
+	for cur.Idx < len(cur.Code) {
+		if err := expr(); err != nil {
+			return nil, err
+		}
+	}
+
+	return markers, nil
+}
+
 func mustEncodeLen(num int) []Bytecode {
 	val, err := encodeLen(num)
 
@@ -972,7 +972,7 @@ func TestIfExpressionFull(t *testing.T) {
 		return
 	}
 
-	CheckBytecode(t, bytecode, []Bytecode{B_COND_JUMP, B_LITERAL, Bytecode(condVal), 5, B_NEW_SCOPE, B_RETURN, B_LITERAL, Bytecode(varVal), B_END_SCOPE, 5, B_NEW_SCOPE, B_RETURN, B_LITERAL, Bytecode(varVal2), B_END_SCOPE})
+	CheckBytecode(t, bytecode, []Bytecode{B_COND_JUMP, B_LITERAL, Bytecode(condVal), 5, B_NEW_SCOPE, B_RETURN, B_LITERAL, Bytecode(varVal), B_END_SCOPE, B_JUMP, 5, B_NEW_SCOPE, B_RETURN, B_LITERAL, Bytecode(varVal2), B_END_SCOPE})
 }
 
 func TestIfExpressionFullCursed(t *testing.T) {
@@ -1005,7 +1005,7 @@ func TestIfExpressionFullCursed(t *testing.T) {
 		return
 	}
 
-	CheckBytecode(t, bytecode, []Bytecode{B_COND_JUMP, B_LITERAL, Bytecode(condVal), 3, B_RETURN, B_LITERAL, Bytecode(varVal), 3, B_RETURN, B_LITERAL, Bytecode(varVal2)})
+	CheckBytecode(t, bytecode, []Bytecode{B_COND_JUMP, B_LITERAL, Bytecode(condVal), 3, B_RETURN, B_LITERAL, Bytecode(varVal), B_JUMP, 3, B_RETURN, B_LITERAL, Bytecode(varVal2)})
 }
 
 func TestIfExpressionNoElse(t *testing.T) {
@@ -1031,7 +1031,7 @@ func TestIfExpressionNoElse(t *testing.T) {
 		return
 	}
 
-	CheckBytecode(t, bytecode, []Bytecode{B_COND_JUMP, B_LITERAL, Bytecode(condVal), 5, B_NEW_SCOPE, B_RETURN, B_LITERAL, Bytecode(varVal), B_END_SCOPE, 0})
+	CheckBytecode(t, bytecode, []Bytecode{B_COND_JUMP, B_LITERAL, Bytecode(condVal), 5, B_NEW_SCOPE, B_RETURN, B_LITERAL, Bytecode(varVal), B_END_SCOPE, B_JUMP, 0})
 }
 
 func TestMathAdd(t *testing.T) {
@@ -1324,3 +1324,113 @@ func GetParserLiteral(p Parser, literalType LiteralType, val any) (int, Literal)
 
 	return -1, Literal{}
 }
+
+func TestTypeAnnotations(t *testing.T) {
+	parser := GetParserWithSource("let x: Int = 1; let f(hp: Int, name: String?): Bool = true", "./")
+
+	bytecode, err := parser.ParseAll()
+
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+		return
+	}
+
+	if !CheckBytecode(t, bytecode[:5], []Bytecode{B_DECLARE, B_LITERAL, Bytecode(len(InitialLiterals)), B_TYPE_HINT, B_LITERAL}) {
+		return
+	}
+
+	fnDeclaration := (parser.Literals[len(parser.Literals)-1].Value).(FunctionDeclaration)
+
+	expectedParams := []TypeHint{{Name: "Int"}, {Name: "String", Nullable: true}}
+
+	if len(fnDeclaration.ParamTypes) != len(expectedParams) {
+		t.Errorf("expected %d param types got %d", len(expectedParams), len(fnDeclaration.ParamTypes))
+		return
+	}
+
+	for idx, hint := range expectedParams {
+		if fnDeclaration.ParamTypes[idx] != hint {
+			t.Errorf("expected %s at [%d] in declaration got %s", hint, idx, fnDeclaration.ParamTypes[idx])
+			return
+		}
+	}
+
+	if fnDeclaration.ReturnType != (TypeHint{Name: "Bool"}) {
+		t.Errorf("expected Bool return type got %s", fnDeclaration.ReturnType)
+	}
+}
+
+func TestUnknownTypeAnnotation(t *testing.T) {
+	parser := GetParserWithSource("let x: Number = 1", "./")
+
+	if _, err := parser.ParseAll(); err == nil {
+		t.Error("expected error but got none")
+	}
+}
+
+func TestLoopReverseJump(t *testing.T) {
+	parser := GetParserWithSource("for x { }", "./")
+
+	bytecode, err := parser.parse()
+
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+		return
+	}
+
+	CheckBytecode(t, bytecode, []Bytecode{B_LOOP, 2, B_LITERAL, Bytecode(len(InitialLiterals)), 4, B_NEW_SCOPE, B_END_SCOPE, B_JUMP_REV, 9, B_END_LOOP})
+}
+
+func TestLoopBreakContinueLinked(t *testing.T) {
+	parser := GetParserWithSource("for x { break }", "./")
+
+	bytecode, err := parser.parse()
+
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+		return
+	}
+
+	//Break jumps to B_END_LOOP
+	CheckBytecode(t, bytecode, []Bytecode{B_LOOP, 2, B_LITERAL, Bytecode(len(InitialLiterals)), 14, B_NEW_SCOPE, B_JUMP, 127, 0, 0, 0, 0, 0, 0, 0, 3, B_END_SCOPE, B_JUMP_REV, 19, B_END_LOOP})
+
+	parser = GetParserWithSource("for x { continue }", "./")
+
+	if bytecode, err = parser.parse(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+		return
+	}
+
+	//Continue jumps back to B_LOOP
+	CheckBytecode(t, bytecode, []Bytecode{B_LOOP, 2, B_LITERAL, Bytecode(len(InitialLiterals)), 14, B_NEW_SCOPE, B_JUMP_REV, 127, 0, 0, 0, 0, 0, 0, 0, 16, B_END_SCOPE, B_JUMP_REV, 19, B_END_LOOP})
+}
+
+func TestLiteralDeduplication(t *testing.T) {
+	parser := GetParserWithSource(`let a = "text"
+		let b = "text"
+		let c = [1, 2.5]
+		let d = [1, 2.5]
+		let e() { return 1 }
+		let f() { return 1 }`, "./")
+
+	if _, err := parser.ParseAll(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+		return
+	}
+
+	//Names a-f, "text", 1, 2, 5, list and function
+	if expected := len(InitialLiterals) + 12; len(parser.Literals) != expected {
+		t.Errorf("expected %d literals got %d (%v)", expected, len(parser.Literals), parser.Literals)
+	}
+
+	parser.Literals = append(parser.Literals, Literal{StringLiteral, "direct"})
+
+	code, err := parser.AppendLiteral(Literal{StringLiteral, "direct"})
+
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+		return
+	}
+
+	CheckBytecode(t, code, []Bytecode{B_LITERAL, Bytecode(len(parser.Literals) - 1)})
+}
@@ -0,0 +1,366 @@
+package parts
+
+import (
+	"cmp"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type ProfileKind int
+
+const (
+	//Function written in Parts
+	ProfileFunction ProfileKind = iota
+	//NativeMethod, mostly the standard library
+	ProfileNative
+	//Go function called through FFI
+	ProfileFFI
+	ProfileScannerRule
+	ProfileParserRule
+)
+
+var profileKindNames = []string{"function", "native", "ffi", "scanner rule", "parser rule"}
+
+func (k ProfileKind) String() string {
+	return profileKindNames[k]
+}
+
+// ProfileEntry sums up all calls of a single function or rule
+type ProfileEntry struct {
+	Name  string
+	Kind  ProfileKind
+	Calls int
+
+	//Time spent in the entry itself, without what it called
+	Self time.Duration
+	//Time from the call until it returned, recursive calls are counted once
+	Total time.Duration
+}
+
+type profileFrame struct {
+	Entry    *ProfileEntry
+	Start    time.Time
+	Children time.Duration
+}
+
+// profileSample is a single call stack as it's written to pprof, root first
+type profileSample struct {
+	Stack []*ProfileEntry
+	Calls int
+	Self  time.Duration
+}
+
+// Profiler times every function call and every scanner and parser rule that
+// matched (it's instrumenting, not sampling). Single profiler is shared by the
+// parser, the VM and all of its sub VMs, methods do nothing on nil profiler so
+// code paths don't have to check whether profiling is on.
+type Profiler struct {
+	Start time.Time
+
+	entries map[string]*ProfileEntry
+	samples map[string]*profileSample
+	stack   []profileFrame
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{
+		Start:   time.Now(),
+		entries: make(map[string]*ProfileEntry),
+		samples: make(map[string]*profileSample),
+	}
+}
+
+func (p *Profiler) enter(kind ProfileKind, name string) {
+	if p == nil {
+		return
+	}
+
+	key := fmt.Sprintf("%d:%s", kind, name)
+	entry, ok := p.entries[key]
+
+	if !ok {
+		entry = &ProfileEntry{Name: name, Kind: kind}
+		p.entries[key] = entry
+	}
+
+	p.stack = append(p.stack, profileFrame{Entry: entry, Start: time.Now()})
+}
+
+// enterCall is enter for callables, name is what the function was called by (if known)
+func (p *Profiler) enterCall(fun PartsCallable, name string) {
+	if p == nil {
+		return
+	}
+
+	kind := ProfileNative
+
+	switch fun := fun.(type) {
+	case FunctionDeclaration:
+		kind = ProfileFunction
+	case FFIFunction:
+		kind = ProfileFFI
+
+		if name == "" {
+			name = runtime.FuncForPC(reflect.ValueOf(fun.Function).Pointer()).Name()
+		}
+	case NamedFFIFunction:
+		kind = ProfileFFI
+
+		if name == "" {
+			name = runtime.FuncForPC(reflect.ValueOf(fun.Function).Pointer()).Name()
+		}
+	case FFIMethod:
+		kind = ProfileFFI
+
+		if name == "" {
+			name = fun.Name
+		}
+	}
+
+	if name == "" {
+		name = "anonymous"
+	}
+
+	p.enter(kind, name)
+}
+
+func (p *Profiler) exit() {
+	if p == nil || len(p.stack) == 0 {
+		return
+	}
+
+	frame := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+
+	elapsed := time.Since(frame.Start)
+	self := elapsed - frame.Children
+
+	frame.Entry.Calls++
+	frame.Entry.Self += self
+
+	recursive := false
+
+	for _, outer := range p.stack {
+		recursive = recursive || outer.Entry == frame.Entry
+	}
+
+	if !recursive {
+		frame.Entry.Total += elapsed
+	}
+
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].Children += elapsed
+	}
+
+	stack := make([]*ProfileEntry, 0, len(p.stack)+1)
+	names := make([]string, 0, len(p.stack)+1)
+
+	for _, outer := range append(p.stack, frame) {
+		stack = append(stack, outer.Entry)
+		names = append(names, fmt.Sprintf("%d:%s", outer.Entry.Kind, outer.Entry.Name))
+	}
+
+	key := strings.Join(names, "\x00")
+	sample, ok := p.samples[key]
+
+	if !ok {
+		sample = &profileSample{Stack: stack}
+		p.samples[key] = sample
+	}
+
+	sample.Calls++
+	sample.Self += self
+}
+
+// Entries returns everything that was called, slowest (by total time) first
+func (p *Profiler) Entries() []*ProfileEntry {
+	entries := make([]*ProfileEntry, 0, len(p.entries))
+
+	for _, entry := range p.entries {
+		entries = append(entries, entry)
+	}
+
+	slices.SortFunc(entries, func(a, b *ProfileEntry) int {
+		if a.Total != b.Total {
+			return cmp.Compare(b.Total, a.Total)
+		}
+
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return entries
+}
+
+// Report writes table of all entries, functions first and rules after them
+func (p *Profiler) Report(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	sections := []struct {
+		Title string
+		Kinds []ProfileKind
+	}{
+		{"Functions", []ProfileKind{ProfileFunction, ProfileNative, ProfileFFI}},
+		{"Rules", []ProfileKind{ProfileScannerRule, ProfileParserRule}},
+	}
+
+	for idx, section := range sections {
+		if idx > 0 {
+			fmt.Fprintln(tw)
+		}
+
+		fmt.Fprintf(tw, "%s:\n", section.Title)
+		fmt.Fprintln(tw, "calls\tself\ttotal\t name")
+
+		for _, entry := range p.Entries() {
+			if slices.Contains(section.Kinds, entry.Kind) {
+				fmt.Fprintf(tw, "%d\t%s\t%s\t %s (%s)\n", entry.Calls, entry.Self, entry.Total, entry.Name, entry.Kind)
+			}
+		}
+	}
+
+	return tw.Flush()
+}
+
+// WriteProfile writes gzipped pprof profile, samples are call stacks with call counts and self time
+func (p *Profiler) WriteProfile(w io.Writer) error {
+	strs := []string{""}
+	strIdx := map[string]int{"": 0}
+
+	str := func(s string) uint64 {
+		if idx, ok := strIdx[s]; ok {
+			return uint64(idx)
+		}
+
+		strs = append(strs, s)
+		strIdx[s] = len(strs) - 1
+
+		return uint64(len(strs) - 1)
+	}
+
+	valueType := func(typ, unit string) []byte {
+		var msg protoBuffer
+
+		msg.varint(1, str(typ))
+		msg.varint(2, str(unit))
+
+		return msg
+	}
+
+	var profile protoBuffer
+
+	profile.bytes(1, valueType("calls", "count"))
+	profile.bytes(1, valueType("time", "nanoseconds"))
+
+	ids := map[*ProfileEntry]uint64{}
+	entries := p.Entries()
+
+	for idx, entry := range entries {
+		ids[entry] = uint64(idx + 1)
+	}
+
+	keys := make([]string, 0, len(p.samples))
+
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		sample := p.samples[key]
+		locations := make([]uint64, len(sample.Stack))
+
+		//Leaf goes first
+		for idx, entry := range sample.Stack {
+			locations[len(locations)-1-idx] = ids[entry]
+		}
+
+		var msg protoBuffer
+
+		msg.packed(1, locations)
+		msg.packed(2, []uint64{uint64(sample.Calls), uint64(sample.Self)})
+
+		profile.bytes(2, msg)
+	}
+
+	for _, entry := range entries {
+		var line, location protoBuffer
+
+		line.varint(1, ids[entry])
+
+		location.varint(1, ids[entry])
+		location.bytes(4, line)
+
+		profile.bytes(4, location)
+	}
+
+	for _, entry := range entries {
+		var function protoBuffer
+
+		function.varint(1, ids[entry])
+		function.varint(2, str(entry.Name))
+		function.varint(3, str(fmt.Sprintf("%s (%s)", entry.Name, entry.Kind)))
+
+		profile.bytes(5, function)
+	}
+
+	periodType := valueType("time", "nanoseconds")
+
+	for _, s := range strs {
+		profile.bytes(6, []byte(s))
+	}
+
+	profile.varint(9, uint64(p.Start.UnixNano()))
+	profile.varint(10, uint64(time.Since(p.Start)))
+	profile.bytes(11, periodType)
+	profile.varint(12, 1)
+
+	gz := gzip.NewWriter(w)
+
+	if _, err := gz.Write(profile); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// protoBuffer is just enough of protobuf encoding for pprof profiles
+type protoBuffer []byte
+
+func (b *protoBuffer) uvarint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+
+	*b = append(*b, byte(v))
+}
+
+func (b *protoBuffer) varint(field int, v uint64) {
+	b.uvarint(uint64(field) << 3)
+	b.uvarint(v)
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.uvarint(uint64(field)<<3 | 2)
+	b.uvarint(uint64(len(data)))
+
+	*b = append(*b, data...)
+}
+
+func (b *protoBuffer) packed(field int, values []uint64) {
+	var data protoBuffer
+
+	for _, v := range values {
+		data.uvarint(v)
+	}
+
+	b.bytes(field, data)
+}
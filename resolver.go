@@ -0,0 +1,650 @@
+package parts
+
+type resolveContext = int
+
+const (
+	//Result is resolved by whoever uses it, references can be loaded from slots
+	resolveValue resolveContext = iota
+	//Result is used as a name (assignment target, dot key)
+	resolveName
+)
+
+// resolverScope mirrors a single VMEnviroment of the running code
+type resolverScope struct {
+	//Slot of the variable, -1 when it's only reachable by name
+	Names map[string]int
+	Slots int
+
+	//Top level of the program, variables there stay in Values
+	Global bool
+
+	//Code that doesn't have to run (branches, loop condition) is resolved directly in this scope
+	Conditional int
+}
+
+// Resolver assigns slots to variables declared in blocks and function bodies,
+// VM reaches them by position (B_LOAD_LOCAL, B_STORE_LOCAL) instead of hashing
+// the name and walking every scope. Globals, variables of the callers (functions
+// don't capture anything) and code the resolver doesn't know keep using names,
+// locals are visible to those lookups as well.
+type Resolver struct {
+	Literals []*Literal
+
+	scopes []*resolverScope
+	floor  int
+}
+
+// Resolve returns code using slots for local variables, bodies of the functions
+// in literals are replaced as well. Code that can't be resolved is left as it is.
+func Resolve(code []Bytecode, literals []*Literal) []Bytecode {
+	r := Resolver{Literals: literals}
+
+	for _, literal := range literals {
+		if literal.LiteralType != FunLiteral {
+			continue
+		}
+
+		decl, ok := literal.Value.(FunctionDeclaration)
+
+		if !ok {
+			continue
+		}
+
+		if body, err := r.function(decl); err == nil {
+			decl.Body = body
+			literal.Value = decl
+		}
+	}
+
+	resolved, err := r.root(code, &resolverScope{Names: map[string]int{}, Global: true})
+
+	if err != nil {
+		return code
+	}
+
+	return resolved
+}
+
+// function resolves the body, arguments are the first slots of the call scope
+func (r *Resolver) function(decl FunctionDeclaration) ([]Bytecode, error) {
+	scope := &resolverScope{Names: map[string]int{}, Slots: len(decl.Params)}
+
+	//First one wins with repeated names, same as lookup by name
+	for idx := len(decl.Params) - 1; idx >= 0; idx-- {
+		scope.Names[decl.Params[idx]] = idx
+	}
+
+	return r.root(decl.Body, scope)
+}
+
+func (r *Resolver) root(code []Bytecode, scope *resolverScope) ([]Bytecode, error) {
+	r.scopes = []*resolverScope{scope}
+	r.floor = 0
+
+	return r.block(&checkCursor{Code: code}, len(code))
+}
+
+// block resolves statements up to end, scopes opened inside have to be closed there as well
+func (r *Resolver) block(cur *checkCursor, end int) ([]Bytecode, error) {
+	base, floor := len(r.scopes), r.floor
+
+	r.floor = base
+
+	defer func() { r.floor = floor }()
+
+	code := []Bytecode{}
+
+	for cur.Idx < end {
+		statement, err := r.statement(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		code = append(code, statement...)
+	}
+
+	if cur.Idx != end || len(r.scopes) != base {
+		return nil, errUnknownBytecode
+	}
+
+	return code, nil
+}
+
+// region resolves code that might not run, variables it declares in the current scope stay named
+func (r *Resolver) region(cur *checkCursor, length int) ([]Bytecode, error) {
+	if cur.Idx+length > len(cur.Code) {
+		return nil, errUnknownBytecode
+	}
+
+	scope := r.scopes[len(r.scopes)-1]
+
+	scope.Conditional++
+
+	defer func() { scope.Conditional-- }()
+
+	return r.block(cur, cur.Idx+length)
+}
+
+func (r *Resolver) statement(cur *checkCursor) ([]Bytecode, error) {
+	if cur.Code[cur.Idx] != B_DECLARE {
+		return r.expr(cur, resolveValue, true)
+	}
+
+	cur.Idx++
+
+	nameStart := cur.Idx
+
+	nameLiteral, err := r.readLiteral(cur)
+
+	if err != nil {
+		return nil, err
+	}
+
+	name, ok := nameLiteral.Value.(string)
+
+	if nameLiteral.LiteralType != RefLiteral || !ok {
+		return nil, errUnknownBytecode
+	}
+
+	nameCode := cur.Code[nameStart:cur.Idx]
+
+	value, err := r.expr(cur, resolveValue, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	scope := r.scopes[len(r.scopes)-1]
+
+	if _, declared := scope.Names[name]; declared || scope.Global || scope.Conditional > 0 {
+		if !declared {
+			scope.Names[name] = -1
+		}
+
+		return joinCode([]Bytecode{B_DECLARE}, nameCode, value), nil
+	}
+
+	slot := scope.Slots
+
+	scope.Names[name] = slot
+	scope.Slots++
+
+	return joinCode([]Bytecode{B_DECLARE_LOCAL}, mustEncodeLen(slot), nameCode, value), nil
+}
+
+func (r *Resolver) expr(cur *checkCursor, ctx resolveContext, unwind bool) ([]Bytecode, error) {
+	if cur.Idx >= len(cur.Code) {
+		return nil, errUnknownBytecode
+	}
+
+	op := cur.Code[cur.Idx]
+
+	switch op {
+	case B_LITERAL:
+		start := cur.Idx
+
+		literal, err := r.readLiteral(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if name, ok := literal.Value.(string); ok && ctx == resolveValue && literal.LiteralType == RefLiteral {
+			if depth, slot, found := r.lookup(name); found {
+				return joinCode([]Bytecode{B_LOAD_LOCAL}, mustEncodeLen(depth), mustEncodeLen(slot)), nil
+			}
+		}
+
+		return joinCode(cur.Code[start:cur.Idx]), nil
+	case B_BIN_OP:
+		if cur.Idx+1 >= len(cur.Code) {
+			return nil, errUnknownBytecode
+		}
+
+		binOp := cur.Code[cur.Idx+1]
+
+		cur.Idx += 2
+
+		left, err := r.expr(cur, resolveValue, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := r.expr(cur, resolveValue, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_BIN_OP, binOp}, left, right), nil
+	case B_DOT:
+		cur.Idx++
+
+		accessorStart := cur.Idx
+
+		accessor, err := r.expr(cur, resolveName, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		//Accessor is resolved right away, unless the field is assigned or the dot isn't unwound
+		if unwind && cur.Code[accessorStart] == B_LITERAL && cur.Idx < len(cur.Code) && cur.Code[cur.Idx] != B_SET {
+			cur.Idx = accessorStart
+
+			if accessor, err = r.expr(cur, resolveValue, false); err != nil {
+				return nil, err
+			}
+		}
+
+		tail, err := r.dotTail(cur, unwind)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_DOT}, accessor, tail), nil
+	case B_OPT_DOT:
+		cur.Idx++
+
+		accessor, err := r.expr(cur, resolveValue, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := cur.decodeLen()
+
+		if err != nil {
+			return nil, err
+		}
+
+		tail, err := r.conditional(cur, length, func() ([]Bytecode, error) { return r.dotTail(cur, true) })
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_OPT_DOT}, accessor, mustEncodeLen(len(tail)), tail), nil
+	case B_OPT_CHAIN:
+		cur.Idx++
+
+		length, err := cur.decodeLen()
+
+		if err != nil {
+			return nil, err
+		}
+
+		chain, err := r.conditional(cur, length, func() ([]Bytecode, error) { return r.expr(cur, ctx, unwind) })
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_OPT_CHAIN}, mustEncodeLen(len(chain)), chain), nil
+	case B_COALESCE:
+		cur.Idx++
+
+		left, err := r.expr(cur, resolveValue, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := cur.decodeLen()
+
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := r.conditional(cur, length, func() ([]Bytecode, error) { return r.expr(cur, ctx, unwind) })
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_COALESCE}, left, mustEncodeLen(len(right)), right), nil
+	case B_RESOLVE:
+		cur.Idx++
+
+		value, err := r.expr(cur, resolveValue, unwind)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_RESOLVE}, value), nil
+	case B_SET:
+		cur.Idx++
+
+		var target []Bytecode
+
+		if cur.Code[cur.Idx] == B_LITERAL {
+			start := cur.Idx
+
+			literal, err := r.readLiteral(cur)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if name, ok := literal.Value.(string); ok && literal.LiteralType == RefLiteral {
+				if depth, slot, found := r.lookup(name); found {
+					value, err := r.expr(cur, resolveValue, true)
+
+					if err != nil {
+						return nil, err
+					}
+
+					return joinCode([]Bytecode{B_STORE_LOCAL}, mustEncodeLen(depth), mustEncodeLen(slot), value), nil
+				}
+			}
+
+			target = cur.Code[start:cur.Idx]
+		} else {
+			var err error
+
+			if target, err = r.expr(cur, resolveName, false); err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := r.expr(cur, resolveValue, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_SET}, target, value), nil
+	case B_CALL:
+		cur.Idx++
+
+		callee, err := r.expr(cur, resolveValue, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		args, err := r.arguments(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_CALL}, callee, args), nil
+	case B_COND_JUMP:
+		cur.Idx++
+
+		condition, err := r.expr(cur, resolveValue, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		branches := [2][]Bytecode{}
+
+		for idx := range branches {
+			//Else branch is the length of the jump ending then branch
+			if idx == 1 && !cur.skip(B_JUMP) {
+				return nil, errUnknownBytecode
+			}
+
+			length, err := cur.decodeLen()
+
+			if err != nil {
+				return nil, err
+			}
+
+			if branches[idx], err = r.region(cur, length); err != nil {
+				return nil, err
+			}
+		}
+
+		return encodeCondJump(condition, branches[0], branches[1])
+	case B_LOOP:
+		start := cur.Idx
+
+		cur.Idx++
+
+		conditionLen, err := cur.decodeLen()
+
+		if err != nil {
+			return nil, err
+		}
+
+		condition, err := r.region(cur, conditionLen)
+
+		if err != nil {
+			return nil, err
+		}
+
+		bodyEnd, loopEnd, err := cur.loopBody(start)
+
+		if err != nil {
+			return nil, err
+		}
+
+		//Every iteration runs in its own scope, `it` is defined there for iterators
+		r.scopes = append(r.scopes, &resolverScope{Names: map[string]int{"it": -1}})
+
+		body, err := r.block(cur, bodyEnd)
+
+		if err != nil {
+			return nil, err
+		}
+
+		r.scopes = r.scopes[:len(r.scopes)-1]
+		cur.Idx = loopEnd
+
+		return encodeLoop(condition, body)
+	case B_YIELD, B_RAISE, B_RETURN:
+		cur.Idx++
+
+		value, err := r.expr(cur, resolveValue, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{op}, value), nil
+	case B_CONTINUE, B_BREAK, B_JUMP, B_JUMP_REV:
+		//Code around can move, break and continue are linked again by encodeLoop
+		return loopJump(cur)
+	case B_LINE:
+		start := cur.Idx
+		cur.Idx++
+
+		if _, err := cur.decodeLen(); err != nil {
+			return nil, err
+		}
+
+		return joinCode(cur.Code[start:cur.Idx]), nil
+	case B_NEW_SCOPE:
+		cur.Idx++
+
+		r.scopes = append(r.scopes, &resolverScope{Names: map[string]int{}})
+
+		return []Bytecode{op}, nil
+	case B_END_SCOPE:
+		if len(r.scopes) <= r.floor {
+			return nil, errUnknownBytecode
+		}
+
+		cur.Idx++
+
+		r.scopes = r.scopes[:len(r.scopes)-1]
+
+		return []Bytecode{op}, nil
+	case B_TYPE_HINT:
+		cur.Idx++
+
+		start := cur.Idx
+
+		if _, err := r.readLiteral(cur); err != nil {
+			return nil, err
+		}
+
+		hint := cur.Code[start:cur.Idx]
+
+		value, err := r.expr(cur, ctx, unwind)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_TYPE_HINT}, hint, value), nil
+	}
+
+	return nil, errUnknownBytecode
+}
+
+// dotTail resolves what follows the accessor of B_DOT, assignment, method call or the key
+func (r *Resolver) dotTail(cur *checkCursor, unwind bool) ([]Bytecode, error) {
+	if cur.Idx >= len(cur.Code) {
+		return nil, errUnknownBytecode
+	}
+
+	switch cur.Code[cur.Idx] {
+	case B_SET:
+		cur.Idx++
+
+		name, err := r.expr(cur, resolveName, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := r.expr(cur, resolveValue, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_SET}, name, value), nil
+	case B_CALL:
+		cur.Idx++
+
+		key, err := r.expr(cur, resolveName, unwind)
+
+		if err != nil {
+			return nil, err
+		}
+
+		args, err := r.arguments(cur)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return joinCode([]Bytecode{B_CALL}, key, args), nil
+	}
+
+	return r.expr(cur, resolveName, unwind)
+}
+
+// arguments resolves argument count followed by the arguments of the call
+func (r *Resolver) arguments(cur *checkCursor) ([]Bytecode, error) {
+	if cur.Idx >= len(cur.Code) {
+		return nil, errUnknownBytecode
+	}
+
+	count := cur.Code[cur.Idx]
+	code := []Bytecode{count}
+
+	cur.Idx++
+
+	for range count {
+		arg, err := r.expr(cur, resolveValue, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		code = append(code, arg...)
+	}
+
+	return code, nil
+}
+
+// conditional resolves single expression of known length that doesn't have to run
+func (r *Resolver) conditional(cur *checkCursor, length int, resolve func() ([]Bytecode, error)) ([]Bytecode, error) {
+	end := cur.Idx + length
+
+	if end > len(cur.Code) {
+		return nil, errUnknownBytecode
+	}
+
+	scope := r.scopes[len(r.scopes)-1]
+
+	scope.Conditional++
+
+	defer func() { scope.Conditional-- }()
+
+	code, err := resolve()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cur.Idx != end {
+		return nil, errUnknownBytecode
+	}
+
+	return code, nil
+}
+
+// lookup finds the slot of the variable, the depth is counted from the innermost scope
+func (r *Resolver) lookup(name string) (int, int, bool) {
+	for depth := range len(r.scopes) {
+		scope := r.scopes[len(r.scopes)-1-depth]
+
+		if scope.Global {
+			return 0, 0, false
+		}
+
+		if slot, ok := scope.Names[name]; ok {
+			return depth, slot, slot != -1
+		}
+	}
+
+	return 0, 0, false
+}
+
+func (r *Resolver) readLiteral(cur *checkCursor) (*Literal, error) {
+	if cur.Idx >= len(cur.Code) || cur.Code[cur.Idx] != B_LITERAL {
+		return nil, errUnknownBytecode
+	}
+
+	cur.Idx++
+
+	idx, err := cur.decodeLen()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if idx >= len(r.Literals) {
+		return nil, errUnknownBytecode
+	}
+
+	return r.Literals[idx], nil
+}
+
+// joinCode concatenates code into a new slice, parts are never appended to in place
+func joinCode(parts ...[]Bytecode) []Bytecode {
+	length := 0
+
+	for _, part := range parts {
+		length += len(part)
+	}
+
+	code := make([]Bytecode, 0, length)
+
+	for _, part := range parts {
+		code = append(code, part...)
+	}
+
+	return code
+}
@@ -11,6 +11,9 @@ import (
 )
 
 type ScannerRule struct {
+	//Name shown by the Profiler
+	Id string
+
 	Result     TokenType
 	BaseRule   func(r rune) bool
 	Rule       func(runs []rune) bool
@@ -23,6 +26,7 @@ type ScannerRule struct {
 func GetScannerRules() []ScannerRule {
 	return []ScannerRule{
 		{
+			Id:     "Operator",
 			Result: TokenOperator,
 			Process: func(mappings map[string]string, runs []rune) ([]Token, error) {
 				tokenValue := string(runs)
@@ -57,7 +61,7 @@ func GetScannerRules() []ScannerRule {
 
 				return retTokens, nil
 			},
-			ValidChars: []rune{'+', '-', '/', '*', ';', '[', ']', '(', ')', '{', '}', '.', ':', ',', '|', '&', '>', '<', '!', '#', '-', '=', '?', '%'},
+			ValidChars: []rune{'+', '-', '/', '*', ';', '[', ']', '(', ')', '{', '}', '.', ':', ',', '|', '&', '>', '<', '!', '#', '-', '=', '?', '%', '^'},
 			Mappings: map[string]string{
 				"+": "PLUS", "-": "MINUS", "/": "SLASH", "*": "STAR", "%": "MOD",
 				";": "SEMICOLON", ":": "COLON",
@@ -70,13 +74,19 @@ func GetScannerRules() []ScannerRule {
 				"#>": "META", "==": "EQUALITY",
 				"<": "LESS_THAN", ">": "MORE_THAN",
 				"<=": "LESS_EQ", ">=": "MORE_EQ",
+				"?.": "OPT_DOT", "??": "COALESCE", "?": "QUESTION",
+				"&": "BIT_AND", "|": "BIT_OR", "^": "BIT_XOR",
+				"<<": "SHIFT_LEFT", ">>": "SHIFT_RIGHT",
+				"**": "POW", "//": "FLOOR_DIV",
 			},
 		},
 		{
+			Id:       "Number",
 			Result:   TokenNumber,
 			BaseRule: func(r rune) bool { return r >= '0' && r <= '9' },
 		},
 		{
+			Id:     "Keyword",
 			Result: TokenKeyword,
 			BaseRule: func(r rune) bool {
 				return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_'
@@ -100,10 +110,11 @@ func GetScannerRules() []ScannerRule {
 				"fun": "", "return": "", "else": "", "for": "",
 				"import": "", "from": "", "as": "", "syntax": "",
 				"use": "", "raise": "", "break": "", "continue": "",
-				"translation": "",
+				"translation": "", "nil": "", "yield": "",
 			},
 		},
 		{
+			Id:     "Space",
 			Result: TokenSpace,
 			BaseRule: func(r rune) bool {
 				return unicode.IsSpace(r)
@@ -111,6 +122,7 @@ func GetScannerRules() []ScannerRule {
 			Skip: true,
 		},
 		{
+			Id:       "String",
 			Result:   TokenString,
 			BaseRule: func(r rune) bool { return true },
 			Rule: func(runs []rune) bool {
@@ -237,12 +249,14 @@ func GetParserRules() []ParserRule {
 					return []Bytecode{}, errors.New("expected '}' after syntax body")
 				}
 
-				vm, err := GetVMWithSource(stringLiteral.Value.(string), p.ModulePath)
+				vm, err := GetVMWithOptions(stringLiteral.Value.(string), p.ModulePath, CompileOptions{Debugger: p.Debugger})
 
 				if err != nil {
 					return []Bytecode{}, errors.Join(errors.New("got error when parsing syntax block code"), err)
 				}
 
+				vm.Profiler = p.Profiler
+
 				FillConsts(vm, p)
 
 				err = vm.Run()
@@ -265,47 +279,67 @@ func GetParserRules() []ParserRule {
 			AdvanceToken: true,
 			Rule:         func(p *Parser) bool { return p.check(TokenKeyword, "IMPORT") },
 			Parse: func(p *Parser) ([]Bytecode, error) {
-				if p.matchKeyword("SYNTAX") {
-					if !p.matchKeyword("FROM") {
-						return []Bytecode{}, errors.New("expected 'from' keyword after import syntax")
+				//Not a keyword so it still can be used as a name
+				if p.check(TokenIdentifier, "module") {
+					if _, err := p.advance(); err != nil {
+						return []Bytecode{}, errors.Join(errors.New("got error while advancing token"), err)
 					}
 
-					tempBytecode, err := p.parseWithRule("ParseStr")
+					moduleName, err := p.parseImportString()
 
 					if err != nil {
 						return []Bytecode{}, err
 					}
 
-					if tempBytecode[0] != B_LITERAL {
-						return []Bytecode{}, errors.New("expected string literal")
+					name := moduleName
+
+					if p.matchKeyword("AS") {
+						identifierToken, err := p.advance()
+
+						if err != nil {
+							return []Bytecode{}, errors.Join(errors.New("got error while advancing token"), err)
+						}
+
+						if identifierToken.Type != TokenIdentifier {
+							return []Bytecode{}, fmt.Errorf("got invalid token instead of identifier ( %d )", identifierToken.Type)
+						}
+
+						name = string(identifierToken.Value)
+					} else if !isIdentifier(moduleName) {
+						return []Bytecode{}, fmt.Errorf("module '%s' can't be used as variable name, add 'as name'", moduleName)
 					}
 
-					tempBytecode = tempBytecode[1:]
-					stringIdx := -1
-
-					switch tempBytecode[0] {
-					case 126:
-						stringIdx = int(tempBytecode[1])<<8 | int(tempBytecode[2])
-					case 127:
-						stringIdx = int(tempBytecode[1])<<56 | int(tempBytecode[2])<<48 |
-							int(tempBytecode[3])<<40 | int(tempBytecode[4])<<32 |
-							int(tempBytecode[5])<<24 | int(tempBytecode[6])<<16 |
-							int(tempBytecode[7])<<8 | int(tempBytecode[8])
-					default:
-						stringIdx = int(tempBytecode[0])
+					nameCode, err := p.AppendLiteral(Literal{LiteralType: RefLiteral, Value: name})
+
+					if err != nil {
+						return []Bytecode{}, errors.Join(errors.New("got error while encoding length"), err)
 					}
 
-					if stringIdx == -1 {
-						return []Bytecode{}, errors.New("expected string literal")
+					//Modules are looked up when the import runs so VM can register them after compiling
+					loaderCode, err := p.AppendLiteral(Literal{FunLiteral, NativeMethod{
+						Args: []string{},
+						Body: func(vm *VM, args []*Literal) (*Literal, error) {
+							return vm.importModule(moduleName)
+						},
+					}})
+
+					if err != nil {
+						return []Bytecode{}, errors.Join(errors.New("got error while encoding length"), err)
 					}
 
-					stringLiteral := p.Literals[stringIdx]
+					return append(append(append(append([]Bytecode{B_DECLARE}, nameCode...), B_CALL), loaderCode...), 0), nil
+				}
 
-					if stringLiteral.LiteralType != StringLiteral {
-						return []Bytecode{}, errors.New("expected string literal")
+				if p.matchKeyword("SYNTAX") {
+					if !p.matchKeyword("FROM") {
+						return []Bytecode{}, errors.New("expected 'from' keyword after import syntax")
 					}
 
-					source := stringLiteral.Value.(string)
+					source, err := p.parseImportString()
+
+					if err != nil {
+						return []Bytecode{}, err
+					}
 
 					if !p.matchKeyword("AS") {
 						return []Bytecode{}, errors.New("expected 'as' keyword after import path")
@@ -374,43 +408,12 @@ func GetParserRules() []ParserRule {
 						return []Bytecode{}, errors.New("expected 'from' keyword after import syntax")
 					}
 
-					tempBytecode, err := p.parseWithRule("ParseStr")
+					source, err := p.parseImportString()
 
 					if err != nil {
 						return []Bytecode{}, err
 					}
 
-					if tempBytecode[0] != B_LITERAL {
-						return []Bytecode{}, errors.New("expected string literal")
-					}
-
-					tempBytecode = tempBytecode[1:]
-					stringIdx := -1
-
-					switch tempBytecode[0] {
-					case 126:
-						stringIdx = int(tempBytecode[1])<<8 | int(tempBytecode[2])
-					case 127:
-						stringIdx = int(tempBytecode[1])<<56 | int(tempBytecode[2])<<48 |
-							int(tempBytecode[3])<<40 | int(tempBytecode[4])<<32 |
-							int(tempBytecode[5])<<24 | int(tempBytecode[6])<<16 |
-							int(tempBytecode[7])<<8 | int(tempBytecode[8])
-					default:
-						stringIdx = int(tempBytecode[0])
-					}
-
-					if stringIdx == -1 {
-						return []Bytecode{}, errors.New("expected string literal")
-					}
-
-					stringLiteral := p.Literals[stringIdx]
-
-					if stringLiteral.LiteralType != StringLiteral {
-						return []Bytecode{}, errors.New("expected string literal")
-					}
-
-					source := stringLiteral.Value.(string)
-
 					if !p.matchKeyword("AS") {
 						return []Bytecode{}, errors.New("expected 'as' keyword after import path")
 					}
@@ -449,6 +452,8 @@ func GetParserRules() []ParserRule {
 											return nil, errors.Join(errors.New("got error while running translation parser"), err)
 										}
 
+										tVM.Profiler = p.Profiler
+
 										FillConsts(tVM, p)
 
 										tVM.Enviroment.Define("data", args[0])
@@ -550,6 +555,22 @@ func GetParserRules() []ParserRule {
 
 				initialValue := []Bytecode{}
 
+				hint, err := p.parseTypeHint()
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(fmt.Errorf("got error while reading type of '%s'", string(identifierToken.Value)), err)
+				}
+
+				generator := p.matchOperator("STAR")
+
+				if generator && !p.check(TokenOperator, "LEFT_PAREN") {
+					return []Bytecode{}, errors.New("expected '(' after generator function name")
+				}
+
+				if hint.Name != "" && p.check(TokenOperator, "LEFT_PAREN") {
+					return []Bytecode{}, errors.New("function type annotation goes after params ('let f(): Int')")
+				}
+
 				if p.matchOperator("LEFT_PAREN") {
 					token, err := p.peek()
 
@@ -557,7 +578,7 @@ func GetParserRules() []ParserRule {
 						return []Bytecode{}, errors.Join(errors.New("got error while reading function params"), err)
 					}
 
-					declaration := FunctionDeclaration{Params: []string{}, Body: []Bytecode{}}
+					declaration := FunctionDeclaration{Params: []string{}, Body: []Bytecode{}, Generator: generator}
 
 					if token.Type != TokenOperator && string(token.Value) != "RIGHT_PAREN" {
 						for cond := true; cond; cond = p.matchOperator("COMMA") {
@@ -568,6 +589,14 @@ func GetParserRules() []ParserRule {
 							}
 
 							declaration.Params = append(declaration.Params, string(identifierToken.Value))
+
+							hint, err := p.parseTypeHint()
+
+							if err != nil {
+								return []Bytecode{}, errors.Join(fmt.Errorf("got error while reading type of param '%s'", string(identifierToken.Value)), err)
+							}
+
+							declaration.ParamTypes = append(declaration.ParamTypes, hint)
 						}
 					}
 
@@ -581,14 +610,25 @@ func GetParserRules() []ParserRule {
 						return []Bytecode{}, fmt.Errorf("expected ')' after function params got '%s'", string(token.Value))
 					}
 
+					if declaration.ReturnType, err = p.parseTypeHint(); err != nil {
+						return []Bytecode{}, errors.Join(errors.New("got error while reading return type"), err)
+					}
+
 					if p.matchOperator("EQUALS") {
+						//Expression body has no statements, debugger still needs a line to stop on in it
+						line, err := p.lineMarker()
+
+						if err != nil {
+							return []Bytecode{}, errors.Join(errors.New("encountered err in function body"), err)
+						}
+
 						expr, err := p.parse()
 
 						if err != nil {
 							return []Bytecode{}, errors.Join(errors.New("encountered err in function body"), err)
 						}
 
-						declaration.Body = append(append(declaration.Body, B_RETURN), expr...)
+						declaration.Body = joinCode(line, []Bytecode{B_RETURN}, expr)
 					} else {
 						body, err := p.parseWithRule("BlockExpr")
 
@@ -622,6 +662,16 @@ func GetParserRules() []ParserRule {
 					}
 
 					initialValue = rawVal
+
+					if hint.Name != "" {
+						hintCode, err := p.AppendLiteral(Literal{TypeHintLiteral, hint})
+
+						if err != nil {
+							return []Bytecode{}, errors.Join(errors.New("got error while writing literal offset"), err)
+						}
+
+						initialValue = append(append([]Bytecode{B_TYPE_HINT}, hintCode...), rawVal...)
+					}
 				}
 
 				return append(append([]Bytecode{B_DECLARE}, literalCode...), initialValue...), nil
@@ -658,6 +708,8 @@ func GetParserRules() []ParserRule {
 			AdvanceToken: true,
 			Rule:         func(p *Parser) bool { return p.check(TokenKeyword, "FUN") },
 			Parse: func(p *Parser) ([]Bytecode, error) {
+				generator := p.matchOperator("STAR")
+
 				if !p.matchOperator("LEFT_PAREN") {
 					token, err := p.peek()
 
@@ -674,7 +726,7 @@ func GetParserRules() []ParserRule {
 					return []Bytecode{}, errors.Join(errors.New("got error while reading function params"), err)
 				}
 
-				declaration := FunctionDeclaration{Params: []string{}, Body: []Bytecode{}}
+				declaration := FunctionDeclaration{Params: []string{}, Body: []Bytecode{}, Generator: generator}
 
 				if token.Type != TokenOperator && string(token.Value) != "RIGHT_PAREN" {
 					for cond := true; cond; cond = p.matchOperator("COMMA") {
@@ -689,6 +741,14 @@ func GetParserRules() []ParserRule {
 						}
 
 						declaration.Params = append(declaration.Params, string(identifierToken.Value))
+
+						hint, err := p.parseTypeHint()
+
+						if err != nil {
+							return []Bytecode{}, errors.Join(fmt.Errorf("got error while reading type of param '%s'", string(identifierToken.Value)), err)
+						}
+
+						declaration.ParamTypes = append(declaration.ParamTypes, hint)
 					}
 				}
 
@@ -702,14 +762,24 @@ func GetParserRules() []ParserRule {
 					return []Bytecode{}, fmt.Errorf("expected ')' after function params got '%s'", string(token.Value))
 				}
 
+				if declaration.ReturnType, err = p.parseTypeHint(); err != nil {
+					return []Bytecode{}, errors.Join(errors.New("got error while reading return type"), err)
+				}
+
 				if p.matchOperator("EQUALS") {
+					line, err := p.lineMarker()
+
+					if err != nil {
+						return []Bytecode{}, errors.Join(errors.New("encountered err in function body"), err)
+					}
+
 					expr, err := p.parse()
 
 					if err != nil {
 						return []Bytecode{}, errors.Join(errors.New("encountered err in function body"), err)
 					}
 
-					declaration.Body = append([]Bytecode{B_RETURN}, expr...)
+					declaration.Body = joinCode(line, []Bytecode{B_RETURN}, expr)
 				} else {
 					body, err := p.parseWithRule("BlockExpr")
 
@@ -734,6 +804,8 @@ func GetParserRules() []ParserRule {
 			AdvanceToken: true,
 			Rule:         func(p *Parser) bool { return p.check(TokenKeyword, "IF") },
 			Parse: func(p *Parser) ([]Bytecode, error) {
+				p.Coverage.branchPoint(p.Source, p.line)
+
 				condition, err := p.parse()
 
 				if err != nil {
@@ -746,14 +818,7 @@ func GetParserRules() []ParserRule {
 					return []Bytecode{}, errors.Join(errors.New("got error while parsing expression (resolving then branch)"), err)
 				}
 
-				thenLength, err := encodeLen(len(thenBranch))
-
-				if err != nil {
-					return []Bytecode{}, errors.Join(errors.New("got error while encoding length expression (encoding then branch)"), err)
-				}
-
 				elseBranch := []Bytecode{}
-				elseLength := []Bytecode{0}
 
 				if p.matchKeyword("ELSE") {
 					elseBranch, err = p.parse()
@@ -761,15 +826,15 @@ func GetParserRules() []ParserRule {
 					if err != nil {
 						return []Bytecode{}, errors.Join(errors.New("got error while parsing expression (resolving else branch)"), err)
 					}
+				}
 
-					elseLength, err = encodeLen(len(elseBranch))
+				code, err := encodeCondJump(condition, thenBranch, elseBranch)
 
-					if err != nil {
-						return []Bytecode{}, errors.Join(errors.New("got error while encoding length expression (encoding else branch)"), err)
-					}
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("got error while encoding length expression (encoding branches)"), err)
 				}
 
-				return append(append(append(append(append([]Bytecode{B_COND_JUMP}, condition...), thenLength...), thenBranch...), elseLength...), elseBranch...), nil
+				return code, nil
 			},
 		},
 		{
@@ -777,20 +842,19 @@ func GetParserRules() []ParserRule {
 			AdvanceToken: true,
 			Rule:         func(p *Parser) bool { return p.check(TokenKeyword, "FOR") },
 			Parse: func(p *Parser) ([]Bytecode, error) {
-				var loopCondition []Bytecode
+				p.Coverage.branchPoint(p.Source, p.line)
 
-				btc, err := p.parse()
+				//`for { ... }` loops until break
+				loopCondition := []Bytecode{B_LITERAL, 1}
 
-				if err != nil {
-					return []Bytecode{}, errors.Join(errors.New("got error while parsing loop condition"), err)
-				}
+				if !p.check(TokenOperator, "LEFT_BRACE") {
+					btc, err := p.parse()
 
-				loopCondition = btc
-
-				conditionLength, err := encodeLen(len(loopCondition))
+					if err != nil {
+						return []Bytecode{}, errors.Join(errors.New("got error while parsing loop condition"), err)
+					}
 
-				if err != nil {
-					return []Bytecode{}, errors.Join(errors.New("got error while encoding length expression (encoding for body)"), err)
+					loopCondition = btc
 				}
 
 				forBody, err := p.parse()
@@ -799,13 +863,13 @@ func GetParserRules() []ParserRule {
 					return []Bytecode{}, errors.Join(errors.New("got error while parsing loop body"), err)
 				}
 
-				bodyLength, err := encodeLen(len(forBody))
+				loop, err := encodeLoop(loopCondition, forBody)
 
 				if err != nil {
 					return []Bytecode{}, errors.Join(errors.New("got error while encoding length expression (encoding for body)"), err)
 				}
 
-				return append(append(append(append([]Bytecode{B_LOOP}, conditionLength...), loopCondition...), bodyLength...), forBody...), nil
+				return loop, nil
 			},
 		},
 		{
@@ -826,6 +890,14 @@ func GetParserRules() []ParserRule {
 						break
 					}
 
+					line, err := p.lineMarker()
+
+					if err != nil {
+						return []Bytecode{}, errors.Join(errors.New("got error while parsing block body"), err)
+					}
+
+					body = append(body, line...)
+
 					statement, err := p.parse()
 
 					if err != nil {
@@ -870,12 +942,26 @@ func GetParserRules() []ParserRule {
 				return append([]Bytecode{B_RAISE}, expr...), nil
 			},
 		},
+		{
+			Id:           "YieldExpr",
+			AdvanceToken: true,
+			Rule:         func(p *Parser) bool { return p.check(TokenKeyword, "YIELD") },
+			Parse: func(p *Parser) ([]Bytecode, error) {
+				expr, err := p.parse()
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("got error while parsing yield value"), err)
+				}
+
+				return append([]Bytecode{B_YIELD}, expr...), nil
+			},
+		},
 		{
 			Id:           "BreakExpr",
 			AdvanceToken: true,
 			Rule:         func(p *Parser) bool { return p.check(TokenKeyword, "BREAK") },
 			Parse: func(p *Parser) ([]Bytecode, error) {
-				return []Bytecode{B_BREAK}, nil
+				return jumpMarker(B_BREAK), nil
 			},
 		},
 		{
@@ -883,7 +969,7 @@ func GetParserRules() []ParserRule {
 			AdvanceToken: true,
 			Rule:         func(p *Parser) bool { return p.check(TokenKeyword, "CONTINUE") },
 			Parse: func(p *Parser) ([]Bytecode, error) {
-				return []Bytecode{B_CONTINUE}, nil
+				return jumpMarker(B_CONTINUE), nil
 			},
 		},
 		{
@@ -898,6 +984,20 @@ func GetParserRules() []ParserRule {
 			Rule:         func(p *Parser) bool { return p.check(TokenKeyword, "TRUE") },
 			Parse:        func(p *Parser) ([]Bytecode, error) { return []Bytecode{B_LITERAL, 1}, nil },
 		},
+		{
+			Id:           "NilExpr",
+			AdvanceToken: true,
+			Rule:         func(p *Parser) bool { return p.check(TokenKeyword, "NIL") },
+			Parse: func(p *Parser) ([]Bytecode, error) {
+				literalIdx, err := p.AppendLiteral(Literal{LiteralType: NilLiteral, Value: nil})
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("got error while encoding length"), err)
+				}
+
+				return literalIdx, nil
+			},
+		},
 		{
 			Id: "ParseNum",
 			Rule: func(p *Parser) bool {
@@ -1144,6 +1244,52 @@ func GetPostFixRules() []PostFixRule {
 				return append(append([]Bytecode{B_DOT}, code...), accessor...), nil
 			},
 		},
+		{
+			Id:           "OptDotExpr",
+			AdvanceToken: true,
+			Rule:         func(p *Parser) bool { return p.check(TokenOperator, "OPT_DOT") },
+			Parse: func(p *Parser, code []Bytecode) ([]Bytecode, error) {
+				identifierToken, err := p.advance()
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("got error while advancing token"), err)
+				}
+
+				if identifierToken.Type != TokenIdentifier {
+					return []Bytecode{}, fmt.Errorf("expected identifier after '?.' got ( %d )", identifierToken.Type)
+				}
+
+				accessor, err := p.AppendLiteral(Literal{
+					LiteralType: RefLiteral,
+					Value:       string(identifierToken.Value),
+				})
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("got error while encoding length"), err)
+				}
+
+				accessorLength, err := encodeLen(len(accessor))
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("got error while encoding length expression (optional dot)"), err)
+				}
+
+				//Rest of the chain is skipped as well when the value is nil
+				chain, err := p.parseChain(append(append(append([]Bytecode{B_OPT_DOT}, code...), accessorLength...), accessor...), "DotExpr", "OptDotExpr", "ArrIndex", "FunCall")
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("got error while parsing optional chain"), err)
+				}
+
+				chainLength, err := encodeLen(len(chain))
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("got error while encoding length expression (optional chain)"), err)
+				}
+
+				return append(append([]Bytecode{B_OPT_CHAIN}, chainLength...), chain...), nil
+			},
+		},
 		{
 			Id:           "ArrIndex",
 			AdvanceToken: true,
@@ -1320,6 +1466,124 @@ func GetPostFixRules() []PostFixRule {
 				return append(append([]Bytecode{B_BIN_OP, B_OP_MOD}, code...), elt...), nil
 			},
 		},
+		{
+			Id:           "BitAndOp",
+			AdvanceToken: true,
+			Rule:         func(p *Parser) bool { return p.check(TokenOperator, "BIT_AND") },
+			Parse: func(p *Parser, code []Bytecode) ([]Bytecode, error) {
+				elt, err := p.parse()
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("expected expression, got error"), err)
+				}
+
+				return append(append([]Bytecode{B_BIN_OP, B_OP_BIT_AND}, code...), elt...), nil
+			},
+		},
+		{
+			Id:           "BitOrOp",
+			AdvanceToken: true,
+			Rule:         func(p *Parser) bool { return p.check(TokenOperator, "BIT_OR") },
+			Parse: func(p *Parser, code []Bytecode) ([]Bytecode, error) {
+				elt, err := p.parse()
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("expected expression, got error"), err)
+				}
+
+				return append(append([]Bytecode{B_BIN_OP, B_OP_BIT_OR}, code...), elt...), nil
+			},
+		},
+		{
+			Id:           "BitXorOp",
+			AdvanceToken: true,
+			Rule:         func(p *Parser) bool { return p.check(TokenOperator, "BIT_XOR") },
+			Parse: func(p *Parser, code []Bytecode) ([]Bytecode, error) {
+				elt, err := p.parse()
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("expected expression, got error"), err)
+				}
+
+				return append(append([]Bytecode{B_BIN_OP, B_OP_BIT_XOR}, code...), elt...), nil
+			},
+		},
+		{
+			Id:           "ShlOp",
+			AdvanceToken: true,
+			Rule:         func(p *Parser) bool { return p.check(TokenOperator, "SHIFT_LEFT") },
+			Parse: func(p *Parser, code []Bytecode) ([]Bytecode, error) {
+				elt, err := p.parse()
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("expected expression, got error"), err)
+				}
+
+				return append(append([]Bytecode{B_BIN_OP, B_OP_SHL}, code...), elt...), nil
+			},
+		},
+		{
+			Id:           "ShrOp",
+			AdvanceToken: true,
+			Rule:         func(p *Parser) bool { return p.check(TokenOperator, "SHIFT_RIGHT") },
+			Parse: func(p *Parser, code []Bytecode) ([]Bytecode, error) {
+				elt, err := p.parse()
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("expected expression, got error"), err)
+				}
+
+				return append(append([]Bytecode{B_BIN_OP, B_OP_SHR}, code...), elt...), nil
+			},
+		},
+		{
+			Id:           "PowOp",
+			AdvanceToken: true,
+			Rule:         func(p *Parser) bool { return p.check(TokenOperator, "POW") },
+			Parse: func(p *Parser, code []Bytecode) ([]Bytecode, error) {
+				elt, err := p.parse()
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("expected expression, got error"), err)
+				}
+
+				return append(append([]Bytecode{B_BIN_OP, B_OP_POW}, code...), elt...), nil
+			},
+		},
+		{
+			Id:           "FloorDivOp",
+			AdvanceToken: true,
+			Rule:         func(p *Parser) bool { return p.check(TokenOperator, "FLOOR_DIV") },
+			Parse: func(p *Parser, code []Bytecode) ([]Bytecode, error) {
+				elt, err := p.parse()
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("expected expression, got error"), err)
+				}
+
+				return append(append([]Bytecode{B_BIN_OP, B_OP_FLOOR_DIV}, code...), elt...), nil
+			},
+		},
+		{
+			Id:           "CoalesceOp",
+			AdvanceToken: true,
+			Rule:         func(p *Parser) bool { return p.check(TokenOperator, "COALESCE") },
+			Parse: func(p *Parser, code []Bytecode) ([]Bytecode, error) {
+				elt, err := p.parse()
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("expected expression, got error"), err)
+				}
+
+				eltLength, err := encodeLen(len(elt))
+
+				if err != nil {
+					return []Bytecode{}, errors.Join(errors.New("got error while encoding length expression (coalesce)"), err)
+				}
+
+				return append(append(append([]Bytecode{B_COALESCE}, code...), eltLength...), elt...), nil
+			},
+		},
 		{
 			Id:           "FunCall",
 			AdvanceToken: true,
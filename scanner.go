@@ -3,15 +3,21 @@ package parts
 import (
 	"fmt"
 	"slices"
+	"strings"
 )
 
 type Scanner struct {
 	Rules  []ScannerRule
 	Source []rune
 	Index  int
-	Line   int
+
+	//Newlines consumed so far
+	Line int
 
 	Buffored []Token
+
+	//Nil when not profiling
+	Profiler *Profiler
 }
 
 func (s *Scanner) Next() (Token, error) {
@@ -83,7 +89,7 @@ func (s *Scanner) Next() (Token, error) {
 		return Token{Type: TokenInvalid, Value: []rune("EOF")}, nil
 	}
 
-	return Token{}, fmt.Errorf("unknown token %s [%d, pos> %d:%d]", string(s.Peek()), s.Peek(), s.Line, s.Index)
+	return Token{}, fmt.Errorf("unknown token %s [%d, pos> %d:%d]", string(s.Peek()), s.Peek(), s.Line+1, s.Index)
 }
 
 func (s *Scanner) Peek() rune {
@@ -95,7 +101,14 @@ func (s *Scanner) Peek() rune {
 }
 
 func (s *Scanner) ParseRule(rule ScannerRule) ([]Token, error) {
+	s.Profiler.enter(ProfileScannerRule, rule.Id)
+
+	defer s.Profiler.exit()
+
 	start := s.Index
+	line := s.Line + 1
+
+	defer func() { s.Line += strings.Count(string(s.Source[start:s.Index]), "\n") }()
 
 	for {
 		s.Index++
@@ -118,10 +131,16 @@ func (s *Scanner) ParseRule(rule ScannerRule) ([]Token, error) {
 			return []Token{}, err
 		}
 
+		for idx := range res {
+			if res[idx].Line == 0 {
+				res[idx].Line = line
+			}
+		}
+
 		return res, nil
 	}
 
-	return []Token{{Type: rule.Result, Value: s.Source[start:s.Index]}}, nil
+	return []Token{{Type: rule.Result, Value: s.Source[start:s.Index], Line: line}}, nil
 }
 
 func (s *Scanner) CheckBounds(msg string) error {
@@ -125,6 +125,47 @@ func TestScannerLetStatement(t *testing.T) {
 	}
 }
 
+func TestScannerBitwiseOperators(t *testing.T) {
+	scanner := GetScannerWithSource("a & b | c ^ d << 1 >> 2 ** 3 // 4")
+
+	expectedTokens := []Token{
+		{Type: TokenIdentifier, Value: []rune("a")},
+		{Type: TokenOperator, Value: []rune("BIT_AND")},
+		{Type: TokenIdentifier, Value: []rune("b")},
+		{Type: TokenOperator, Value: []rune("BIT_OR")},
+		{Type: TokenIdentifier, Value: []rune("c")},
+		{Type: TokenOperator, Value: []rune("BIT_XOR")},
+		{Type: TokenIdentifier, Value: []rune("d")},
+		{Type: TokenOperator, Value: []rune("SHIFT_LEFT")},
+		{Type: TokenNumber, Value: []rune("1")},
+		{Type: TokenOperator, Value: []rune("SHIFT_RIGHT")},
+		{Type: TokenNumber, Value: []rune("2")},
+		{Type: TokenOperator, Value: []rune("POW")},
+		{Type: TokenNumber, Value: []rune("3")},
+		{Type: TokenOperator, Value: []rune("FLOOR_DIV")},
+		{Type: TokenNumber, Value: []rune("4")},
+	}
+
+	for _, curr := range expectedTokens {
+		token, err := scanner.Next()
+
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+			return
+		}
+
+		if string(token.Value) != string(curr.Value) {
+			t.Errorf("token values don't match: %s != %s", string(token.Value), string(curr.Value))
+			return
+		}
+
+		if token.Type != curr.Type {
+			t.Errorf("token types don't match: %d != %d", token.Type, curr.Type)
+			return
+		}
+	}
+}
+
 func TestEmptyParen(t *testing.T) {
 	scanner := GetScannerWithSource("();")
 
@@ -0,0 +1,598 @@
+package parts
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema describes value a script should define, schema of the whole script
+// has the globals in Fields. It's read from Parts with ParseSchema or derived
+// from Go struct with SchemaFor.
+type Schema struct {
+	//Type name as in annotations ("Int", "String?") or "Number" for Int and Double, empty accepts anything
+	Type string `parts:"type"`
+
+	//Missing value is reported, nil counts as a value (use non nullable Type to reject it)
+	Required bool `parts:"required"`
+
+	//Bounds of numbers, lengths of strings and lists
+	Min *float64 `parts:"min"`
+	Max *float64 `parts:"max"`
+
+	//Allowed values, compared like `==`
+	Enum []any `parts:"enum"`
+
+	//Schema of every list element
+	Items *Schema `parts:"items"`
+	//Schema of known object fields, other fields are allowed
+	Fields map[string]*Schema `parts:"fields"`
+	//Schema of every object value, for objects used as maps
+	Values *Schema `parts:"values"`
+}
+
+// Violation is single problem found while validating, Line is 0 when it's not known
+type Violation struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Line == 0 {
+		return fmt.Sprintf("%s: %s", v.Path, v.Message)
+	}
+
+	return fmt.Sprintf("%d: %s: %s", v.Line, v.Path, v.Message)
+}
+
+// ValidationError lists every violation found, ordered by path
+type ValidationError struct {
+	Source     string
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Violations))
+
+	for idx, violation := range e.Violations {
+		lines[idx] = violation.String()
+
+		if e.Source != "" && violation.Line != 0 {
+			lines[idx] = e.Source + ":" + lines[idx]
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// UnmarshalParts lets schemas written in Parts use just the type name (`items: "Int"`)
+func (s *Schema) UnmarshalParts(value *Literal) error {
+	if value.LiteralType == StringLiteral {
+		*s = Schema{Type: value.Value.(string)}
+
+		return nil
+	}
+
+	//Without the method, so it doesn't call itself
+	type plainSchema Schema
+
+	d := decoder{}
+
+	return d.decode("", value, reflect.ValueOf((*plainSchema)(s)).Elem())
+}
+
+// ParseSchema runs the source, every global it declares is schema of the global with the same name
+func ParseSchema(source, modulePath string) (*Schema, error) {
+	vm, err := GetVMWithSource(source, modulePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = vm.Run(); err != nil {
+		return nil, errors.Join(errors.New("got error while running schema"), err)
+	}
+
+	schema := &Schema{Fields: make(map[string]*Schema)}
+
+	for key, value := range vm.Enviroment.Values {
+		name, ok := strings.CutPrefix(key, "RT")
+
+		if !ok {
+			continue
+		}
+
+		field := &Schema{}
+
+		if err := (&decoder{vm: vm}).decode(name, value, reflect.ValueOf(field).Elem()); err != nil {
+			return nil, errors.Join(errors.New("got error while reading schema"), err)
+		}
+
+		schema.Fields[name] = field
+	}
+
+	if err := schema.check(""); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+// check verifies type names and bounds of schema read from Parts
+func (s *Schema) check(path string) error {
+	if s.Type != "" {
+		if name := strings.TrimSuffix(s.Type, "?"); name != "Number" {
+			if _, err := ParseTypeHint(s.Type); err != nil {
+				return &UnmarshalError{Path: path, Err: err}
+			}
+		}
+	}
+
+	if s.Min != nil && s.Max != nil && *s.Min > *s.Max {
+		return &UnmarshalError{Path: path, Err: fmt.Errorf("min %v is bigger than max %v", *s.Min, *s.Max)}
+	}
+
+	if s.Items != nil {
+		if err := s.Items.check(path + "[]"); err != nil {
+			return err
+		}
+	}
+
+	if s.Values != nil {
+		if err := s.Values.check(path + "[]"); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range sortedKeys(s.Fields) {
+		if err := s.Fields[name].check(childPath(path, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SchemaFor derives schema from struct the same way Unmarshal reads it, `parts`
+// tags can have min=, max= and enum= (values separated by '|') options next to required
+func SchemaFor(v any) (*Schema, error) {
+	t := reflect.TypeOf(v)
+
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected struct got %T", v)
+	}
+
+	schema := &Schema{Fields: make(map[string]*Schema)}
+
+	if err := schemaFields(t, schema.Fields, make(map[reflect.Type]*Schema)); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+func schemaFields(t reflect.Type, fields map[string]*Schema, seen map[reflect.Type]*Schema) error {
+	for i := range t.NumField() {
+		field := t.Field(i)
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		options := tagOptions("")
+
+		if tag, has := field.Tag.Lookup("parts"); has {
+			var tagName string
+
+			tagName, options = parseTag(tag)
+
+			if tagName == "-" {
+				continue
+			} else if tagName != "" {
+				name = tagName
+			}
+		}
+
+		//Embedded struct without a name has it's fields next to the others
+		if field.Anonymous && name == field.Name && field.Type.Kind() == reflect.Struct {
+			if err := schemaFields(field.Type, fields, seen); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		schema, err := schemaForType(field.Type, seen)
+
+		if err != nil {
+			return err
+		}
+
+		//Tag options belong to this field only
+		fieldSchema := *schema
+		fieldSchema.Required = options.Contains("required")
+
+		if options.Contains("omitempty") && fieldSchema.Type != "" && !strings.HasSuffix(fieldSchema.Type, "?") {
+			fieldSchema.Type += "?"
+		}
+
+		if err := fieldSchema.applyTag(options, field.Type); err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name(), field.Name, err)
+		}
+
+		fields[name] = &fieldSchema
+	}
+
+	return nil
+}
+
+func schemaForType(t reflect.Type, seen map[reflect.Type]*Schema) (*Schema, error) {
+	if schema, ok := seen[t]; ok {
+		return schema, nil
+	}
+
+	//Types that read themselves accept anything Unmarshal would pass them
+	if t == durationType || reflect.PointerTo(t).Implements(unmarshalerType) {
+		return &Schema{}, nil
+	}
+
+	if reflect.PointerTo(t).Implements(textType) {
+		return &Schema{Type: "String"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem, err := schemaForType(t.Elem(), seen)
+
+		if err != nil {
+			return nil, err
+		}
+
+		schema := *elem
+
+		if schema.Type != "" && !strings.HasSuffix(schema.Type, "?") {
+			schema.Type += "?"
+		}
+
+		return &schema, nil
+	case reflect.Bool:
+		return &Schema{Type: "Bool"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "Int"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0.0
+
+		return &Schema{Type: "Int", Min: &zero}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "Number"}, nil
+	case reflect.String:
+		return &Schema{Type: "String"}, nil
+	case reflect.Func:
+		return &Schema{Type: "Fun"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaForType(t.Elem(), seen)
+
+		if err != nil {
+			return nil, err
+		}
+
+		schema := &Schema{Type: "List", Items: items}
+
+		if t.Kind() == reflect.Array {
+			length := float64(t.Len())
+			schema.Max = &length
+		}
+
+		return schema, nil
+	case reflect.Map:
+		values, err := schemaForType(t.Elem(), seen)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Schema{Type: "Object", Values: values}, nil
+	case reflect.Struct:
+		//Added before the fields, so recursive types point to the same schema
+		schema := &Schema{Type: "Object", Fields: make(map[string]*Schema)}
+		seen[t] = schema
+
+		if err := schemaFields(t, schema.Fields, seen); err != nil {
+			return nil, err
+		}
+
+		return schema, nil
+	}
+
+	return &Schema{}, nil
+}
+
+// applyTag reads min=, max= and enum= options of the field
+func (s *Schema) applyTag(options tagOptions, t reflect.Type) error {
+	for _, bound := range []struct {
+		name  string
+		value **float64
+	}{{"min", &s.Min}, {"max", &s.Max}} {
+		text, has := options.Value(bound.name)
+
+		if !has {
+			continue
+		}
+
+		n, err := strconv.ParseFloat(text, 64)
+
+		if err != nil {
+			return fmt.Errorf("invalid %s option '%s'", bound.name, text)
+		}
+
+		*bound.value = &n
+	}
+
+	text, has := options.Value("enum")
+
+	if !has {
+		return nil
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	s.Enum = nil
+
+	for _, option := range strings.Split(text, "|") {
+		var value any = option
+		var err error
+
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value, err = strconv.Atoi(option)
+		case reflect.Float32, reflect.Float64:
+			value, err = strconv.ParseFloat(option, 64)
+		case reflect.Bool:
+			value, err = strconv.ParseBool(option)
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid enum value '%s' for %s", option, t)
+		}
+
+		s.Enum = append(s.Enum, value)
+	}
+
+	return nil
+}
+
+// Validate runs the source and checks globals it declared, lines the globals
+// were declared at are in the violations
+func (s *Schema) Validate(source, modulePath string) error {
+	vm, err := GetVMWithOptions(source, modulePath, CompileOptions{Lines: true})
+
+	if err != nil {
+		return err
+	}
+
+	if err = vm.Run(); err != nil {
+		return err
+	}
+
+	return s.ValidateVM(vm)
+}
+
+// ValidateVM checks globals of VM that already ran, lines are only known when it was compiled with them.
+// Every problem found is returned as *ValidationError.
+func (s *Schema) ValidateVM(vm *VM) error {
+	v := validator{vm: vm}
+
+	for _, name := range sortedKeys(s.Fields) {
+		field := s.Fields[name]
+		value, ok := vm.Enviroment.Values["RT"+name]
+
+		if !ok {
+			if field.Required {
+				v.report(name, "required value is missing")
+			}
+
+			continue
+		}
+
+		simplified, err := vm.simplifyLiteral(value, true)
+
+		if err != nil {
+			v.report(name, "%s", err)
+
+			continue
+		}
+
+		v.validate(name, simplified, field)
+	}
+
+	if len(v.violations) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Source: vm.Source, Violations: v.violations}
+}
+
+type validator struct {
+	vm         *VM
+	violations []Violation
+}
+
+func (v *validator) report(path string, format string, args ...any) {
+	v.violations = append(v.violations, Violation{Path: path, Line: v.line(path), Message: fmt.Sprintf(format, args...)})
+}
+
+// line the global containing the value was declared at, 0 when it's unknown
+func (v *validator) line(path string) int {
+	if end := strings.IndexAny(path, ".["); end != -1 {
+		path = path[:end]
+	}
+
+	return v.vm.Declared["RT"+path]
+}
+
+func (v *validator) validate(path string, value *Literal, schema *Schema) {
+	if !schema.accepts(value) {
+		v.report(path, "expected %s got %s", schema.Type, TypeHintOf(value))
+
+		return
+	}
+
+	if value.LiteralType == NilLiteral {
+		return
+	}
+
+	if len(schema.Enum) > 0 && !schema.inEnum(value) {
+		options := make([]string, len(schema.Enum))
+
+		for idx, option := range schema.Enum {
+			options[idx] = fmt.Sprint(option)
+		}
+
+		v.report(path, "expected one of %s got %s", strings.Join(options, ", "), value.pretify())
+	}
+
+	v.bounds(path, value, schema)
+
+	switch value.LiteralType {
+	case ParsedListLiteral:
+		if schema.Items == nil {
+			return
+		}
+
+		for idx, item := range listValues(value.Value.(PartsIndexable)) {
+			v.validate(fmt.Sprintf("%s[%d]", path, idx), item, schema.Items)
+		}
+	case ParsedObjLiteral:
+		obj := value.Value.(PartsIndexable)
+
+		for _, name := range sortedKeys(schema.Fields) {
+			field := schema.Fields[name]
+			fieldPath := childPath(path, name)
+
+			if obj.HasByKey("RT" + name) {
+				v.validate(fieldPath, obj.GetByKey("RT"+name), field)
+			} else if obj.HasByKey("ST" + name) {
+				v.validate(fieldPath, obj.GetByKey("ST"+name), field)
+			} else if field.Required {
+				v.report(fieldPath, "required value is missing")
+			}
+		}
+
+		if schema.Values == nil {
+			return
+		}
+
+		for _, key := range objectKeys(obj) {
+			v.validate(childPath(path, keyLiteral(key).pretify()), obj.GetByKey(key), schema.Values)
+		}
+	}
+}
+
+// bounds checks Min and Max against numbers and lengths of strings and lists
+func (v *validator) bounds(path string, value *Literal, schema *Schema) {
+	if schema.Min == nil && schema.Max == nil {
+		return
+	}
+
+	what := "value"
+	n, ok := value.asFloat()
+
+	switch value.LiteralType {
+	case StringLiteral:
+		what, n, ok = "length", float64(utf8.RuneCountInString(value.Value.(string))), true
+	case ParsedListLiteral:
+		what, n, ok = "length", float64(len(listValues(value.Value.(PartsIndexable)))), true
+	}
+
+	if !ok {
+		return
+	}
+
+	if schema.Min != nil && n < *schema.Min {
+		v.report(path, "%s %v is less than minimum %v", what, n, *schema.Min)
+	}
+
+	if schema.Max != nil && n > *schema.Max {
+		v.report(path, "%s %v is more than maximum %v", what, n, *schema.Max)
+	}
+}
+
+func (s *Schema) accepts(value *Literal) bool {
+	name, nullable := strings.CutSuffix(s.Type, "?")
+
+	if name != "Number" {
+		return TypeHint{Name: name, Nullable: nullable}.Accepts(TypeHintOf(value))
+	}
+
+	switch value.LiteralType {
+	case IntLiteral, DoubleLiteral:
+		return true
+	case NilLiteral:
+		return nullable
+	}
+
+	return false
+}
+
+func (s *Schema) inEnum(value *Literal) bool {
+	for _, option := range s.Enum {
+		literal, err := LiteralFromGo(option)
+
+		if err != nil {
+			continue
+		}
+
+		//Enums read from Parts or tags can have Int where Double is expected
+		if a, ok := literal.asFloat(); ok {
+			if b, ok := value.asFloat(); ok && a == b {
+				return true
+			}
+
+			continue
+		}
+
+		if equal, err := value.opEq(literal); err == nil && equal.Value.(bool) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// childPath is path of the object field, like paths in UnmarshalError
+func childPath(path, name string) string {
+	if !isIdentifier(name) {
+		return fmt.Sprintf("%s[%s]", path, name)
+	}
+
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
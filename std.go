@@ -5,23 +5,21 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"sort"
 	"strconv"
-	"strings"
 )
 
 var StandardLibrary = map[string]*Literal{
 	"RTprint": {FunLiteral, NativeMethod{
 		Args: []string{"arg"},
 		Body: func(vm *VM, args []*Literal) (*Literal, error) {
-			fmt.Print(args[0].pretify())
+			fmt.Print(args[0].pretifyWith(vm))
 			return nil, nil
 		},
 	}},
 	"RTprintLn": {FunLiteral, NativeMethod{
 		Args: []string{"arg"},
 		Body: func(vm *VM, args []*Literal) (*Literal, error) {
-			fmt.Println(args[0].pretify())
+			fmt.Println(args[0].pretifyWith(vm))
 			return nil, nil
 		},
 	}},
@@ -38,175 +36,7 @@ var StandardLibrary = map[string]*Literal{
 			return &Literal{StringLiteral, text}, nil
 		},
 	}},
-	"RTArray": {ParsedObjLiteral, &PartsObject{
-		Entries: map[string]*Literal{
-			"RTHas": {FunLiteral, NativeMethod{
-				Args: []string{"arr", "elt"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					acc := args[0]
-
-					if acc.LiteralType != ParsedListLiteral {
-						return &Literal{BoolLiteral, false}, nil
-					}
-
-					for _, val := range acc.Value.(PartsObject).Entries {
-						if val, err := args[1].opEq(val); err != nil && val.Value.(bool) {
-							return &Literal{BoolLiteral, true}, nil
-						}
-					}
-
-					return &Literal{BoolLiteral, false}, nil
-				},
-			}},
-			"RTAppendAll": {FunLiteral, NativeMethod{
-				Args: []string{"arr", "other"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					if args[0].LiteralType != ParsedListLiteral {
-						return nil, errors.New("expected array type as a first argument to Array.AppendAll")
-					}
-
-					if args[1].LiteralType != ParsedListLiteral {
-						println(args[1].LiteralType)
-						return nil, errors.New("expected array type as a second argument to Array.AppendAll")
-					}
-
-					entries := args[1].Value.(PartsIndexable).GetAll()
-
-					keys := make([]string, 0, len(entries))
-
-					for k := range entries {
-						keys = append(keys, k)
-					}
-
-					sort.Slice(keys, func(i, j int) bool {
-						numStrI := strings.TrimPrefix(keys[i], "IT")
-						numI, errI := strconv.Atoi(numStrI)
-
-						if errI != nil {
-							panic(fmt.Sprintf("could not parse number from key %s: %v\n", keys[i], errI))
-						}
-
-						numStrJ := strings.TrimPrefix(keys[j], "IT")
-						numJ, errJ := strconv.Atoi(numStrJ)
-						if errJ != nil {
-							panic(fmt.Sprintf("could not parse number from key %s: %v\n", keys[j], errJ))
-						}
-
-						return numI < numJ
-					})
-
-					for _, key := range keys {
-						args[0].Value.(PartsIndexable).SetByKey(fmt.Sprintf("IT%d", args[0].Value.(PartsIndexable).Length()), entries[key])
-					}
-
-					return args[0], nil
-				},
-			}},
-			"RTSlice": {FunLiteral, NativeMethod{
-				Args: []string{"arr", "start", "end"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					if args[0].LiteralType != ParsedListLiteral {
-						return nil, errors.New("expected array as a argument to Array.Slice")
-					}
-
-					if args[1].LiteralType != IntLiteral {
-						return nil, errors.New("expected int as start index argument to Array.Slice")
-					}
-
-					if args[2].LiteralType != IntLiteral {
-						return nil, errors.New("expected int as end index argument to Array.Slice")
-					}
-
-					entries := args[0].Value.(PartsIndexable).GetAll()
-
-					keys := make([]string, 0, len(entries))
-
-					for k := range entries {
-						keys = append(keys, k)
-					}
-
-					sort.Slice(keys, func(i, j int) bool {
-						numStrI := strings.TrimPrefix(keys[i], "IT")
-						numI, errI := strconv.Atoi(numStrI)
-
-						if errI != nil {
-							panic(fmt.Sprintf("could not parse number from key %s: %v\n", keys[i], errI))
-						}
-
-						numStrJ := strings.TrimPrefix(keys[j], "IT")
-						numJ, errJ := strconv.Atoi(numStrJ)
-						if errJ != nil {
-							panic(fmt.Sprintf("could not parse number from key %s: %v\n", keys[j], errJ))
-						}
-
-						return numI < numJ
-					})
-
-					slicedKeys := keys[args[1].Value.(int):args[2].Value.(int)]
-
-					newArr := &PartsObject{Entries: make(map[string]*Literal)}
-
-					for idx, elt := range slicedKeys {
-						newArr.Set(&Literal{LiteralType: IntLiteral, Value: idx}, entries[elt])
-					}
-
-					return &Literal{LiteralType: ParsedListLiteral, Value: newArr}, nil
-				},
-			}},
-			"RTLength": {FunLiteral, NativeMethod{
-				Args: []string{"arr"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					if args[0].LiteralType != ParsedListLiteral {
-						return nil, errors.New("expected array as a argument to Array.Length")
-					}
-
-					return &Literal{LiteralType: IntLiteral, Value: args[0].Value.(PartsIndexable).Length()}, nil
-				},
-			}},
-			"RTIterator": {FunLiteral, NativeMethod{
-				Args: []string{"arr"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					if args[0].LiteralType != ParsedListLiteral {
-						return nil, errors.New("expected array as a argument to Array.Iterator")
-					}
-
-					args[0].Value.(PartsIndexable).SetByKey("@IT", &Literal{LiteralType: IntLiteral, Value: 0})
-
-					return &Literal{LiteralType: ParsedObjLiteral, Value: PartsSpecialObject{
-						Hash: "Parts.Iterator",
-						Internal: &PartsObject{
-							Entries: map[string]*Literal{
-								"RTnext": {LiteralType: FunLiteral, Value: NativeMethod{
-									Args: []string{},
-									Body: func(lVM *VM, _ []*Literal) (*Literal, error) {
-										it := args[0].Value.(PartsIndexable).GetByKey("@IT").Value.(int)
-
-										if args[0].Value.(PartsIndexable).Length()-1 < it+1 {
-											return &Literal{ParsedObjLiteral, PartsSpecialObject{
-												Internal: &PartsObject{},
-												Hash:     "Option.None",
-											}}, nil
-										}
-
-										elt := args[0].Value.(PartsIndexable).GetByKey(fmt.Sprintf("IT%d", it))
-
-										args[0].Value.(PartsIndexable).SetByKey(
-											"@IT",
-											&Literal{LiteralType: IntLiteral, Value: it + 1},
-										)
-										return &Literal{ParsedObjLiteral, PartsSpecialObject{
-											Internal: &PartsObject{Entries: map[string]*Literal{"RTValue": elt}},
-											Hash:     "Option.Some",
-										}}, nil
-									}},
-								},
-							},
-						},
-					}}, nil
-				}},
-			},
-		},
-	}},
+	"RTArray": ArrayModule.mustLoad(),
 	"RTObject": {ParsedObjLiteral, &PartsObject{
 		Entries: map[string]*Literal{
 			"RTHas": {FunLiteral, NativeMethod{
@@ -238,18 +68,10 @@ var StandardLibrary = map[string]*Literal{
 						return nil, errors.New("obj is not parts PartsIndexable")
 					}
 
-					entries := casted.GetAll()
-
-					keys := make([]string, 0, len(entries))
-
-					for k := range entries {
-						keys = append(keys, k)
-					}
-
-					newArr := &PartsObject{Entries: make(map[string]*Literal)}
+					newArr := NewPartsList()
 
-					for idx, elt := range keys {
-						newArr.Set(&Literal{LiteralType: IntLiteral, Value: idx}, &Literal{StringLiteral, elt[2:]})
+					for _, elt := range orderedKeys(casted) {
+						newArr.Append(&Literal{StringLiteral, elt[2:]})
 					}
 
 					return &Literal{LiteralType: ParsedListLiteral, Value: newArr}, nil
@@ -270,72 +92,18 @@ var StandardLibrary = map[string]*Literal{
 
 					query := args[1].Value.(string)
 
-					entries := casted.GetAll()
-
-					for key, val := range entries {
+					for _, key := range orderedKeys(casted) {
 						if key[2:] == query {
-							return val, nil
+							return casted.GetByKey(key), nil
 						}
 					}
 
-					return nil, nil
-				},
-			}},
-		},
-	}},
-	"RTString": {ParsedObjLiteral, &PartsObject{
-		Entries: map[string]*Literal{
-			"RTLength": {FunLiteral, NativeMethod{
-				Args: []string{"str"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					if args[0].LiteralType != StringLiteral {
-						return nil, errors.New("expected string as a argument to String.Length")
-					}
-
-					return &Literal{IntLiteral, len(args[0].Value.(string))}, nil
-				},
-			}},
-			"RTAt": {FunLiteral, NativeMethod{
-				Args: []string{"str", "idx"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					if args[0].LiteralType != StringLiteral {
-						return nil, errors.New("expected string as a argument to String.At")
-					}
-
-					if args[1].LiteralType != IntLiteral {
-						return nil, errors.New("expected int as index argument to String.At")
-					}
-
-					return &Literal{StringLiteral, string(args[0].Value.(string)[args[1].Value.(int)])}, nil
-				},
-			}},
-			"RTSubstring": {FunLiteral, NativeMethod{
-				Args: []string{"str", "start", "end"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					if args[0].LiteralType != StringLiteral {
-						return nil, errors.New("expected string as a argument to String.Substring")
-					}
-
-					if args[1].LiteralType != IntLiteral {
-						return nil, errors.New("expected int as start index argument to String.Substring")
-					}
-
-					if args[2].LiteralType != IntLiteral {
-						return nil, errors.New("expected int as end index argument to String.Substring")
-					}
-
-					return &Literal{StringLiteral, args[0].Value.(string)[args[1].Value.(int):args[2].Value.(int)]}, nil
-
-				},
-			}},
-			"RTFrom": {FunLiteral, NativeMethod{
-				Args: []string{"arg"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					return &Literal{StringLiteral, args[0].pretify()}, nil
+					return &Literal{NilLiteral, nil}, nil
 				},
 			}},
 		},
 	}},
+	"RTString": StringModule.mustLoad(),
 	"RTInt": {ParsedObjLiteral, &PartsObject{
 		Entries: map[string]*Literal{
 			"RTParse": {FunLiteral, NativeMethod{
@@ -358,89 +126,278 @@ var StandardLibrary = map[string]*Literal{
 			}},
 		},
 	}},
-	"RTOption": {ParsedObjLiteral, &PartsObject{
-		Entries: map[string]*Literal{
-			"RTNone": {ParsedObjLiteral, PartsSpecialObject{
-				Internal: &PartsObject{},
-				Hash:     "Option.None",
-			}},
-			"RTSome": {FunLiteral, NativeMethod{
-				Args: []string{"val"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					return &Literal{ParsedObjLiteral, PartsSpecialObject{
-						Internal: &PartsObject{Entries: map[string]*Literal{"RTValue": args[0]}},
-						Hash:     "Option.Some",
-					}}, nil
-				},
-			}},
-			"RTIsSome": {FunLiteral, NativeMethod{
-				Args: []string{"obj"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					if args[0].LiteralType != ParsedObjLiteral {
-						return &Literal{BoolLiteral, false}, nil
-					}
+	"RTOption": OptionModule.mustLoad(),
+	"RTResult": ResultModule.mustLoad(),
+}
 
-					return &Literal{BoolLiteral, args[0].Value.(PartsIndexable).TypeHash() == "Option.Some"}, nil
-				},
-			}},
-			"RTIsNone": {FunLiteral, NativeMethod{
-				Args: []string{"obj"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					if args[0].LiteralType != ParsedObjLiteral {
-						return &Literal{BoolLiteral, false}, nil
-					}
+var ArrayModule = &Module{
+	Name: "Array",
+	Functions: map[string]any{
+		"Has": NativeMethod{
+			Args: []string{"arr", "elt"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				acc := args[0]
 
-					return &Literal{BoolLiteral, args[0].Value.(PartsIndexable).TypeHash() == "Option.None"}, nil
-				},
-			}},
-			"RTIsOption": {FunLiteral, NativeMethod{
-				Args: []string{"obj"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					if args[0].LiteralType != ParsedObjLiteral {
-						return &Literal{BoolLiteral, false}, nil
+				if acc.LiteralType != ParsedListLiteral {
+					return &Literal{BoolLiteral, false}, nil
+				}
+
+				for _, val := range listValues(acc.Value.(PartsIndexable)) {
+					if val, err := args[1].opEq(val); err == nil && val.Value.(bool) {
+						return &Literal{BoolLiteral, true}, nil
 					}
+				}
 
-					th := args[0].Value.(PartsIndexable).TypeHash()
+				return &Literal{BoolLiteral, false}, nil
+			},
+		},
+		"AppendAll": NativeMethod{
+			Args: []string{"arr", "other"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				if args[0].LiteralType != ParsedListLiteral {
+					return nil, errors.New("expected array type as a first argument to Array.AppendAll")
+				}
 
-					return &Literal{BoolLiteral, th == "Option.None" || th == "Option.Some"}, nil
-				},
-			}},
+				if args[1].LiteralType != ParsedListLiteral {
+					println(args[1].LiteralType)
+					return nil, errors.New("expected array type as a second argument to Array.AppendAll")
+				}
+
+				values := listValues(args[1].Value.(PartsIndexable))
+
+				if list, ok := args[0].Value.(*PartsList); ok {
+					list.Append(values...)
+
+					return args[0], nil
+				}
+
+				for _, value := range values {
+					args[0].Value.(PartsIndexable).SetByKey(fmt.Sprintf("IT%d", args[0].Value.(PartsIndexable).Length()), value)
+				}
+
+				return args[0], nil
+			},
 		},
-	}},
-	"RTResult": {ParsedObjLiteral, &PartsObject{
-		Entries: map[string]*Literal{
-			"RTError": {FunLiteral, NativeMethod{
-				Args: []string{"val"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					return &Literal{ParsedObjLiteral, NewResultError(args[0])}, nil
-				},
-			}},
-			"RTOk": {FunLiteral, NativeMethod{
-				Args: []string{"val"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					return &Literal{ParsedObjLiteral, NewResultOK(args[0])}, nil
-				},
-			}},
-			"RTIsOk": {FunLiteral, NativeMethod{
-				Args: []string{"obj"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					return &Literal{BoolLiteral, IsResultOK(args[0])}, nil
-				},
-			}},
-			"RTIsResult": {FunLiteral, NativeMethod{
-				Args: []string{"obj"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					return &Literal{BoolLiteral, IsResult(args[0])}, nil
-				},
-			}},
-			"RTIsError": {FunLiteral, NativeMethod{
-				Args: []string{"obj"},
-				Body: func(vm *VM, args []*Literal) (*Literal, error) {
-					return &Literal{BoolLiteral, IsResultError(args[0])}, nil
-				},
-			}},
+		"Slice": NativeMethod{
+			Args: []string{"arr", "start", "end"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				if args[0].LiteralType != ParsedListLiteral {
+					return nil, errors.New("expected array as a argument to Array.Slice")
+				}
+
+				if args[1].LiteralType != IntLiteral {
+					return nil, errors.New("expected int as start index argument to Array.Slice")
+				}
+
+				if args[2].LiteralType != IntLiteral {
+					return nil, errors.New("expected int as end index argument to Array.Slice")
+				}
+
+				list := NewPartsList(listValues(args[0].Value.(PartsIndexable))...)
+
+				sliced, err := list.Slice(args[1].Value.(int), args[2].Value.(int))
+
+				if err != nil {
+					return nil, errors.Join(errors.New("got error while running Array.Slice"), err)
+				}
+
+				return &Literal{LiteralType: ParsedListLiteral, Value: sliced}, nil
+			},
 		},
-	}},
+		"Length": NativeMethod{
+			Args: []string{"arr"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				if args[0].LiteralType != ParsedListLiteral {
+					return nil, errors.New("expected array as a argument to Array.Length")
+				}
+
+				return &Literal{LiteralType: IntLiteral, Value: args[0].Value.(PartsIndexable).Length()}, nil
+			},
+		},
+		"Iterator": NativeMethod{
+			Args: []string{"arr"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				if args[0].LiteralType != ParsedListLiteral {
+					return nil, errors.New("expected array as a argument to Array.Iterator")
+				}
+
+				list := args[0].Value.(PartsIndexable)
+				it := 0
+
+				return &Literal{LiteralType: ParsedObjLiteral, Value: PartsSpecialObject{
+					Hash: "Parts.Iterator",
+					Internal: &PartsObject{
+						Entries: map[string]*Literal{
+							"RTnext": {LiteralType: FunLiteral, Value: NativeMethod{
+								Args: []string{},
+								Body: func(lVM *VM, _ []*Literal) (*Literal, error) {
+									if it >= list.Length() {
+										return &Literal{ParsedObjLiteral, PartsSpecialObject{
+											Internal: &PartsObject{},
+											Hash:     "Option.None",
+										}}, nil
+									}
+
+									elt := list.GetByKey(fmt.Sprintf("IT%d", it))
+
+									it++
+
+									return &Literal{ParsedObjLiteral, PartsSpecialObject{
+										Internal: &PartsObject{Entries: map[string]*Literal{"RTValue": elt}},
+										Hash:     "Option.Some",
+									}}, nil
+								}},
+							},
+						},
+					},
+				}}, nil
+			},
+		},
+	},
+}
+
+var StringModule = &Module{
+	Name: "String",
+	Functions: map[string]any{
+		"Length": NativeMethod{
+			Args: []string{"str"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				if args[0].LiteralType != StringLiteral {
+					return nil, errors.New("expected string as a argument to String.Length")
+				}
+
+				return &Literal{IntLiteral, len(args[0].Value.(string))}, nil
+			},
+		},
+		"At": NativeMethod{
+			Args: []string{"str", "idx"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				if args[0].LiteralType != StringLiteral {
+					return nil, errors.New("expected string as a argument to String.At")
+				}
+
+				if args[1].LiteralType != IntLiteral {
+					return nil, errors.New("expected int as index argument to String.At")
+				}
+
+				return &Literal{StringLiteral, string(args[0].Value.(string)[args[1].Value.(int)])}, nil
+			},
+		},
+		"Substring": NativeMethod{
+			Args: []string{"str", "start", "end"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				if args[0].LiteralType != StringLiteral {
+					return nil, errors.New("expected string as a argument to String.Substring")
+				}
+
+				if args[1].LiteralType != IntLiteral {
+					return nil, errors.New("expected int as start index argument to String.Substring")
+				}
+
+				if args[2].LiteralType != IntLiteral {
+					return nil, errors.New("expected int as end index argument to String.Substring")
+				}
+
+				return &Literal{StringLiteral, args[0].Value.(string)[args[1].Value.(int):args[2].Value.(int)]}, nil
+
+			},
+		},
+		"From": NativeMethod{
+			Args: []string{"arg"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				return &Literal{StringLiteral, args[0].pretifyWith(vm)}, nil
+			},
+		},
+	},
+}
+
+var OptionModule = &Module{
+	Name: "Option",
+	Constants: map[string]any{
+		"None": &Literal{ParsedObjLiteral, PartsSpecialObject{
+			Internal: &PartsObject{},
+			Hash:     "Option.None",
+		}},
+	},
+	Functions: map[string]any{
+		"Some": NativeMethod{
+			Args: []string{"val"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				return &Literal{ParsedObjLiteral, PartsSpecialObject{
+					Internal: &PartsObject{Entries: map[string]*Literal{"RTValue": args[0]}},
+					Hash:     "Option.Some",
+				}}, nil
+			},
+		},
+		"IsSome": NativeMethod{
+			Args: []string{"obj"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				if args[0].LiteralType != ParsedObjLiteral {
+					return &Literal{BoolLiteral, false}, nil
+				}
+
+				return &Literal{BoolLiteral, args[0].Value.(PartsIndexable).TypeHash() == "Option.Some"}, nil
+			},
+		},
+		"IsNone": NativeMethod{
+			Args: []string{"obj"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				if args[0].LiteralType != ParsedObjLiteral {
+					return &Literal{BoolLiteral, false}, nil
+				}
+
+				return &Literal{BoolLiteral, args[0].Value.(PartsIndexable).TypeHash() == "Option.None"}, nil
+			},
+		},
+		"IsOption": NativeMethod{
+			Args: []string{"obj"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				if args[0].LiteralType != ParsedObjLiteral {
+					return &Literal{BoolLiteral, false}, nil
+				}
+
+				th := args[0].Value.(PartsIndexable).TypeHash()
+
+				return &Literal{BoolLiteral, th == "Option.None" || th == "Option.Some"}, nil
+			},
+		},
+	},
+}
+
+var ResultModule = &Module{
+	Name: "Result",
+	Functions: map[string]any{
+		"Error": NativeMethod{
+			Args: []string{"val"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				return &Literal{ParsedObjLiteral, NewResultError(args[0])}, nil
+			},
+		},
+		"Ok": NativeMethod{
+			Args: []string{"val"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				return &Literal{ParsedObjLiteral, NewResultOK(args[0])}, nil
+			},
+		},
+		"IsOk": NativeMethod{
+			Args: []string{"obj"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				return &Literal{BoolLiteral, IsResultOK(args[0])}, nil
+			},
+		},
+		"IsResult": NativeMethod{
+			Args: []string{"obj"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				return &Literal{BoolLiteral, IsResult(args[0])}, nil
+			},
+		},
+		"IsError": NativeMethod{
+			Args: []string{"obj"},
+			Body: func(vm *VM, args []*Literal) (*Literal, error) {
+				return &Literal{BoolLiteral, IsResultError(args[0])}, nil
+			},
+		},
+	},
 }
 
 type NativeMethod struct {
@@ -505,6 +462,10 @@ func (pso PartsSpecialObject) GetAll() map[string]*Literal {
 	return pso.Internal.GetAll()
 }
 
+func (pso PartsSpecialObject) Keys() []string {
+	return pso.Internal.Keys()
+}
+
 func (pso PartsSpecialObject) GetByKey(key string) *Literal {
 	return pso.Internal.GetByKey(key)
 }
@@ -586,3 +547,17 @@ func IsOptionNone(literal *Literal) bool {
 
 	return literal.Value.(PartsIndexable).TypeHash() == "Option.None"
 }
+
+func NewOptionSome(literal *Literal) *Literal {
+	return &Literal{ParsedObjLiteral, PartsSpecialObject{
+		Internal: &PartsObject{Entries: map[string]*Literal{"RTValue": literal}},
+		Hash:     "Option.Some",
+	}}
+}
+
+func NewOptionNone() *Literal {
+	return &Literal{ParsedObjLiteral, PartsSpecialObject{
+		Internal: &PartsObject{},
+		Hash:     "Option.None",
+	}}
+}
@@ -15,4 +15,7 @@ const (
 type Token struct {
 	Type  TokenType
 	Value []rune
+
+	//Line the token starts at, counted from 1
+	Line int
 }
@@ -0,0 +1,141 @@
+package parts
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// TypeHint is an optional type annotation (`let hp: Int = 10`, `fun(name: String): Bool`).
+// Zero value means there was no annotation and is treated the same as Any.
+type TypeHint struct {
+	Name     string
+	Nullable bool
+}
+
+var TypeNames = []string{"Any", "Int", "Double", "Bool", "String", "Fun", "List", "Object", "Pointer", "Nil"}
+
+func ParseTypeHint(name string) (TypeHint, error) {
+	hint := TypeHint{}
+
+	if base, found := strings.CutSuffix(name, "?"); found {
+		hint.Nullable = true
+		name = base
+	}
+
+	if !slices.Contains(TypeNames, name) {
+		return TypeHint{}, fmt.Errorf("unknown type '%s' expected one of %s", name, strings.Join(TypeNames, ", "))
+	}
+
+	hint.Name = name
+
+	return hint, nil
+}
+
+func TypeHintOf(l *Literal) TypeHint {
+	if l == nil {
+		return TypeHint{Name: "Nil"}
+	}
+
+	switch l.LiteralType {
+	case IntLiteral:
+		return TypeHint{Name: "Int"}
+	case DoubleLiteral:
+		return TypeHint{Name: "Double"}
+	case BoolLiteral:
+		return TypeHint{Name: "Bool"}
+	case StringLiteral:
+		return TypeHint{Name: "String"}
+	case FunLiteral:
+		return TypeHint{Name: "Fun"}
+	case ObjLiteral, ParsedObjLiteral:
+		return TypeHint{Name: "Object"}
+	case ListLiteral, ParsedListLiteral:
+		return TypeHint{Name: "List"}
+	case PointerLiteral:
+		return TypeHint{Name: "Pointer"}
+	case NilLiteral:
+		return TypeHint{Name: "Nil"}
+	}
+
+	return TypeHint{Name: "Any"}
+}
+
+// TypeHintFromGo maps Go type to the closest Parts type, used in FFI errors
+func TypeHintFromGo(t reflect.Type) TypeHint {
+	switch t.Kind() {
+	case reflect.Bool:
+		return TypeHint{Name: "Bool"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return TypeHint{Name: "Int"}
+	case reflect.Float32, reflect.Float64:
+		return TypeHint{Name: "Double"}
+	case reflect.String:
+		return TypeHint{Name: "String"}
+	case reflect.Func:
+		return TypeHint{Name: "Fun"}
+	case reflect.Array, reflect.Slice:
+		return TypeHint{Name: "List"}
+	case reflect.Map:
+		return TypeHint{Name: "Object"}
+	case reflect.Pointer:
+		if isFFIStruct(t.Elem()) {
+			return TypeHint{Name: "Object", Nullable: true}
+		}
+
+		return TypeHint{Name: "Pointer", Nullable: true}
+	case reflect.Struct:
+		if isFFIStruct(t) {
+			return TypeHint{Name: "Object"}
+		}
+
+		return TypeHint{Name: "Pointer"}
+	}
+
+	return TypeHint{Name: "Any"}
+}
+
+func (t TypeHint) IsAny() bool {
+	return t.Name == "" || t.Name == "Any"
+}
+
+// Accepts reports whether value of the other type can be stored where t is expected
+func (t TypeHint) Accepts(other TypeHint) bool {
+	if t.IsAny() || other.IsAny() {
+		return true
+	}
+
+	if other.Name == "Nil" {
+		return t.Nullable || t.Name == "Nil"
+	}
+
+	if other.Nullable && !t.Nullable {
+		return false
+	}
+
+	return t.Name == other.Name
+}
+
+func (t TypeHint) Check(l *Literal) error {
+	if !t.Accepts(TypeHintOf(l)) {
+		return fmt.Errorf("expected %s got %s", t, TypeHintOf(l))
+	}
+
+	return nil
+}
+
+func (t TypeHint) String() string {
+	name := t.Name
+
+	if name == "" {
+		name = "Any"
+	}
+
+	if t.Nullable {
+		return name + "?"
+	}
+
+	return name
+}
@@ -0,0 +1,592 @@
+package parts
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PartsUnmarshaler is implemented by types that decode Parts values themselves
+type PartsUnmarshaler interface {
+	UnmarshalParts(value *Literal) error
+}
+
+// UnmarshalError points to the value that couldn't be decoded, Path is like "loot.items[2].name"
+type UnmarshalError struct {
+	Path string
+	Err  error
+}
+
+func (e *UnmarshalError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	unmarshalerType = reflect.TypeOf((*PartsUnmarshaler)(nil)).Elem()
+	textType        = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Unmarshal runs the code and decodes top level variables into struct pointed
+// by v. Fields are named like in `parts` tags, options are:
+//   - required - error when the variable is missing
+//   - default=value - used when it's missing, strings (and types decoded from
+//     strings) take the text as it is, other types parse it as Parts expression
+//   - omitempty - nil is treated as missing (and skipped by Marshal)
+//
+// Missing fields without the options are left as they are.
+func Unmarshal(src string, v any) error {
+	vm, err := GetVMWithSource(src, "./")
+
+	if err != nil {
+		return err
+	}
+
+	if err = vm.Run(); err != nil {
+		return err
+	}
+
+	return UnmarshalVM(vm, v)
+}
+
+// UnmarshalVM is Unmarshal for VM that already ran
+func UnmarshalVM(vm *VM, v any) error {
+	out := reflect.ValueOf(v)
+
+	if out.Kind() != reflect.Pointer || out.IsNil() || out.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected pointer to struct got %T", v)
+	}
+
+	d := decoder{vm: vm}
+
+	return d.decodeStruct("", func(key string) (*Literal, bool) {
+		if !vm.Enviroment.Has("RT" + key) {
+			return nil, false
+		}
+
+		value, err := vm.Enviroment.resolve("RT" + key)
+
+		return value, err == nil
+	}, out.Elem())
+}
+
+type decoder struct {
+	vm *VM
+	//Lists and objects whose entries are being decoded
+	walking map[any]bool
+}
+
+func (d *decoder) fail(path string, format string, args ...any) error {
+	return &UnmarshalError{Path: path, Err: fmt.Errorf(format, args...)}
+}
+
+// walk marks list or object as being decoded, it's an error to find it again in it's own entries
+func (d *decoder) walk(path string, obj PartsIndexable) (func(), error) {
+	id, ok := identity(obj)
+
+	if !ok {
+		return func() {}, nil
+	}
+
+	if d.walking[id] {
+		return nil, d.fail(path, "encountered a cycle, value contains itself")
+	}
+
+	if d.walking == nil {
+		d.walking = map[any]bool{}
+	}
+
+	d.walking[id] = true
+
+	return func() { delete(d.walking, id) }, nil
+}
+
+func (d *decoder) decodeStruct(path string, lookup func(key string) (*Literal, bool), out reflect.Value) error {
+	outType := out.Type()
+
+	for i := range outType.NumField() {
+		field := outType.Field(i)
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		options := tagOptions("")
+
+		if tag, has := field.Tag.Lookup("parts"); has {
+			var tagName string
+
+			tagName, options = parseTag(tag)
+
+			if tagName == "-" {
+				continue
+			} else if tagName != "" {
+				name = tagName
+			}
+		}
+
+		fieldValue := out.Field(i)
+
+		//Embedded struct without a name has it's fields next to the others
+		if field.Anonymous && name == field.Name && field.Type.Kind() == reflect.Struct {
+			if err := d.decodeStruct(path, lookup, fieldValue); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		fieldPath := name
+
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+
+		value, ok := lookup(name)
+
+		if ok && value.LiteralType == NilLiteral && options.Contains("omitempty") {
+			ok = false
+		}
+
+		if !ok {
+			if text, has := options.Value("default"); has {
+				if err := d.decodeText(fieldPath, text, fieldValue); err != nil {
+					return err
+				}
+			} else if options.Contains("required") {
+				return d.fail(fieldPath, "required value is missing")
+			}
+
+			continue
+		}
+
+		if err := d.decode(fieldPath, value, fieldValue); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeText decodes default value from the tag
+func (d *decoder) decodeText(path string, text string, out reflect.Value) error {
+	target := out.Type()
+
+	for target.Kind() == reflect.Pointer {
+		target = target.Elem()
+	}
+
+	if target.Kind() == reflect.String || target == durationType || reflect.PointerTo(target).Implements(textType) {
+		return d.decode(path, &Literal{StringLiteral, text}, out)
+	}
+
+	value, err := evalDefault(text)
+
+	if err != nil {
+		return d.fail(path, "invalid default value '%s': %w", text, err)
+	}
+
+	return d.decode(path, value, out)
+}
+
+// evalDefault runs expression from the default option. It's set in init, the
+// decoder is reachable from the VM (through FFIStruct fields) so referencing
+// the compiler directly would be an initialization cycle
+var evalDefault func(text string) (*Literal, error)
+
+func init() {
+	evalDefault = func(text string) (*Literal, error) {
+		vm, err := RunString("let value = "+text, "./")
+
+		if err != nil {
+			return nil, err
+		}
+
+		return vm.Enviroment.resolve("RTvalue")
+	}
+}
+
+func (d *decoder) decode(path string, value *Literal, out reflect.Value) error {
+	switch value.LiteralType {
+	case RefLiteral, ObjLiteral, ListLiteral:
+		simplified, err := d.vm.simplifyLiteral(value, true)
+
+		if err != nil {
+			return &UnmarshalError{Path: path, Err: err}
+		}
+
+		value = simplified
+	}
+
+	if out.Kind() == reflect.Pointer {
+		if value.LiteralType == NilLiteral {
+			out.SetZero()
+
+			return nil
+		}
+
+		//Go value passed to the script comes back as it is
+		if raw := goValue(value); raw != nil && reflect.TypeOf(raw) == out.Type() {
+			out.Set(reflect.ValueOf(raw))
+
+			return nil
+		}
+
+		if out.IsNil() {
+			out.Set(reflect.New(out.Type().Elem()))
+		}
+
+		return d.decode(path, value, out.Elem())
+	}
+
+	if out.CanAddr() && out.Addr().Type().Implements(unmarshalerType) {
+		if err := out.Addr().Interface().(PartsUnmarshaler).UnmarshalParts(value); err != nil {
+			return &UnmarshalError{Path: path, Err: err}
+		}
+
+		return nil
+	}
+
+	if value.LiteralType == NilLiteral {
+		out.SetZero()
+
+		return nil
+	}
+
+	if out.Type() == durationType {
+		switch value.LiteralType {
+		case StringLiteral:
+			duration, err := time.ParseDuration(value.Value.(string))
+
+			if err != nil {
+				return &UnmarshalError{Path: path, Err: err}
+			}
+
+			out.SetInt(int64(duration))
+		case IntLiteral:
+			out.SetInt(int64(value.Value.(int)))
+		default:
+			return d.mismatch(path, "Duration (String or Int)", value)
+		}
+
+		return nil
+	}
+
+	if out.CanAddr() && out.Addr().Type().Implements(textType) {
+		if value.LiteralType != StringLiteral {
+			return d.mismatch(path, "String", value)
+		}
+
+		if err := out.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value.Value.(string))); err != nil {
+			return &UnmarshalError{Path: path, Err: err}
+		}
+
+		return nil
+	}
+
+	switch out.Kind() {
+	case reflect.Interface:
+		raw, err := d.plain(path, value)
+
+		if err != nil {
+			return err
+		}
+
+		rawValue := reflect.ValueOf(raw)
+
+		if !rawValue.Type().AssignableTo(out.Type()) {
+			return d.fail(path, "%s doesn't implement %s", rawValue.Type(), out.Type())
+		}
+
+		out.Set(rawValue)
+	case reflect.Bool:
+		if value.LiteralType != BoolLiteral {
+			return d.mismatch(path, "Bool", value)
+		}
+
+		out.SetBool(value.Value.(bool))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.LiteralType != IntLiteral {
+			return d.mismatch(path, "Int", value)
+		}
+
+		if n := int64(value.Value.(int)); out.OverflowInt(n) {
+			return d.fail(path, "%d overflows %s", n, out.Type())
+		} else {
+			out.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value.LiteralType != IntLiteral {
+			return d.mismatch(path, "Int", value)
+		}
+
+		if n := value.Value.(int); n < 0 || out.OverflowUint(uint64(n)) {
+			return d.fail(path, "%d overflows %s", n, out.Type())
+		} else {
+			out.SetUint(uint64(n))
+		}
+	case reflect.Float32, reflect.Float64:
+		switch value.LiteralType {
+		case IntLiteral:
+			out.SetFloat(float64(value.Value.(int)))
+		case DoubleLiteral:
+			out.SetFloat(value.Value.(float64))
+		default:
+			return d.mismatch(path, "Double", value)
+		}
+	case reflect.String:
+		if value.LiteralType != StringLiteral {
+			return d.mismatch(path, "String", value)
+		}
+
+		out.SetString(value.Value.(string))
+	case reflect.Slice, reflect.Array:
+		if value.LiteralType != ParsedListLiteral {
+			return d.mismatch(path, "Array", value)
+		}
+
+		done, err := d.walk(path, value.Value.(PartsIndexable))
+
+		if err != nil {
+			return err
+		}
+
+		defer done()
+
+		values := listValues(value.Value.(PartsIndexable))
+
+		if out.Kind() == reflect.Slice {
+			out.Set(reflect.MakeSlice(out.Type(), len(values), len(values)))
+		} else if len(values) > out.Len() {
+			return d.fail(path, "expected at most %d elements got %d", out.Len(), len(values))
+		} else {
+			out.SetZero()
+		}
+
+		for idx, element := range values {
+			if err := d.decode(fmt.Sprintf("%s[%d]", path, idx), element, out.Index(idx)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if value.LiteralType != ParsedObjLiteral {
+			return d.mismatch(path, "Object", value)
+		}
+
+		obj := value.Value.(PartsIndexable)
+
+		done, err := d.walk(path, obj)
+
+		if err != nil {
+			return err
+		}
+
+		defer done()
+
+		newMap := reflect.MakeMapWithSize(out.Type(), obj.Length())
+
+		for _, hash := range objectKeys(obj) {
+			keyLit := keyLiteral(hash)
+			keyPath := fmt.Sprintf("%s[%s]", path, keyLit.pretify())
+
+			key := reflect.New(out.Type().Key()).Elem()
+
+			if err := d.decode(keyPath, keyLit, key); err != nil {
+				return err
+			}
+
+			element := reflect.New(out.Type().Elem()).Elem()
+
+			if err := d.decode(keyPath, obj.GetByKey(hash), element); err != nil {
+				return err
+			}
+
+			newMap.SetMapIndex(key, element)
+		}
+
+		out.Set(newMap)
+	case reflect.Struct:
+		if value.LiteralType != ParsedObjLiteral {
+			return d.mismatch(path, "Object", value)
+		}
+
+		obj := value.Value.(PartsIndexable)
+
+		if ffi, ok := obj.(*FFIStruct); ok && ffi.Value.Type() == out.Type() {
+			out.Set(ffi.Value)
+
+			return nil
+		}
+
+		done, err := d.walk(path, obj)
+
+		if err != nil {
+			return err
+		}
+
+		defer done()
+
+		return d.decodeStruct(path, func(key string) (*Literal, bool) {
+			for _, hash := range []string{"RT" + key, "ST" + key} {
+				if obj.HasByKey(hash) {
+					return obj.GetByKey(hash), true
+				}
+			}
+
+			return nil, false
+		}, out)
+	case reflect.Func:
+		if value.LiteralType != FunLiteral {
+			return d.mismatch(path, "Function", value)
+		}
+
+		raw, err := value.ToGoTypes(d.vm)
+
+		if err != nil {
+			return &UnmarshalError{Path: path, Err: err}
+		}
+
+		if !reflect.TypeOf(raw).AssignableTo(out.Type()) {
+			return d.fail(path, "functions are decoded as %s, can't use %s", reflect.TypeOf(raw), out.Type())
+		}
+
+		out.Set(reflect.ValueOf(raw))
+	default:
+		return d.fail(path, "%s is not supported", out.Type())
+	}
+
+	return nil
+}
+
+func (d *decoder) mismatch(path string, expected string, value *Literal) error {
+	return d.fail(path, "expected %s got %s", expected, TypeHintOf(value))
+}
+
+// plain decodes value for interface{}, objects are map[string]any and lists []any
+func (d *decoder) plain(path string, value *Literal) (any, error) {
+	switch value.LiteralType {
+	case ParsedListLiteral:
+		done, err := d.walk(path, value.Value.(PartsIndexable))
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer done()
+
+		values := listValues(value.Value.(PartsIndexable))
+		out := make([]any, len(values))
+
+		for idx, element := range values {
+			val, err := d.plain(fmt.Sprintf("%s[%d]", path, idx), element)
+
+			if err != nil {
+				return nil, err
+			}
+
+			out[idx] = val
+		}
+
+		return out, nil
+	case ParsedObjLiteral:
+		obj := value.Value.(PartsIndexable)
+
+		if ffi, ok := obj.(*FFIStruct); ok {
+			return ffi.Interface(), nil
+		}
+
+		done, err := d.walk(path, obj)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer done()
+
+		out := make(map[string]any, obj.Length())
+
+		for _, hash := range objectKeys(obj) {
+			key := fmt.Sprint(returnExpected(hash))
+
+			val, err := d.plain(fmt.Sprintf("%s[%s]", path, key), obj.GetByKey(hash))
+
+			if err != nil {
+				return nil, err
+			}
+
+			out[key] = val
+		}
+
+		return out, nil
+	}
+
+	raw, err := value.ToGoTypes(d.vm)
+
+	if err != nil {
+		return nil, &UnmarshalError{Path: path, Err: err}
+	}
+
+	return raw, nil
+}
+
+// goValue returns Go value the literal wraps, nil for Parts values
+func goValue(value *Literal) any {
+	switch val := value.Value.(type) {
+	case *FFIStruct:
+		return val.Interface()
+	}
+
+	if value.LiteralType == PointerLiteral {
+		return value.Value
+	}
+
+	return nil
+}
+
+// objectKeys returns hashed keys sorted so errors are always about the same entry
+func objectKeys(obj PartsIndexable) []string {
+	keys := make([]string, 0, obj.Length())
+
+	for key := range obj.GetAll() {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+// keyLiteral turns hashed object key back to value, names are strings
+func keyLiteral(hash string) *Literal {
+	switch value := returnExpected(hash).(type) {
+	case int:
+		return &Literal{IntLiteral, value}
+	case float64:
+		return &Literal{DoubleLiteral, value}
+	case bool:
+		return &Literal{BoolLiteral, value}
+	case string:
+		return &Literal{StringLiteral, value}
+	}
+
+	return &Literal{NilLiteral, nil}
+}
+
+// Value returns text after "name=" option
+func (o tagOptions) Value(optionName string) (string, bool) {
+	for _, option := range strings.Split(string(o), ",") {
+		if value, ok := strings.CutPrefix(option, optionName+"="); ok {
+			return value, true
+		}
+	}
+
+	return "", false
+}
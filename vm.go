@@ -1,11 +1,16 @@
 package parts
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"slices"
 )
 
+// errOptionalNil stops optional chain at `?.` on nil, B_OPT_CHAIN turns it into nil value
+var errOptionalNil = errors.New("optional chain reached nil")
+
 type ExitCode = int
 
 const (
@@ -25,14 +30,67 @@ type VM struct {
 	EarlyExit   bool
 	ExitCode    ExitCode
 
+	//Set when running generator function body
+	Generator *GeneratorState
+
+	//Shared with all sub VMs
+	CallStack *CallStack
+
+	//Shared with all sub VMs, nil when not profiling
+	Profiler *Profiler
+
+	//Shared with all sub VMs, nil when not debugging
+	Debugger *Debugger
+
+	//Shared with all sub VMs, nil when nothing observes the VM
+	Hooks Hooks
+
+	//Shared with all sub VMs, nil when not collecting coverage
+	Coverage *Coverage
+
+	//Registered with VM.RegisterModule, shared with all sub VMs
+	Modules map[string]*Module
+
+	//Passed to Go functions taking context.Context, shared with all sub VMs
+	Context context.Context
+
+	//Generators that didn't finish, shared with all sub VMs
+	generators *generatorSet
+
+	//Name the next function is called by, only set while profiling or debugging
+	callee string
+
+	//Path of the running code and line of the last B_LINE, lines are only there when compiled with them
+	Source string
+	Line   int
+
+	//Lines variables declared by this VM were declared at (by hashed name), only filled when compiled with lines
+	Declared map[string]int
+
 	//Filled from parser
 	Code     []Bytecode
 	Literals []*Literal
 	Meta     map[string]string
 }
 
+// Run runs the code with the VM context, see RunContext
 func (vm *VM) Run() error {
+	return vm.RunContext(vm.context())
+}
+
+// RunContext is Run that stops when the context is done, it's checked between
+// statements, when loops jump back and when functions are called. Go functions
+// can take it as the first argument
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.Context = ctx
+
+	defer vm.finishRun()
+
 	for vm.Idx < len(vm.Code) {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(errors.New("stopped running bytecode"), err)
+		}
+
 		err := vm.Execute()
 
 		if err != nil {
@@ -47,9 +105,33 @@ func (vm *VM) Run() error {
 	return nil
 }
 
+// finishRun closes iterators of the loops left by return or error, once the
+// whole program is done generators that are still suspended are closed too.
+// Generator bodies are skipped, they end while the program closes them
+func (vm *VM) finishRun() {
+	vm.closeLoops()
+
+	if vm.Generator == nil && vm.callStack().Depth() == 0 {
+		vm.generatorSet().closeAll()
+	}
+}
+
+// context returns VM context, Background when there's none
+func (vm *VM) context() context.Context {
+	if vm.Context == nil {
+		return context.Background()
+	}
+
+	return vm.Context
+}
+
 func (vm *VM) Execute() error {
 	switch vm.Code[vm.Idx] {
 	case B_DECLARE:
+		if vm.Hooks != nil {
+			vm.Hooks.OnInstruction(B_DECLARE, vm.Idx)
+		}
+
 		vm.Idx++
 
 		exprType, nameLiteral, err := vm.runExpr(true)
@@ -87,6 +169,78 @@ func (vm *VM) Execute() error {
 		if _, err = vm.Enviroment.define(envKey, simpleValue); err != nil {
 			return errors.Join(errors.New("got error while defining variable"), err)
 		}
+
+		if vm.Line > 0 {
+			if vm.Declared == nil {
+				vm.Declared = make(map[string]int)
+			}
+
+			vm.Declared[envKey] = vm.Line
+		}
+	case B_DECLARE_LOCAL:
+		if vm.Hooks != nil {
+			vm.Hooks.OnInstruction(B_DECLARE_LOCAL, vm.Idx)
+		}
+
+		vm.Idx++
+
+		slot, err := vm.decodeLen()
+
+		if err != nil {
+			return errors.Join(errors.New("got error while decoding slot (B_DECLARE_LOCAL)"), err)
+		}
+
+		exprType, nameLiteral, err := vm.runExpr(true)
+
+		if err != nil {
+			return errors.Join(errors.New("got error while running expression"), err)
+		}
+
+		if exprType != TypeLiteral || nameLiteral.(*Literal).LiteralType != RefLiteral {
+			return errors.New("expected literal as variable name")
+		}
+
+		exprType, value, err := vm.runExpr(true)
+
+		if err != nil {
+			return errors.Join(errors.New("got error while running variable value (B_DECLARE_LOCAL)"), err)
+		}
+
+		if exprType != TypeLiteral {
+			return fmt.Errorf("expected value got %d (declare value)", exprType)
+		}
+
+		simpleValue, err := vm.simplifyLiteral(value.(*Literal), true)
+
+		if err != nil {
+			return errors.Join(errors.New("got error while simplyfing value"), err)
+		}
+
+		if slot != len(vm.Enviroment.Locals) {
+			return fmt.Errorf("declaring local at slot %d but scope has %d", slot, len(vm.Enviroment.Locals))
+		}
+
+		vm.Enviroment.declareLocal(nameLiteral.(*Literal).Value.(string), simpleValue)
+	case B_COND_JUMP:
+		if vm.Hooks != nil {
+			vm.Hooks.OnInstruction(B_COND_JUMP, vm.Idx)
+		}
+
+		vm.Idx++
+
+		condition, thenStart, elseStart, _, err := vm.condJump()
+
+		if err != nil {
+			return err
+		}
+
+		//Branch runs in place, the value of the last statement in there is the value of the whole statement
+		vm.LastExpr = nil
+		vm.Idx = elseStart
+
+		if condition {
+			vm.Idx = thenStart
+		}
 	default:
 		if vm.Idx >= len(vm.Code) {
 			return errors.New("tried running bytecode after the end")
@@ -144,7 +298,13 @@ func (vm *VM) handleNestedSet(accessor *Literal) (*Literal, error) {
 	return val, nil
 }
 
-func (vm *VM) handleNestedCall(accessor *Literal, argCount int) (*Literal, error) {
+func (vm *VM) handleNestedCall(accessor *Literal, argCount int, name string) (*Literal, error) {
+	fun, self, err := callable(accessor)
+
+	if err != nil {
+		return nil, err
+	}
+
 	values := make([]*Literal, argCount)
 
 	for i := range values {
@@ -167,20 +327,29 @@ func (vm *VM) handleNestedCall(accessor *Literal, argCount int) (*Literal, error
 		values[i] = resolvedExpr
 	}
 
-	return vm.callFunction(accessor.Value.(PartsCallable), values)
+	if self != nil {
+		values = append([]*Literal{self}, values...)
+	}
+
+	vm.callee = name
+
+	return vm.callFunction(fun, values)
 }
 
 func (vm *VM) runExpr(unwindDot bool) (ExpressionType, any, error) {
+	if vm.Hooks != nil {
+		vm.Hooks.OnInstruction(vm.Code[vm.Idx], vm.Idx)
+	}
+
 	switch vm.Code[vm.Idx] {
 	case B_NEW_SCOPE:
 		vm.Idx++
 
-		newEnv := VMEnviroment{
-			Values:    make(map[string]*Literal),
-			Enclosing: vm.Enviroment,
-		}
+		vm.Enviroment = &VMEnviroment{Enclosing: vm.Enviroment}
 
-		vm.Enviroment = &newEnv
+		if vm.Hooks != nil {
+			vm.Hooks.OnScopeEnter()
+		}
 
 		return ScopeChange, nil, nil
 	case B_END_SCOPE:
@@ -192,6 +361,10 @@ func (vm *VM) runExpr(unwindDot bool) (ExpressionType, any, error) {
 
 		vm.Enviroment = vm.Enviroment.Enclosing
 
+		if vm.Hooks != nil {
+			vm.Hooks.OnScopeExit()
+		}
+
 		return ScopeChange, nil, nil
 	case B_BIN_OP:
 		vm.Idx++
@@ -230,116 +403,144 @@ func (vm *VM) runExpr(unwindDot bool) (ExpressionType, any, error) {
 			return UndefinedExpression, nil, fmt.Errorf("expected value got %d (running dot accessor)", exprType)
 		}
 
-		accessor := rawAccessor.(*Literal)
+		return vm.runDot(rawAccessor.(*Literal), unwindDot, false)
+	case B_OPT_DOT:
+		vm.Idx++
+
+		exprType, rawAccessor, err := vm.runExpr(true)
 
-		if accessor.LiteralType == RefLiteral {
-			if acc, err := vm.simplifyLiteral(accessor, true); err == nil {
-				accessor = acc
-			} else {
-				return UndefinedExpression, nil, errors.Join(errors.New("got error while resolving reference (running dot accessor)"), err)
-			}
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while running expression"), err)
 		}
 
-		switch accessor.LiteralType {
-		case ListLiteral, ObjLiteral, ParsedListLiteral, ParsedObjLiteral:
-		default:
-			return UndefinedExpression, nil, fmt.Errorf("unexpected value type (%d) (B_DOT)", accessor.LiteralType)
+		if exprType != TypeLiteral {
+			return UndefinedExpression, nil, fmt.Errorf("expected value got %d (running optional dot accessor)", exprType)
 		}
 
-		if accessor.LiteralType == ListLiteral || accessor.LiteralType == ObjLiteral {
-			accessor, err = vm.simplifyLiteral(accessor, true)
+		accessor, err := vm.simplifyLiteral(rawAccessor.(*Literal), true)
 
-			if err != nil {
-				return UndefinedExpression, nil, errors.Join(errors.New("got error while running expression"), err)
-			}
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while resolving reference (running optional dot accessor)"), err)
 		}
 
-		if vm.Code[vm.Idx] == B_SET {
-			vm.Idx++
-
-			val, err := vm.handleNestedSet(rawAccessor.(*Literal))
+		length, err := vm.decodeLen()
 
-			if err != nil {
-				return UndefinedExpression, nil, errors.Join(errors.New("got error while setting field (B_DOT, B_SET)"), err)
-			}
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while decoding length (optional dot)"), err)
+		}
 
-			vm.LastExpr = val
+		if accessor.LiteralType == NilLiteral {
+			vm.Idx += length
 
-			return TypeLiteral, val, nil
+			return UndefinedExpression, nil, errOptionalNil
 		}
 
-		fCall := false
+		return vm.runDot(accessor, true, true)
+	case B_OPT_CHAIN:
+		vm.Idx++
+
+		length, err := vm.decodeLen()
 
-		if vm.Code[vm.Idx] == B_CALL {
-			fCall = true
-			vm.Idx++
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while decoding length (optional chain)"), err)
 		}
 
-		exprType, rawKey, err := vm.runExpr(unwindDot)
+		end := vm.Idx + length
 
-		if err != nil {
-			return UndefinedExpression, nil, errors.Join(errors.New("got error while running expression"), err)
+		exprType, value, err := vm.runExpr(unwindDot)
+
+		if errors.Is(err, errOptionalNil) {
+			vm.Idx = end
+			vm.LastExpr = &Literal{NilLiteral, nil}
+
+			return TypeLiteral, vm.LastExpr, nil
 		}
 
-		if exprType != TypeLiteral && exprType != DotExpression {
-			return UndefinedExpression, nil, errors.Join(fmt.Errorf("expected value got %d (dot value)", exprType), err)
+		return exprType, value, err
+	case B_COALESCE:
+		vm.Idx++
+
+		exprType, left, err := vm.runExpr(true)
+
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while running (coalesce left operand)"), err)
 		}
 
-		argCount := 0
+		length, err := vm.decodeLen()
 
-		if fCall {
-			argCount = int(vm.Code[vm.Idx])
-			vm.Idx++
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while decoding length (coalesce)"), err)
 		}
 
-		if !unwindDot {
-			resVal := make([]*Literal, 0)
+		if exprType == TypeLiteral {
+			simpleLeft, err := vm.simplifyLiteral(left.(*Literal), true)
 
-			if val, ok := rawAccessor.([]*Literal); ok {
-				resVal = append(resVal, val...)
-			} else {
-				resVal = append(resVal, rawAccessor.(*Literal))
+			if err != nil {
+				return UndefinedExpression, nil, errors.Join(errors.New("got error while simplyfing left operand (coalesce)"), err)
 			}
 
-			if exprType == TypeLiteral {
-				resVal = append(resVal, rawKey.(*Literal))
-			} else {
-				resVal = append(resVal, rawKey.([]*Literal)...)
+			if simpleLeft.LiteralType != NilLiteral {
+				vm.Idx += length
+				vm.LastExpr = simpleLeft
+
+				return TypeLiteral, simpleLeft, nil
 			}
+		}
+
+		exprType, right, err := vm.runExpr(true)
 
-			return DotExpression, resVal, nil
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while running (coalesce right operand)"), err)
+		}
+
+		if exprType != TypeLiteral {
+			return UndefinedExpression, nil, fmt.Errorf("expected value got %d (coalesce right operand)", exprType)
 		}
 
-		key, err := HashLiteral(*rawKey.(*Literal))
+		vm.LastExpr = right.(*Literal)
+
+		return TypeLiteral, right, nil
+	case B_LOAD_LOCAL:
+		vm.Idx++
+
+		env, slot, err := vm.readLocal()
 
 		if err != nil {
-			return UndefinedExpression, nil, errors.Join(errors.New("got error while hashing value"), err)
+			return UndefinedExpression, nil, err
 		}
 
-		if has := accessor.Value.(PartsIndexable).HasByKey(key); has {
-			rVal := accessor.Value.(PartsIndexable).GetByKey(key)
+		vm.LastExpr = env.Locals[slot].Value
 
-			if fCall {
-				rx, err := vm.handleNestedCall(rVal, argCount)
+		return TypeLiteral, vm.LastExpr, nil
+	case B_STORE_LOCAL:
+		vm.Idx++
 
-				if err != nil {
-					return UndefinedExpression, nil, errors.Join(errors.New("got error while calling function (B_DOT, B_CALL)"), err)
-				}
+		env, slot, err := vm.readLocal()
 
-				if rx == nil {
-					vm.LastExpr = nil
-					return NoValue, nil, nil
-				}
+		if err != nil {
+			return UndefinedExpression, nil, err
+		}
 
-				vm.LastExpr = rx
-				return TypeLiteral, rx, nil
-			}
+		exprType, value, err := vm.runExpr(true)
 
-			vm.LastExpr = rVal
-			return TypeLiteral, rVal, nil
-		} else {
-			return UndefinedExpression, nil, fmt.Errorf("key not found: %s", key)
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while running variable value (B_STORE_LOCAL)"), err)
+		}
+
+		if exprType != TypeLiteral {
+			return UndefinedExpression, nil, fmt.Errorf("expected value type got %d (running set)", exprType)
 		}
+
+		simpleValue, err := vm.simplifyLiteral(value.(*Literal), true)
+
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while simplyfing value"), err)
+		}
+
+		env.Locals[slot].Value = simpleValue
+		vm.LastExpr = simpleValue
+
+		return TypeLiteral, simpleValue, nil
 	case B_RESOLVE:
 		vm.Idx++
 		exprType, expr, err := vm.runExpr(unwindDot)
@@ -434,56 +635,21 @@ func (vm *VM) runExpr(unwindDot bool) (ExpressionType, any, error) {
 		return TypeLiteral, simpleValue, nil
 	case B_CALL:
 		vm.Idx++
-		exprType, expr, err := vm.runExpr(true)
-
-		if err != nil {
-			return UndefinedExpression, nil, errors.Join(errors.New("got error while running expression"), err)
-		}
-
-		if exprType != TypeLiteral {
-			return UndefinedExpression, nil, fmt.Errorf("expected value got %d (call)", exprType)
-		}
 
-		resolvedExpr, err := vm.simplifyLiteral(expr.(*Literal), true)
+		fun, values, err := vm.readCall()
 
 		if err != nil {
-			return UndefinedExpression, nil, errors.Join(errors.New("got error while running expression"), err)
-		}
-
-		if resolvedExpr.LiteralType != FunLiteral {
-			return UndefinedExpression, nil, fmt.Errorf("expected function value got %d (%s)", resolvedExpr.LiteralType, resolvedExpr.pretify())
-		}
-
-		values := make([]*Literal, vm.Code[vm.Idx])
-
-		vm.Idx++
-
-		for i := range values {
-			exprType, expr, err := vm.runExpr(true)
-
-			if err != nil {
-				return UndefinedExpression, nil, errors.Join(errors.New("got error while running expression"), err)
-			}
-
-			if exprType != TypeLiteral {
-				return UndefinedExpression, nil, fmt.Errorf("expected value got %d (resolve call arguments)", exprType)
-			}
-
-			resolvedExpr, err := vm.simplifyLiteral(expr.(*Literal), true)
-
-			if err != nil {
-				return UndefinedExpression, nil, errors.Join(errors.New("got error while simplyfing expression"), err)
-			}
-
-			values[i] = resolvedExpr
+			return UndefinedExpression, nil, err
 		}
 
-		funResult, err := vm.callFunction(resolvedExpr.Value.(PartsCallable), values)
+		funResult, err := vm.callFunction(fun, values)
 
 		if err != nil {
 			return UndefinedExpression, nil, errors.Join(errors.New("got error while executing function body"), err)
 		}
 
+		vm.LastExpr = funResult
+
 		if funResult == nil {
 			return NoValue, nil, nil
 		}
@@ -491,388 +657,773 @@ func (vm *VM) runExpr(unwindDot bool) (ExpressionType, any, error) {
 		return TypeLiteral, funResult, nil
 	case B_COND_JUMP:
 		vm.Idx++
-		exprType, jumpVal, err := vm.runExpr(true)
+
+		condition, thenStart, elseStart, end, err := vm.condJump()
 
 		if err != nil {
-			return UndefinedExpression, nil, errors.Join(errors.New("got error while running jump condition"), err)
+			return UndefinedExpression, nil, err
 		}
 
-		if exprType != TypeLiteral {
-			return UndefinedExpression, nil, fmt.Errorf("expected value got %d (jump condition)", exprType)
+		//Value is used here, so the branch runs right away
+		start := elseStart
+
+		if condition {
+			start = thenStart
 		}
 
-		lit, err := vm.simplifyLiteral(jumpVal.(*Literal), true)
+		env := vm.Enviroment
 
-		if err != nil {
-			return UndefinedExpression, nil, errors.Join(errors.New("got error while running jump condition"), err)
-		}
+		vm.Idx = start
+		vm.LastExpr = nil
 
-		if lit.LiteralType != BoolLiteral {
-			return UndefinedExpression, nil, fmt.Errorf("expected boolean value got %d (jump condition)", lit.LiteralType)
+		if err = vm.runRange(start, end); err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while running branch"), err)
 		}
 
-		if lit.Value.(bool) {
-			length, err := vm.decodeLen()
-
-			if err != nil {
-				return UndefinedExpression, nil, fmt.Errorf("got error while decoding length %d (then branch)", lit.LiteralType)
+		if vm.EarlyExit {
+			if vm.ExitCode == ReturnCode && vm.ReturnValue != nil {
+				return TypeLiteral, vm.ReturnValue, nil
 			}
 
-			tempVM := vm.newVM(vm.Code[vm.Idx : vm.Idx+length])
+			return NoValue, nil, nil
+		}
 
-			vm.Idx += length
+		if vm.Idx != end {
+			//Jumped out of the branch (break, continue)
+			return NoValue, nil, nil
+		}
 
-			if err = tempVM.Run(); err != nil {
-				return UndefinedExpression, nil, errors.Join(errors.New("got error while running then branch"), err)
-			}
+		vm.Enviroment = env
 
-			if tempVM.EarlyExit {
-				switch tempVM.ExitCode {
-				case BreakCode, ContinueCode:
-					vm.ExitCode = tempVM.ExitCode
-					vm.EarlyExit = true
-					vm.Idx = len(vm.Code)
-
-					return NoValue, nil, nil
-				case ReturnCode:
-					vm.EarlyExit = true
-					vm.ExitCode = ReturnCode
-					vm.Idx = len(vm.Code)
-
-					if tempVM.ReturnValue != nil {
-						vm.ReturnValue = tempVM.ReturnValue
-
-						return TypeLiteral, tempVM.ReturnValue, nil
-					} else {
-						return NoValue, nil, nil
-					}
-				}
-			}
+		if vm.LastExpr == nil {
+			return NoValue, nil, nil
+		}
 
-			length, err = vm.decodeLen()
+		return TypeLiteral, vm.LastExpr, nil
+	case B_LOOP:
+		start := vm.Idx
 
-			if err != nil {
-				return UndefinedExpression, nil, fmt.Errorf("got error while decoding length %d (else branch)", lit.LiteralType)
-			}
+		vm.Idx++
 
-			vm.Idx += length
-			vm.LastExpr = tempVM.LastExpr
+		conditionLen, err := vm.decodeLen()
 
-			if tempVM.LastExpr == nil {
-				vm.ExitCode = NormalCode
-				return NoValue, nil, nil
-			} else {
-				vm.ExitCode = ReturnCode
-				return TypeLiteral, tempVM.LastExpr, nil
-			}
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while decoding condition length"), err)
 		}
 
-		length, err := vm.decodeLen()
+		conditionStart := vm.Idx
 
-		if err != nil {
-			return UndefinedExpression, nil, fmt.Errorf("got error while decoding length %d (then branch)", lit.LiteralType)
-		}
+		vm.Idx += conditionLen
 
-		vm.Idx += length
+		conditionEnd := vm.Idx
 
-		length, err = vm.decodeLen()
+		bodyLen, err := vm.decodeLen()
 
 		if err != nil {
-			return UndefinedExpression, nil, fmt.Errorf("got error while decoding length %d (else branch)", lit.LiteralType)
-		}
-
-		if length == 0 {
-			return NoValue, nil, nil
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while decoding body length"), err)
 		}
 
-		tempVM := vm.newVM(vm.Code[vm.Idx : vm.Idx+length])
+		bodyStart := vm.Idx
 
-		vm.Idx += length
-
-		if err := tempVM.Run(); err != nil {
-			return UndefinedExpression, nil, errors.Join(errors.New("got error while running then branch"), err)
+		if err = vm.runLoop(start, conditionStart, conditionEnd, bodyStart, bodyStart+bodyLen); err != nil {
+			return UndefinedExpression, nil, err
 		}
 
-		if tempVM.EarlyExit {
-			vm.ExitCode = tempVM.ExitCode
-			vm.EarlyExit = true
-			vm.Idx = len(vm.Code)
-
-			if tempVM.ExitCode == ReturnCode && tempVM.ReturnValue != nil {
-				vm.ReturnValue = tempVM.ReturnValue
-
-				return TypeLiteral, tempVM.ReturnValue, nil
-			}
+		return NoValue, nil, nil
+	case B_END_LOOP:
+		vm.Idx++
 
-			return NoValue, nil, nil
+		//Reached only by break, the loop was left in the middle of the iteration
+		if err := vm.endLoop(); err != nil {
+			return UndefinedExpression, nil, err
 		}
 
-		if tempVM.LastExpr == nil {
-			vm.LastExpr = nil
-			vm.ExitCode = NormalCode
-			return NoValue, nil, nil
-		} else {
-			vm.LastExpr = tempVM.LastExpr
-			vm.ExitCode = ReturnCode
-			return TypeLiteral, tempVM.LastExpr, nil
-		}
-	case B_LOOP:
+		return NoValue, nil, nil
+	case B_JUMP:
 		vm.Idx++
 
-		condidionLen, err := vm.decodeLen()
+		offset, err := vm.decodeLen()
 
 		if err != nil {
-			return UndefinedExpression, nil, errors.Join(errors.New("got error while decoding condition length"), err)
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while decoding offset (jump)"), err)
 		}
 
-		condidion := vm.Code[vm.Idx : vm.Idx+condidionLen]
+		vm.Idx += offset
 
-		vm.Idx += condidionLen
+		return NoValue, nil, nil
+	case B_LINE:
+		vm.Idx++
 
-		bodyLen, err := vm.decodeLen()
+		line, err := vm.decodeLen()
 
 		if err != nil {
-			return UndefinedExpression, nil, errors.Join(errors.New("got error while decoding body length"), err)
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while decoding line"), err)
 		}
 
-		body := vm.Code[vm.Idx : vm.Idx+bodyLen]
+		vm.Line = line
+		vm.Coverage.hit(vm.Source, line)
 
-		vm.Idx += bodyLen
+		if err := vm.Debugger.line(vm); err != nil {
+			return UndefinedExpression, nil, err
+		}
 
-		baseVM := vm.copyVM()
+		return NoValue, nil, nil
+	case B_JUMP_REV:
+		vm.Idx++
 
-		condidionVM := baseVM.newVM(condidion)
+		offset, err := vm.decodeLen()
 
-		if err = condidionVM.Run(); err != nil {
-			return UndefinedExpression, nil, errors.Join(errors.New("got error while running condidion"), err)
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while decoding offset (reverse jump)"), err)
 		}
 
-		lastExpr, err := condidionVM.simplifyLiteral(condidionVM.LastExpr, true)
-
-		if err != nil {
-			return UndefinedExpression, nil, errors.Join(errors.New("got error while running condidion (simplyfing)"), err)
+		if err := vm.context().Err(); err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("stopped running loop"), err)
 		}
 
-		if lastExpr.LiteralType == BoolLiteral {
-			if lastExpr.Value.(bool) {
-				for lastExpr.Value.(bool) {
-					bodyVM := baseVM.newVM(body)
+		vm.Idx -= offset
 
-					err = bodyVM.Run()
+		return NoValue, nil, nil
+	case B_YIELD:
+		vm.Idx++
 
-					if err != nil {
-						return UndefinedExpression, nil, errors.Join(errors.New("got error while running body"), err)
-					}
+		if vm.Generator == nil {
+			return UndefinedExpression, nil, errors.New("yield used outside of generator function")
+		}
 
-					if bodyVM.EarlyExit {
-						switch bodyVM.ExitCode {
-						case BreakCode:
-							break
-						case ReturnCode:
-							vm.ExitCode = ReturnCode
-							vm.EarlyExit = true
-							vm.Idx = len(vm.Code)
+		exprType, val, err := vm.runExpr(true)
 
-							if bodyVM.ReturnValue != nil {
-								vm.ReturnValue = bodyVM.ReturnValue
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while running yield value"), err)
+		}
 
-								return TypeLiteral, bodyVM.ReturnValue, nil
-							} else {
-								return NoValue, nil, nil
-							}
-						}
+		if exprType != TypeLiteral {
+			return UndefinedExpression, nil, fmt.Errorf("expected value got %d (yield)", exprType)
+		}
 
-						if bodyVM.ExitCode == BreakCode {
-							break
-						}
-					}
+		simplifed, err := vm.simplifyLiteral(val.(*Literal), true)
 
-					condidionVM := baseVM.newVM(condidion)
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while simplyfing yield value"), err)
+		}
 
-					err = condidionVM.Run()
+		if err = vm.Generator.yield(simplifed); err != nil {
+			return UndefinedExpression, nil, err
+		}
 
-					if err != nil {
-						return UndefinedExpression, nil, errors.Join(errors.New("got error while running condidion"), err)
-					}
+		return NoValue, nil, nil
+	case B_TYPE_HINT:
+		vm.Idx++
 
-					lastExpr, err = condidionVM.simplifyLiteral(condidionVM.LastExpr, true)
+		//Annotations are verified by Check, only FFI calls are checked while running
+		if vm.Code[vm.Idx] != B_LITERAL {
+			return UndefinedExpression, nil, errors.New("expected literal as type annotation")
+		}
 
-					if err != nil {
-						return UndefinedExpression, nil, errors.Join(errors.New("got error while running condidion (simplyfing)"), err)
-					}
+		vm.Idx++
 
-					if lastExpr.LiteralType != BoolLiteral {
-						break
-					}
+		if _, err := vm.decodeLen(); err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while decoding offset (type annotation)"), err)
+		}
 
-					if bodyVM.EarlyExit && bodyVM.ExitCode == ContinueCode {
-						continue
-					}
-				}
+		return vm.runExpr(unwindDot)
+	case B_CONTINUE, B_BREAK, B_RAISE, B_RETURN:
+		code := vm.Code[vm.Idx]
+
+		vm.Idx++
+
+		if code == B_CONTINUE || code == B_BREAK {
+			//Linked to jumps by encodeLoop, the ones left aren't in any loop
+			return UndefinedExpression, nil, errors.New("break and continue can only be used in loops")
+		}
+
+		if code == B_RETURN && vm.Idx < len(vm.Code) && vm.Code[vm.Idx] == B_CALL {
+			if frame := vm.tailFrame(); frame != nil {
+				exprType, value, err := vm.runTailCall(frame)
+
+				vm.ExitCode = ReturnCode
+				vm.EarlyExit = true
+
+				return exprType, value, err
 			}
 		}
 
-		if lastExpr.LiteralType == ParsedObjLiteral {
-			obj := lastExpr
+		if code == B_RAISE || code == B_RETURN {
+			exprType, val, err := vm.runExpr(true)
 
-			th := obj.Value.(PartsIndexable).TypeHash()
+			if err != nil {
+				return UndefinedExpression, nil, errors.Join(errors.New("got error while running variable value (B_RAISE)"), err)
+			}
 
-			if th == "Parts.Iterator" {
-				iter := obj.Value.(PartsSpecialObject)
+			if exprType != TypeLiteral {
+				return UndefinedExpression, nil, errors.New("expected literal as variable name")
+			}
 
-				nextFunc := iter.Get(&Literal{
-					LiteralType: RefLiteral,
-					Value:       "next",
-				})
+			simplifed, err := vm.simplifyLiteral(val.(*Literal), true)
 
-				res, err := condidionVM.callFunction(nextFunc.Value.(PartsCallable), []*Literal{})
+			if err != nil {
+				return UndefinedExpression, nil, errors.Join(errors.New("got error while simplyfing raise value"), err)
+			}
 
-				if err != nil {
-					return UndefinedExpression, nil, errors.Join(errors.New("got error while running loop condition iterator"), err)
+			if code == B_RAISE {
+				if IsResult(simplifed) {
+					vm.ReturnValue = simplifed
+				} else {
+					vm.ReturnValue = NewResultError(simplifed)
 				}
 
-				for IsOptionSome(res) {
-					bodyVM := baseVM.newVM(body)
+				if vm.Hooks != nil {
+					vm.Hooks.OnRaise(vm.ReturnValue)
+				}
+			} else {
+				vm.ReturnValue = simplifed
+			}
+		}
 
-					bodyVM.Enviroment.Define("it", res.Value.(PartsSpecialObject).GetByKey("RTValue"))
+		//Flagged after the operand ran, conditionals in it stop at EarlyExit
+		vm.ExitCode = ReturnCode
+		vm.EarlyExit = true
 
-					err = bodyVM.Run()
+		return NoValue, nil, nil
+	default:
+		return UndefinedExpression, nil, fmt.Errorf("unrecognized bytecode: %d", vm.Code[vm.Idx])
+	}
+}
 
-					if err != nil {
-						return UndefinedExpression, nil, errors.Join(errors.New("got error while running body"), err)
-					}
+// loopState is shared by scopes of all iterations of the loop, B_LOOP finds it
+// there when the body jumps back
+type loopState struct {
+	vm    *VM
+	Start int
+	Line  int
 
-					if bodyVM.EarlyExit {
-						switch bodyVM.ExitCode {
-						case BreakCode:
-							break
-						case ReturnCode:
-							vm.ExitCode = ReturnCode
-							vm.EarlyExit = true
-							vm.Idx = len(vm.Code)
+	//Set by `for iterator`, the condition runs only once then
+	Iterator *Literal
+	next     PartsCallable
+}
 
-							if bodyVM.ReturnValue != nil {
-								vm.ReturnValue = bodyVM.ReturnValue
+// runRange executes code in place until the index leaves [start, end), jumps
+// (break, continue, B_JUMP) can move it outside of the range
+func (vm *VM) runRange(start, end int) error {
+	for vm.Idx >= start && vm.Idx < end && !vm.EarlyExit {
+		if err := vm.Execute(); err != nil {
+			return err
+		}
+	}
 
-								return TypeLiteral, bodyVM.ReturnValue, nil
-							} else {
-								return NoValue, nil, nil
-							}
-						}
+	return nil
+}
 
-						if bodyVM.ExitCode == BreakCode {
-							break
-						}
-					}
+// condJump runs the condition of B_COND_JUMP, returns where both branches start
+// and where the else branch ends. Then branch ends with B_JUMP past the else branch.
+func (vm *VM) condJump() (bool, int, int, int, error) {
+	line := vm.Line
+	exprType, jumpVal, err := vm.runExpr(true)
 
-					res, err = condidionVM.callFunction(nextFunc.Value.(PartsCallable), []*Literal{})
+	if err != nil {
+		return false, 0, 0, 0, errors.Join(errors.New("got error while running jump condition"), err)
+	}
 
-					if err != nil {
-						return UndefinedExpression, nil, errors.Join(errors.New("got error while running loop condidion iterator"), err)
-					}
-				}
-			} else {
-				iter := obj.Value.(PartsIndexable)
+	if exprType != TypeLiteral {
+		return false, 0, 0, 0, fmt.Errorf("expected value got %d (jump condition)", exprType)
+	}
 
-				nextFunc := iter.Get(&Literal{
-					LiteralType: RefLiteral,
-					Value:       "next",
-				})
+	lit, err := vm.simplifyLiteral(jumpVal.(*Literal), true)
 
-				if nextFunc.LiteralType != FunLiteral {
-					return UndefinedExpression, nil, errors.New("expected function type in object field")
-				}
+	if err != nil {
+		return false, 0, 0, 0, errors.Join(errors.New("got error while running jump condition"), err)
+	}
+
+	condition := false
 
-				res, err := condidionVM.callFunction(nextFunc.Value.(PartsCallable), []*Literal{})
+	switch lit.LiteralType {
+	case BoolLiteral:
+		condition = lit.Value.(bool)
+	case NilLiteral:
+		condition = false
+	default:
+		return false, 0, 0, 0, fmt.Errorf("expected boolean value got %d (jump condition)", lit.LiteralType)
+	}
 
-				for IsOptionSome(res) {
-					bodyVM := baseVM.newVM(body)
+	vm.Coverage.branch(vm.Source, line, condition)
 
-					bodyVM.Enviroment.Define("it", res.Value.(PartsSpecialObject).GetByKey("RTValue"))
+	thenLength, err := vm.decodeLen()
 
-					err = bodyVM.Run()
+	if err != nil {
+		return false, 0, 0, 0, errors.Join(errors.New("got error while decoding length (then branch)"), err)
+	}
 
-					if err != nil {
-						return UndefinedExpression, nil, errors.Join(errors.New("got error while running body"), err)
-					}
+	thenStart := vm.Idx
 
-					if bodyVM.EarlyExit {
-						switch bodyVM.ExitCode {
-						case BreakCode:
-							break
-						case ReturnCode:
-							vm.ExitCode = ReturnCode
-							vm.EarlyExit = true
-							vm.Idx = len(vm.Code)
+	vm.Idx += thenLength
 
-							if bodyVM.ReturnValue != nil {
-								vm.ReturnValue = bodyVM.ReturnValue
+	if vm.Idx >= len(vm.Code) || vm.Code[vm.Idx] != B_JUMP {
+		return false, 0, 0, 0, errors.New("expected jump over the else branch")
+	}
 
-								return TypeLiteral, bodyVM.ReturnValue, nil
-							} else {
-								return NoValue, nil, nil
-							}
-						}
+	vm.Idx++
 
-						if bodyVM.ExitCode == BreakCode {
-							break
-						}
-					}
+	elseLength, err := vm.decodeLen()
 
-					res, err = condidionVM.callFunction(nextFunc.Value.(PartsCallable), []*Literal{})
+	if err != nil {
+		return false, 0, 0, 0, errors.Join(errors.New("got error while decoding length (else branch)"), err)
+	}
 
-					if err != nil {
-						return UndefinedExpression, nil, errors.Join(errors.New("got error while running loop condidion iterator"), err)
-					}
-				}
+	return condition, thenStart, vm.Idx, vm.Idx + elseLength, nil
+}
+
+// runLoop runs B_LOOP at start. When the body jumps back the loop is found in the
+// scope of the iteration, condition of `for iterator` isn't ran again then. Every
+// iteration gets its own scope, once the loop is done VM jumps past B_END_LOOP.
+func (vm *VM) runLoop(start, conditionStart, conditionEnd, bodyStart, bodyEnd int) error {
+	state, env := vm.activeLoop(start)
+
+	if state == nil {
+		state, env = &loopState{vm: vm, Start: start, Line: vm.Line}, vm.Enviroment
+	}
+
+	//Leaves the scope of the last iteration, with everything the body opened in there
+	vm.Enviroment = env
+
+	running := false
+
+	if state.next == nil {
+		condition, err := vm.loopCondition(conditionStart, conditionEnd)
+
+		if err != nil {
+			return err
+		}
+
+		switch condition.LiteralType {
+		case BoolLiteral:
+			running = condition.Value.(bool)
+		case ParsedObjLiteral:
+			if state.next, err = iteratorNext(condition); err != nil {
+				return err
 			}
+
+			state.Iterator = condition
 		}
+	}
+
+	var it *Literal
+
+	if state.next != nil {
+		res, err := vm.callFunction(state.next, []*Literal{})
+
+		if err != nil {
+			return errors.Join(errors.New("got error while running loop condition iterator"), err)
+		}
+
+		if running = IsOptionSome(res); running {
+			it = res.Value.(PartsSpecialObject).GetByKey("RTValue")
+		}
+	}
+
+	vm.Coverage.branch(vm.Source, state.Line, running)
+
+	if !running {
+		vm.Idx = bodyEnd + 1
+
+		return nil
+	}
+
+	vm.Enviroment = &VMEnviroment{Enclosing: env, loop: state}
+	vm.Idx = bodyStart
+
+	if it != nil {
+		vm.Enviroment.Define("it", it)
+	}
+
+	return nil
+}
+
+// activeLoop returns the loop at start and the scope it runs in, nil when the
+// innermost loop of this VM is a different one
+func (vm *VM) activeLoop(start int) (*loopState, *VMEnviroment) {
+	for env := vm.Enviroment; env != nil; env = env.Enclosing {
+		if env.loop == nil || env.loop.vm != vm {
+			continue
+		}
+
+		if env.loop.Start != start {
+			return nil, nil
+		}
+
+		return env.loop, env.Enclosing
+	}
+
+	return nil, nil
+}
+
+// endLoop leaves the innermost loop of this VM, scopes opened in the body are left as well
+func (vm *VM) endLoop() error {
+	for env := vm.Enviroment; env != nil; env = env.Enclosing {
+		if env.loop != nil && env.loop.vm == vm {
+			vm.Enviroment = env.Enclosing
+
+			return vm.closeLoop(env.loop)
+		}
+	}
+
+	return errors.New("leaving loop that isn't running")
+}
+
+// closeLoops closes loops of this VM that are still running
+func (vm *VM) closeLoops() {
+	for env := vm.Enviroment; env != nil; env = env.Enclosing {
+		if env.loop != nil && env.loop.vm == vm {
+			vm.closeLoop(env.loop)
+		}
+	}
+}
+
+// closeLoop calls `close` of the iterator the loop is over, if it has one
+func (vm *VM) closeLoop(state *loopState) error {
+	if state.Iterator == nil {
+		return nil
+	}
+
+	closeFunc := iteratorClose(state.Iterator)
+	state.Iterator = nil
+
+	if closeFunc == nil {
+		return nil
+	}
+
+	if _, err := vm.callFunction(closeFunc, []*Literal{}); err != nil {
+		return errors.Join(errors.New("got error while closing loop iterator"), err)
+	}
+
+	return nil
+}
+
+func (vm *VM) loopCondition(start, end int) (*Literal, error) {
+	vm.Idx = start
+	vm.LastExpr = nil
+
+	if err := vm.runRange(start, end); err != nil {
+		return nil, errors.Join(errors.New("got error while running condidion"), err)
+	}
+
+	if vm.LastExpr == nil {
+		return nil, errors.New("expected value as loop condition")
+	}
+
+	condition, err := vm.simplifyLiteral(vm.LastExpr, true)
+
+	if err != nil {
+		return nil, errors.Join(errors.New("got error while running condidion (simplyfing)"), err)
+	}
+
+	return condition, nil
+}
+
+// iteratorNext returns the `next` function of the object used as loop condition
+func iteratorNext(iterator *Literal) (PartsCallable, error) {
+	var nextFunc *Literal
+
+	if iterator.Value.(PartsIndexable).TypeHash() == "Parts.Iterator" {
+		nextFunc = iterator.Value.(PartsSpecialObject).Get(&Literal{LiteralType: RefLiteral, Value: "next"})
+	} else {
+		nextFunc = iterator.Value.(PartsIndexable).Get(&Literal{LiteralType: RefLiteral, Value: "next"})
+
+		if nextFunc == nil || nextFunc.LiteralType != FunLiteral {
+			return nil, errors.New("expected function type in object field")
+		}
+	}
+
+	return nextFunc.Value.(PartsCallable), nil
+}
+
+// iteratorClose returns the `close` function of the object used as loop condition, nil when there's none
+func iteratorClose(iterator *Literal) PartsCallable {
+	closeFunc := iterator.Value.(PartsIndexable).Get(&Literal{LiteralType: RefLiteral, Value: "close"})
+
+	if closeFunc == nil || closeFunc.LiteralType != FunLiteral {
+		return nil
+	}
+
+	return closeFunc.Value.(PartsCallable)
+}
+
+// readLocal decodes depth and slot of B_LOAD_LOCAL and B_STORE_LOCAL
+func (vm *VM) readLocal() (*VMEnviroment, int, error) {
+	depth, err := vm.decodeLen()
+
+	if err != nil {
+		return nil, 0, errors.Join(errors.New("got error while decoding depth (local)"), err)
+	}
+
+	slot, err := vm.decodeLen()
+
+	if err != nil {
+		return nil, 0, errors.Join(errors.New("got error while decoding slot (local)"), err)
+	}
+
+	env := vm.Enviroment.enclosing(depth)
+
+	if env == nil || slot >= len(env.Locals) {
+		return nil, 0, fmt.Errorf("local variable not found (depth %d, slot %d)", depth, slot)
+	}
+
+	return env, slot, nil
+}
+
+// runTailCall handles `return f(args)`, Parts functions are handed to the
+// frame so callFunctionVM can run them without growing the stack
+func (vm *VM) runTailCall(frame *CallFrame) (ExpressionType, any, error) {
+	vm.Idx++
+
+	fun, values, err := vm.readCall()
+
+	if err != nil {
+		return UndefinedExpression, nil, err
+	}
+
+	if decl, ok := fun.(FunctionDeclaration); ok && !decl.Generator {
+		frame.tail = &tailCall{fun: fun, args: values, env: vm.Enviroment, name: vm.callee}
+		vm.callee = ""
+		vm.ReturnValue = nil
 
 		return NoValue, nil, nil
-	case B_CONTINUE, B_BREAK, B_RAISE, B_RETURN:
-		code := vm.Code[vm.Idx]
+	}
 
-		vm.Idx++
-		vm.EarlyExit = true
+	funResult, err := vm.callFunction(fun, values)
+
+	if err != nil {
+		return UndefinedExpression, nil, errors.Join(errors.New("got error while executing function body"), err)
+	}
+
+	vm.ReturnValue = funResult
+
+	return NoValue, nil, nil
+}
+
+// readCall reads callee and arguments of B_CALL, vm.Idx has to point past the opcode
+func (vm *VM) readCall() (PartsCallable, []*Literal, error) {
+	name := vm.calleeName()
+
+	exprType, expr, err := vm.runExpr(true)
+
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("got error while running expression"), err)
+	}
+
+	if exprType != TypeLiteral {
+		return nil, nil, fmt.Errorf("expected value got %d (call)", exprType)
+	}
+
+	resolvedExpr, err := vm.simplifyLiteral(expr.(*Literal), true)
+
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("got error while running expression"), err)
+	}
+
+	fun, self, err := callable(resolvedExpr)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make([]*Literal, vm.Code[vm.Idx])
 
-		switch code {
-		case B_RAISE, B_RETURN:
-			vm.ExitCode = ReturnCode
-		case B_CONTINUE:
-			vm.ExitCode = ContinueCode
-		case B_BREAK:
-			vm.ExitCode = BreakCode
+	vm.Idx++
+
+	for i := range values {
+		exprType, expr, err := vm.runExpr(true)
+
+		if err != nil {
+			return nil, nil, errors.Join(errors.New("got error while running expression"), err)
 		}
 
-		if code == B_RAISE || code == B_RETURN {
-			exprType, val, err := vm.runExpr(true)
+		if exprType != TypeLiteral {
+			return nil, nil, fmt.Errorf("expected value got %d (resolve call arguments)", exprType)
+		}
 
-			if err != nil {
-				return UndefinedExpression, nil, errors.Join(errors.New("got error while running variable value (B_RAISE)"), err)
-			}
+		resolvedExpr, err := vm.simplifyLiteral(expr.(*Literal), true)
 
-			if exprType != TypeLiteral {
-				return UndefinedExpression, nil, errors.New("expected literal as variable name")
+		if err != nil {
+			return nil, nil, errors.Join(errors.New("got error while simplyfing expression"), err)
+		}
+
+		values[i] = resolvedExpr
+	}
+
+	if self != nil {
+		values = append([]*Literal{self}, values...)
+	}
+
+	vm.callee = name
+
+	return fun, values, nil
+}
+
+// calleeName returns name of the function called by code at vm.Idx, empty when neither profiling nor debugging
+func (vm *VM) calleeName() string {
+	if (vm.Profiler == nil && vm.Debugger == nil) || vm.Idx >= len(vm.Code) {
+		return ""
+	}
+
+	idx := vm.Idx
+
+	defer func() { vm.Idx = idx }()
+
+	switch vm.Code[vm.Idx] {
+	case B_LITERAL:
+		vm.Idx++
+
+		if literalIdx, err := vm.decodeLen(); err == nil && literalIdx < len(vm.Literals) {
+			if name, ok := vm.Literals[literalIdx].Value.(string); ok && vm.Literals[literalIdx].LiteralType == RefLiteral {
+				return name
 			}
+		}
+	case B_LOAD_LOCAL:
+		vm.Idx++
 
-			simplifed, err := vm.simplifyLiteral(val.(*Literal), true)
+		if env, slot, err := vm.readLocal(); err == nil {
+			return env.Locals[slot].Name
+		}
+	}
+
+	return ""
+}
+
+// dotName returns name of the method called with a dot, empty when neither profiling nor debugging
+func (vm *VM) dotName(accessor, key *Literal) string {
+	if vm.Profiler == nil && vm.Debugger == nil {
+		return ""
+	}
+
+	name := fmt.Sprint(key.Value)
+
+	if accessorName, ok := accessor.Value.(string); ok && accessor.LiteralType == RefLiteral {
+		return accessorName + "." + name
+	}
+
+	return name
+}
+
+func (vm *VM) runDot(rawAccessor *Literal, unwindDot bool, optional bool) (ExpressionType, any, error) {
+	accessor := rawAccessor
+
+	if accessor.LiteralType == RefLiteral {
+		if acc, err := vm.simplifyLiteral(accessor, true); err == nil {
+			accessor = acc
+		} else {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while resolving reference (running dot accessor)"), err)
+		}
+	}
+
+	switch accessor.LiteralType {
+	case ListLiteral, ObjLiteral, ParsedListLiteral, ParsedObjLiteral, PointerLiteral:
+	default:
+		return UndefinedExpression, nil, fmt.Errorf("unexpected value type (%d) (B_DOT)", accessor.LiteralType)
+	}
+
+	if accessor.LiteralType == ListLiteral || accessor.LiteralType == ObjLiteral {
+		simplified, err := vm.simplifyLiteral(accessor, true)
+
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while running expression"), err)
+		}
+
+		accessor = simplified
+	}
+
+	if vm.Code[vm.Idx] == B_SET {
+		vm.Idx++
+
+		val, err := vm.handleNestedSet(rawAccessor)
+
+		if err != nil {
+			return UndefinedExpression, nil, errors.Join(errors.New("got error while setting field (B_DOT, B_SET)"), err)
+		}
+
+		vm.LastExpr = val
+
+		return TypeLiteral, val, nil
+	}
+
+	fCall := false
+
+	if vm.Code[vm.Idx] == B_CALL {
+		fCall = true
+		vm.Idx++
+	}
+
+	exprType, rawKey, err := vm.runExpr(unwindDot)
+
+	if err != nil {
+		return UndefinedExpression, nil, errors.Join(errors.New("got error while running expression"), err)
+	}
+
+	if exprType != TypeLiteral && exprType != DotExpression {
+		return UndefinedExpression, nil, errors.Join(fmt.Errorf("expected value got %d (dot value)", exprType), err)
+	}
+
+	argCount := 0
+
+	if fCall {
+		argCount = int(vm.Code[vm.Idx])
+		vm.Idx++
+	}
+
+	if !unwindDot {
+		resVal := []*Literal{rawAccessor}
+
+		if exprType == TypeLiteral {
+			resVal = append(resVal, rawKey.(*Literal))
+		} else {
+			resVal = append(resVal, rawKey.([]*Literal)...)
+		}
+
+		return DotExpression, resVal, nil
+	}
+
+	key, err := HashLiteral(*rawKey.(*Literal))
+
+	if err != nil {
+		return UndefinedExpression, nil, errors.Join(errors.New("got error while hashing value"), err)
+	}
+
+	var rVal *Literal
+	has := false
+
+	if accessor.LiteralType == PointerLiteral {
+		//Go values only have methods
+		rVal, has = ffiMethod(reflect.ValueOf(accessor.Value), key)
+	} else if has = accessor.Value.(PartsIndexable).HasByKey(key); has {
+		rVal = accessor.Value.(PartsIndexable).GetByKey(key)
+	} else if rVal, has, err = vm.metaIndex(accessor, key); err != nil {
+		return UndefinedExpression, nil, errors.Join(errors.New("got error while running __index"), err)
+	}
+
+	if has {
+
+		if fCall {
+			rx, err := vm.handleNestedCall(rVal, argCount, vm.dotName(rawAccessor, rawKey.(*Literal)))
 
 			if err != nil {
-				return UndefinedExpression, nil, errors.Join(errors.New("got error while simplyfing raise value"), err)
+				return UndefinedExpression, nil, errors.Join(errors.New("got error while calling function (B_DOT, B_CALL)"), err)
 			}
 
-			if code == B_RAISE {
-				if IsResult(simplifed) {
-					vm.ReturnValue = simplifed
-				} else {
-					vm.ReturnValue = NewResultError(simplifed)
-				}
+			if rx == nil {
+				vm.LastExpr = nil
+				return NoValue, nil, nil
 			}
+
+			vm.LastExpr = rx
+			return TypeLiteral, rx, nil
 		}
 
-		return NoValue, nil, nil
-	default:
-		return UndefinedExpression, nil, fmt.Errorf("unrecognized bytecode: %d", vm.Code[vm.Idx])
+		vm.LastExpr = rVal
+		return TypeLiteral, rVal, nil
+	} else if optional && !fCall {
+		vm.LastExpr = &Literal{NilLiteral, nil}
+		return TypeLiteral, vm.LastExpr, nil
+	} else {
+		return UndefinedExpression, nil, fmt.Errorf("key not found: %s", key)
 	}
 }
 
@@ -882,48 +1433,114 @@ func (vm *VM) callFunction(fun PartsCallable, args []*Literal) (*Literal, error)
 	return val, err
 }
 
-func (vm *VM) callFunctionVM(fun PartsCallable, args []*Literal) (*VM, *Literal, error) {
-	funArgs := fun.GetArguments()
-
-	if len(funArgs) > len(args) {
-		return nil, nil, errors.New("got less arguments than expected")
+func (vm *VM) callFunctionVM(fun PartsCallable, args []*Literal) (callVM *VM, value *Literal, err error) {
+	if err := vm.context().Err(); err != nil {
+		return nil, nil, errors.Join(errors.New("stopped before calling function"), err)
 	}
 
-	tempVM := vm.copyVM()
+	stack := vm.callStack()
+
+	frame, err := stack.push(fun, args)
 
-	for idx, key := range funArgs {
-		tempVM.Enviroment.define(fmt.Sprintf("RT%s", key), args[idx])
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if err := fun.Call(&tempVM); err != nil {
-		return &tempVM, nil, errors.Join(errors.New("got error while running function body"), err)
+	defer stack.pop()
+
+	if vm.Hooks != nil {
+		vm.Hooks.OnCall(fun, args)
+
+		defer func() {
+			if err == nil {
+				vm.Hooks.OnReturn(value)
+			}
+		}()
 	}
 
-	if tempVM.EarlyExit {
-		if tempVM.ExitCode == ReturnCode {
-			if tempVM.ReturnValue != nil {
-				return &tempVM, tempVM.ReturnValue, nil
+	vm.Profiler.enterCall(fun, vm.callee)
+	vm.Debugger.enter(fun, vm.callee)
+	vm.callee = ""
+
+	defer vm.Profiler.exit()
+	defer vm.Debugger.exit()
+
+	base := vm.Enviroment
+	env := base
+
+	for {
+		funArgs := fun.GetArguments()
+
+		if len(funArgs) > len(args) {
+			return nil, nil, errors.New("got less arguments than expected")
+		}
+
+		tempVM := vm.copyVM()
+		tempVM.Enviroment.Enclosing = env
+		tempVM.Enviroment.Locals = make([]LocalVariable, 0, len(funArgs))
+		tempVM.Generator = nil
+
+		//Arguments take the first slots, see Resolver.function
+		for idx, key := range funArgs {
+			tempVM.Enviroment.declareLocal(key, args[idx])
+		}
+
+		if variadic, ok := fun.(VariadicCallable); ok {
+			if name, ok := variadic.Variadic(); ok {
+				tempVM.Enviroment.declareLocal(name, &Literal{ParsedListLiteral, NewPartsList(slices.Clone(args[len(funArgs):])...)})
 			}
+		}
 
-			return &tempVM, nil, nil
+		if err := fun.Call(&tempVM); err != nil {
+			return &tempVM, nil, errors.Join(errors.New("got error while running function body"), err)
 		}
 
-		if !slices.Contains([]ExitCode{ReturnCode, NormalCode}, tempVM.ExitCode) {
-			return nil, nil, fmt.Errorf("unexpected exit code in function call %d", tempVM.ExitCode)
+		if frame.tail != nil {
+			//Tail call, reuse the frame and run the next function in place
+			fun, args, env = frame.tail.fun, frame.tail.args, frame.tail.scope(base)
+
+			vm.Profiler.exit()
+			vm.Profiler.enterCall(fun, frame.tail.name)
+
+			vm.Debugger.exit()
+			vm.Debugger.enter(fun, frame.tail.name)
+
+			if vm.Hooks != nil {
+				vm.Hooks.OnReturn(nil)
+				vm.Hooks.OnCall(fun, args)
+			}
+
+			frame.Function, frame.Args, frame.tail = fun, args, nil
+
+			continue
 		}
-	}
 
-	if tempVM.LastExpr != nil {
-		simplified, err := tempVM.simplifyLiteral(tempVM.LastExpr, true)
+		if tempVM.EarlyExit {
+			if tempVM.ExitCode == ReturnCode {
+				if tempVM.ReturnValue != nil {
+					return &tempVM, tempVM.ReturnValue, nil
+				}
 
-		if err != nil {
-			return nil, nil, errors.Join(errors.New("got error while simplyfing expression (processing function result)"), err)
+				return &tempVM, nil, nil
+			}
+
+			if !slices.Contains([]ExitCode{ReturnCode, NormalCode}, tempVM.ExitCode) {
+				return nil, nil, fmt.Errorf("unexpected exit code in function call %d", tempVM.ExitCode)
+			}
 		}
 
-		return &tempVM, simplified, nil
-	}
+		if tempVM.LastExpr != nil {
+			simplified, err := tempVM.simplifyLiteral(tempVM.LastExpr, true)
+
+			if err != nil {
+				return nil, nil, errors.Join(errors.New("got error while simplyfing expression (processing function result)"), err)
+			}
 
-	return &tempVM, nil, nil
+			return &tempVM, simplified, nil
+		}
+
+		return &tempVM, nil, nil
+	}
 }
 
 func (vm *VM) runOp() (*Literal, error) {
@@ -963,6 +1580,15 @@ func (vm *VM) runOp() (*Literal, error) {
 		return nil, errors.Join(errors.New("got error while simplyfing right operand"), err)
 	}
 
+	if result, ok, err := vm.runMetaOp(opcode, simpleLeft, simpleRight); ok {
+		return result, err
+	}
+
+	return applyOp(opcode, simpleLeft, simpleRight)
+}
+
+// applyOp runs the operation on simplified operands, shared with the Optimizer
+func applyOp(opcode Bytecode, simpleLeft, simpleRight *Literal) (*Literal, error) {
 	switch opcode {
 	case B_OP_ADD:
 		return simpleLeft.opAdd(simpleRight)
@@ -980,9 +1606,27 @@ func (vm *VM) runOp() (*Literal, error) {
 		return simpleLeft.opLt(simpleRight)
 	case B_OP_MOD:
 		return simpleLeft.opMod(simpleRight)
+	case B_OP_BIT_AND:
+		return simpleLeft.opBitAnd(simpleRight)
+	case B_OP_BIT_OR:
+		return simpleLeft.opBitOr(simpleRight)
+	case B_OP_BIT_XOR:
+		return simpleLeft.opBitXor(simpleRight)
+	case B_OP_SHL:
+		return simpleLeft.opShiftLeft(simpleRight)
+	case B_OP_SHR:
+		return simpleLeft.opShiftRight(simpleRight)
+	case B_OP_POW:
+		return simpleLeft.opPow(simpleRight)
+	case B_OP_FLOOR_DIV:
+		return simpleLeft.opFloorDiv(simpleRight)
+	case B_OP_GT_EQ:
+		return simpleLeft.opGtEq(simpleRight)
+	case B_OP_LT_EQ:
+		return simpleLeft.opLtEq(simpleRight)
 
 	default:
-		return nil, fmt.Errorf("unrecognized operation: %d", vm.Code[vm.Idx])
+		return nil, fmt.Errorf("unrecognized operation: %d", opcode)
 	}
 }
 
@@ -1058,25 +1702,17 @@ func (vm *VM) simplifyLiteral(literal *Literal, resolveRef bool) (*Literal, erro
 				return nil, errors.Join(fmt.Errorf("error simplyfing object value idx: %d", i), err)
 			}
 
-			objectData.Entries[entryKey] = simplifiedValue
+			objectData.SetByKey(entryKey, simplifiedValue)
 		}
 
 		return &Literal{LiteralType: ParsedObjLiteral, Value: &objectData}, nil
 	}
 
 	if literal.LiteralType == ListLiteral {
-		objectData := PartsObject{Entries: make(map[string]*Literal)}
-
-		for i, entry := range literal.Value.(ListDefinition).Entries {
-			entryKey, err := HashLiteral(Literal{
-				LiteralType: IntLiteral,
-				Value:       i,
-			})
-
-			if err != nil {
-				return nil, errors.Join(fmt.Errorf("error encoding index, idx: %d", i), err)
-			}
+		entries := literal.Value.(ListDefinition).Entries
+		values := make([]*Literal, len(entries))
 
+		for i, entry := range entries {
 			tempVM := vm.newVM(entry)
 
 			exprType, resolvedValue, err := tempVM.runExpr(true)
@@ -1095,10 +1731,10 @@ func (vm *VM) simplifyLiteral(literal *Literal, resolveRef bool) (*Literal, erro
 				return nil, errors.Join(fmt.Errorf("got error while simplyfing array element, idx: %d", i), err)
 			}
 
-			objectData.Entries[entryKey] = simplifiedValue
+			values[i] = simplifiedValue
 		}
 
-		return &Literal{LiteralType: ParsedListLiteral, Value: &objectData}, nil
+		return &Literal{LiteralType: ParsedListLiteral, Value: NewPartsList(values...)}, nil
 	}
 
 	return literal, nil
@@ -1146,19 +1782,25 @@ func (vm *VM) newVM(code []Bytecode) VM {
 }
 
 func (vm *VM) copyVM() VM {
-	env := VMEnviroment{
-		Enclosing: vm.Enviroment,
-		Values:    make(map[string]*Literal),
-	}
-
 	return VM{
-		Enviroment:  &env,
+		Enviroment:  &VMEnviroment{Enclosing: vm.Enviroment},
 		Idx:         0,
 		ReturnValue: nil,
 		EarlyExit:   false,
 		Code:        []Bytecode{},
 		Literals:    vm.Literals,
 		Meta:        vm.Meta,
+		Generator:   vm.Generator,
+		CallStack:   vm.callStack(),
+		Profiler:    vm.Profiler,
+		Debugger:    vm.Debugger,
+		Hooks:       vm.Hooks,
+		Coverage:    vm.Coverage,
+		Modules:     vm.Modules,
+		Context:     vm.Context,
+		generators:  vm.generatorSet(),
+		Source:      vm.Source,
+		Line:        vm.Line,
 	}
 }
 
@@ -1167,9 +1809,29 @@ type PartsCallable interface {
 	GetArguments() []string
 }
 
+// VariadicCallable takes any number of arguments after the ones from
+// GetArguments, they are declared as list under the name Variadic returns
+type VariadicCallable interface {
+	PartsCallable
+	Variadic() (string, bool)
+}
+
 func (f FunctionDeclaration) Call(vm *VM) error {
 	vm.Code = f.Body
 
+	if f.Generator {
+		bodyVM := vm.newVM(f.Body)
+
+		//Body runs in the call scope, so arguments keep their slots
+		bodyVM.Enviroment = vm.Enviroment
+
+		vm.ReturnValue = NewGenerator(&bodyVM).Iterator()
+		vm.ExitCode = ReturnCode
+		vm.EarlyExit = true
+
+		return nil
+	}
+
 	if err := vm.Run(); err != nil {
 		return err
 	}
@@ -1195,8 +1857,36 @@ type PartsIndexable interface {
 	TypeHash() string
 }
 
+// OrderedIndexable is PartsIndexable that keeps order of its keys (like objects
+// in insertion order), keys of other values are listed sorted
+type OrderedIndexable interface {
+	PartsIndexable
+
+	Keys() []string
+}
+
+// orderedKeys returns keys in the order the value keeps, sorted when it doesn't keep one
+func orderedKeys(obj PartsIndexable) []string {
+	if ordered, ok := obj.(OrderedIndexable); ok {
+		return ordered.Keys()
+	}
+
+	keys := make([]string, 0, obj.Length())
+
+	for key := range obj.GetAll() {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
 type PartsObject struct {
 	Entries map[string]*Literal
+
+	//Keys in insertion order, keys put straight into Entries are sorted after them
+	Order []string
 }
 
 func (o *PartsObject) Get(key *Literal) *Literal {
@@ -1241,7 +1931,44 @@ func (o *PartsObject) GetByKey(key string) *Literal {
 	return o.Entries[key]
 }
 
+// Keys returns keys in the order they were set
+func (o *PartsObject) Keys() []string {
+	if len(o.Order) == len(o.Entries) {
+		return slices.Clone(o.Order)
+	}
+
+	keys := make([]string, 0, len(o.Entries))
+	seen := make(map[string]bool, len(o.Entries))
+
+	for _, key := range o.Order {
+		if _, ok := o.Entries[key]; ok && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+
+	rest := make([]string, 0, len(o.Entries)-len(keys))
+
+	for key := range o.Entries {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+
+	slices.Sort(rest)
+
+	return append(keys, rest...)
+}
+
 func (o *PartsObject) SetByKey(key string, value *Literal) *Literal {
+	if o.Entries == nil {
+		o.Entries = make(map[string]*Literal)
+	}
+
+	if _, exists := o.Entries[key]; !exists {
+		o.Order = append(o.Order, key)
+	}
+
 	o.Entries[key] = value
 
 	return value
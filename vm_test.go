@@ -1,9 +1,19 @@
 package parts
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestHelperNoTags(t *testing.T) {
@@ -94,6 +104,40 @@ func TestHelperWithList(t *testing.T) {
 	}
 }
 
+func TestHelperWithStructList(t *testing.T) {
+	type Item struct {
+		Id    int `parts:"id"`
+		Count int `parts:"count"`
+	}
+
+	type TestStruct struct {
+		Items []Item `parts:"items"`
+	}
+
+	vm, err := GetVMWithSource("let items = [|> id: 1, count: 2 <|, given]", "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	given, _ := LiteralFromGo(Item{Id: 2, Count: 5})
+	vm.Enviroment.Values["RTgiven"] = given
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	if expected := []Item{{1, 2}, {2, 5}}; !slices.Equal(testStruct.Items, expected) {
+		t.Errorf("inexpected values in the interface got (%v) expected (%v)", testStruct.Items, expected)
+	}
+}
+
 func TestHelperWithObject(t *testing.T) {
 	type TestStruct struct {
 		Loot struct {
@@ -569,6 +613,8 @@ func TestIfNoElse(t *testing.T) {
 			t.Error(errors.New("expected different kind of errror"))
 			return
 		}
+
+		return
 	}
 
 	println(err)
@@ -604,6 +650,95 @@ func TestMath(t *testing.T) {
 	}
 }
 
+func TestDoubleToGo(t *testing.T) {
+	type TestStruct struct {
+		Res float64 `parts:"res"`
+	}
+
+	vm, err := GetVMWithSource(`let x = 1`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = vm.Enviroment.AppendValues(map[string]any{"res": 4.5})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = vm.Run()
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	if testStruct.Res != 4.5 {
+		t.Errorf("field value didn't matched got (%f) expected (%f)", testStruct.Res, 4.5)
+		return
+	}
+}
+
+func TestIntegerMath(t *testing.T) {
+	type TestStruct struct {
+		And      int     `parts:"and"`
+		Or       int     `parts:"or"`
+		Xor      int     `parts:"xor"`
+		Shl      int     `parts:"shl"`
+		Shr      int     `parts:"shr"`
+		Pow      int     `parts:"pow"`
+		PowFloat float64 `parts:"powFloat"`
+		Floor    int     `parts:"floor"`
+		FloorNeg int     `parts:"floorNeg"`
+		Flag     bool    `parts:"flag"`
+	}
+
+	vm, err := GetVMWithSource(`let and = 12 & 10
+		let or = 12 | 3
+		let xor = 12 ^ 10
+		let shl = 1 << 10
+		let shr = 1024 >> 3
+		let pow = 3 ** 4
+		let powFloat = 2 ** (0 - 1)
+		let floor = 7 // 2
+		let floorNeg = (0 - 7) // 2
+		let flag = true ^ false`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	expected := TestStruct{And: 8, Or: 15, Xor: 6, Shl: 1024, Shr: 128, Pow: 81, PowFloat: 0.5, Floor: 3, FloorNeg: -4, Flag: true}
+
+	if testStruct != expected {
+		t.Errorf("struct value didn't matched got (%+v) expected (%+v)", testStruct, expected)
+		return
+	}
+
+	for _, code := range []string{`1.5 & 1`, `"a" << 1`, `1 >> (0 - 1)`, `"a" ** 2`, `1 // 0`} {
+		if _, err := RunString(code, "./"); err == nil {
+			t.Errorf("expected error for (%s) but got none", code)
+		}
+	}
+}
+
 func TestEq(t *testing.T) {
 	type TestStruct struct {
 		Res bool `parts:"res"`
@@ -1104,6 +1239,41 @@ func TestBlockReturn(t *testing.T) {
 	}
 }
 
+func TestReturnConditional(t *testing.T) {
+	vm, err := RunString(`let pick(c) {
+			return if c { "yes" } else { "no" }
+		}
+		let check(c) {
+			raise if c { "failed" } else { "other" }
+		}
+		let last(c) {
+			if c { 1 } else { 2 }
+		}`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, err := vm.Call("pick", true); err != nil || res != "yes" {
+		t.Errorf("expected 'yes' got %v (%v)", res, err)
+	}
+
+	if res, err := vm.Call("pick", false); err != nil || res != "no" {
+		t.Errorf("expected 'no' got %v (%v)", res, err)
+	}
+
+	var raised *RaisedError
+
+	if _, err := vm.Call("check", true); !errors.As(err, &raised) || raised.Value.Value != "failed" {
+		t.Errorf("expected raised error got %v", err)
+	}
+
+	if res, err := vm.Call("last", false); err != nil || res != 2 {
+		t.Errorf("expected 2 got %v (%v)", res, err)
+	}
+}
+
 func TestFuncSimplified(t *testing.T) {
 	type TestStruct struct {
 		IsValid func(...any) (any, error)
@@ -1248,3 +1418,2756 @@ func TestNestedFunctionCalls(t *testing.T) {
 		return
 	}
 }
+
+func TestNilLiteral(t *testing.T) {
+	vm, err := GetVMWithSource(`let empty = nil
+		let isNil = empty == nil
+		let res = if empty { 1 } else { 2 }`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	empty, err := vm.Enviroment.Resolve("empty")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if empty.LiteralType != NilLiteral {
+		t.Errorf("expected nil literal got (%d)", empty.LiteralType)
+		return
+	}
+
+	type TestStruct struct {
+		IsNil bool `parts:"isNil"`
+		Res   int  `parts:"res"`
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	if !testStruct.IsNil {
+		t.Error("expected nil to be equal to nil")
+		return
+	}
+
+	if testStruct.Res != 2 {
+		t.Errorf("field value didn't matched got (%d) expected (%d)", testStruct.Res, 2)
+	}
+}
+
+func TestNilFromGo(t *testing.T) {
+	type Mob struct{ Id string }
+
+	vm, err := GetVMWithSource(`let res = getMob() == nil; let none = noop()`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	vm.Enviroment.DefineFunction("getMob", func() *Mob { return nil })
+	vm.Enviroment.DefineFunction("noop", func() {})
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	type TestStruct struct {
+		Res bool `parts:"res"`
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	if !testStruct.Res {
+		t.Error("expected nil pointer to be converted to nil")
+		return
+	}
+
+	none, err := vm.Enviroment.Resolve("none")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if none.LiteralType != NilLiteral {
+		t.Errorf("expected nil literal got (%d)", none.LiteralType)
+	}
+}
+
+func TestOptionalChaining(t *testing.T) {
+	type TestStruct struct {
+		Name    string `parts:"name"`
+		Missing int    `parts:"missing"`
+		Empty   int    `parts:"empty"`
+	}
+
+	vm, err := GetVMWithSource(`let mob = |> stats: |> name: "Smok" <| <|
+		let nothing = nil
+		let name = mob?.stats?.name ?? "unknown"
+		let missing = mob?.loot ?? 1
+		let empty = nothing?.stats ?? 2`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	if testStruct.Name != "Smok" {
+		t.Errorf("field value didn't matched got (%s) expected (%s)", testStruct.Name, "Smok")
+		return
+	}
+
+	if testStruct.Missing != 1 {
+		t.Errorf("field value didn't matched got (%d) expected (%d)", testStruct.Missing, 1)
+		return
+	}
+
+	if testStruct.Empty != 2 {
+		t.Errorf("field value didn't matched got (%d) expected (%d)", testStruct.Empty, 2)
+	}
+}
+
+func TestOptionalChainShortCircuit(t *testing.T) {
+	vm, err := GetVMWithSource(`let calls = 0
+		let count() { calls = calls + 1 }
+		let n = nil
+		let obj = |> x: |> y: 3 <|, f: fun() { return 5 } <|
+		let called = nil?.f()
+		let skipped = n?.f(count())
+		let nested = n?.x.y
+		let found = obj?.x.y
+		let result = obj?.f()`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	values := vm.Enviroment.Values
+
+	for _, name := range []string{"RTcalled", "RTskipped", "RTnested"} {
+		if values[name].LiteralType != NilLiteral {
+			t.Errorf("expected %s to be nil got %s", name[2:], values[name].pretify())
+		}
+	}
+
+	if calls := values["RTcalls"].Value; calls != 0 {
+		t.Errorf("expected arguments of skipped call not to run got (%v) calls", calls)
+	}
+
+	if found := values["RTfound"].Value; found != 3 {
+		t.Errorf("field value didn't matched got (%v) expected (%d)", found, 3)
+	}
+
+	if result := values["RTresult"].Value; result != 5 {
+		t.Errorf("field value didn't matched got (%v) expected (%d)", result, 5)
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	type TestStruct struct {
+		Sum   int `parts:"sum"`
+		First int `parts:"first"`
+	}
+
+	vm, err := GetVMWithSource(`let count*(n) {
+			let i = 0
+
+			for (i < n) {
+				yield i
+				i = i + 1
+			}
+		}
+
+		let sum = 0
+
+		for count(5) {
+			sum = sum + it
+		}
+
+		let squares = fun*(n) {
+			let i = 1
+
+			for (i < n) {
+				yield i * i
+				i = i + 1
+			}
+		}
+
+		let iter = squares(10)
+		let skipped = iter.next()
+		let next = iter.next()
+		let first = next.Value
+
+		iter.close()`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	if testStruct.Sum != 10 {
+		t.Errorf("field value didn't matched got (%d) expected (%d)", testStruct.Sum, 10)
+		return
+	}
+
+	if testStruct.First != 4 {
+		t.Errorf("field value didn't matched got (%d) expected (%d)", testStruct.First, 4)
+	}
+}
+
+func TestYieldOutsideGenerator(t *testing.T) {
+	_, err := RunString(`let f() { yield 1 }; f()`, "./")
+
+	if err == nil {
+		t.Error(errors.New("expeced error but got none"))
+	}
+}
+
+func TestGeneratorNoLeak(t *testing.T) {
+	sources := []string{
+		`let numbers*() {
+			let n = 0
+
+			for true {
+				yield n
+				n = n + 1
+			}
+		}
+
+		for numbers() {
+			if it == 3 {
+				break
+			}
+		}`,
+		`let numbers*() {
+			let n = 0
+
+			for true {
+				yield n
+				n = n + 1
+			}
+		}
+
+		let first() {
+			for numbers() {
+				return it
+			}
+		}
+
+		let value = first()`,
+		`let numbers*() {
+			let n = 0
+
+			for true {
+				yield n
+				n = n + 1
+			}
+		}
+
+		let iter = numbers()
+		let skipped = iter.next()`,
+	}
+
+	before := runtime.NumGoroutine()
+
+	for _, source := range sources {
+		for range 20 {
+			if _, err := RunString(source, "./"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	//Closed generators exit right after handing control back
+	deadline := time.Now().Add(time.Second)
+
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("generator goroutines leaked got (%d) expected at most (%d)", after, before)
+	}
+}
+
+func TestTailCall(t *testing.T) {
+	type TestStruct struct {
+		Count  int  `parts:"count"`
+		Even   bool `parts:"even"`
+		Scoped int  `parts:"scoped"`
+	}
+
+	vm, err := GetVMWithSource(`let loop(n, acc) {
+			if n == 0 {
+				return acc
+			}
+
+			return loop(n - 1, acc + 1)
+		}
+
+		let isEven(n) {
+			if n == 0 {
+				return true
+			}
+
+			return isOdd(n - 1)
+		}
+
+		let isOdd(n) {
+			if n == 0 {
+				return false
+			}
+
+			return isEven(n - 1)
+		}
+
+		let outer(x) {
+			let helper() = x + 1
+
+			return helper()
+		}
+
+		let count = loop(50000, 0)
+		let even = isEven(20001)
+		let scoped = outer(41)`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	if testStruct.Count != 50000 {
+		t.Errorf("field value didn't matched got (%d) expected (%d)", testStruct.Count, 50000)
+		return
+	}
+
+	if testStruct.Even {
+		t.Errorf("field value didn't matched got (%t) expected (%t)", testStruct.Even, false)
+		return
+	}
+
+	if testStruct.Scoped != 42 {
+		t.Errorf("field value didn't matched got (%d) expected (%d)", testStruct.Scoped, 42)
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	vm, err := GetVMWithSource(`let down(n) {
+			if n == 0 {
+				return 0
+			}
+
+			let rest = down(n - 1)
+
+			return rest + 1
+		}
+
+		let shallow = down(10)
+		let deep = down(100)`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	vm.SetMaxCallDepth(50)
+
+	if err = vm.Run(); err == nil {
+		t.Error(errors.New("expeced error but got none"))
+		return
+	}
+
+	if !strings.Contains(err.Error(), "maximum call depth exceeded (50)") {
+		t.Errorf("unexpected error %s", err)
+		return
+	}
+
+	if vm.CallStack.Depth() != 0 {
+		t.Errorf("call stack not unwound got (%d) frames", vm.CallStack.Depth())
+	}
+}
+
+func TestTypeCheck(t *testing.T) {
+	err := CheckString(`let hp: Int = "full"
+		let heal(amount: Int, target: String): Bool {
+			if amount {
+				return 1
+			}
+
+			return true
+		}
+
+		let healed: Bool = heal(5, "mob")
+		let wrong = heal("mob", 5)
+		let missing = heal(5)
+		let total = 1 + "a"`, "./")
+
+	if err == nil {
+		t.Error(errors.New("expeced error but got none"))
+		return
+	}
+
+	expected := []string{
+		"'hp' declared as Int got String",
+		"in 'heal': condition should be Bool got Int",
+		"in 'heal': expected Bool as return value got Int",
+		"argument 1 ('amount') of 'heal' expected Int got String",
+		"argument 2 ('target') of 'heal' expected String got Int",
+		"'heal' expects 2 arguments got 1",
+		"operation '+' not supported between Int and String",
+	}
+
+	lines := strings.Split(err.Error(), "\n")
+
+	if len(lines) != len(expected) {
+		t.Errorf("expected %d errors got %d (%s)", len(expected), len(lines), err)
+		return
+	}
+
+	for idx, line := range expected {
+		if lines[idx] != line {
+			t.Errorf("unexpected error at %d got (%s) expected (%s)", idx, lines[idx], line)
+		}
+	}
+}
+
+func TestTypeCheckValid(t *testing.T) {
+	code := `let hp: Int = 10
+		let name: String? = nil
+		let scale(value: Int, by: Int): Int = value * by
+		let scaled: Int = scale(hp, 2)
+		let fallback: String = name ?? "none"
+		name = "mob"
+		hp = hp - 1`
+
+	if err := CheckString(code, "./"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := RunString(code, "./"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTypeCheckFFI(t *testing.T) {
+	type TestStruct struct {
+		Heal func(...any) (any, error) `parts:"heal"`
+		Bad  func(...any) (any, error) `parts:"bad"`
+	}
+
+	vm, err := GetVMWithSource(`let heal(amount: Int): Int = amount + 1
+		let bad(amount: Int): Int = "full"`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	if res, err := testStruct.Heal(1); err != nil || res.(int) != 2 {
+		t.Errorf("unexpected result (%v, %v)", res, err)
+		return
+	}
+
+	if _, err := testStruct.Heal("one"); err == nil {
+		t.Error(errors.New("expeced error for argument but got none"))
+		return
+	}
+
+	if _, err := testStruct.Bad(1); err == nil {
+		t.Error(errors.New("expeced error for return value but got none"))
+		return
+	}
+
+	vm, err = GetVMWithSource(`let res = double("two")`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	vm.Enviroment.DefineFunction("double", func(val int) int { return val * 2 })
+
+	if err = vm.Run(); err == nil || !strings.Contains(err.Error(), "invalid argument 1, expected Int (int) got String") {
+		t.Errorf("expected argument error got (%v)", err)
+	}
+}
+
+func TestLoopJumps(t *testing.T) {
+	type TestStruct struct {
+		Sum      int `parts:"sum"`
+		Odd      int `parts:"odd"`
+		Pairs    int `parts:"pairs"`
+		Found    int `parts:"found"`
+		Forever  int `parts:"forever"`
+		Iterated int `parts:"iterated"`
+	}
+
+	vm, err := GetVMWithSource(`let sum = 0
+		let i = 0
+
+		for (i < 10) {
+			i = i + 1
+
+			if i == 8 {
+				let scoped = 1
+				break
+			}
+
+			sum = sum + i
+		}
+
+		let odd = 0
+		i = 0
+
+		for (i < 10) {
+			i = i + 1
+
+			if (i % 2) == 0 {
+				continue
+			}
+
+			odd = odd + i
+		}
+
+		let pairs = 0
+		let x = 0
+
+		for (x < 3) {
+			let y = 0
+
+			for (y < 3) {
+				y = y + 1
+
+				if y == 2 {
+					continue
+				}
+
+				pairs = pairs + 1
+			}
+
+			x = x + 1
+		}
+
+		let find(limit) {
+			let n = 0
+
+			for (n < limit) {
+				n = n + 1
+
+				if n == 5 {
+					return n * 10
+				}
+			}
+
+			return 0
+		}
+
+		let found = find(100)
+
+		let forever = 0
+
+		for {
+			forever = forever + 1
+
+			if forever == 25 {
+				break
+			}
+		}
+
+		let numbers*(n) {
+			let j = 0
+
+			for (j < n) {
+				yield j
+				j = j + 1
+			}
+		}
+
+		let iterated = 0
+
+		for numbers(10) {
+			if it == 3 {
+				continue
+			}
+
+			if it == 6 {
+				break
+			}
+
+			iterated = iterated + it
+		}`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	expected := TestStruct{Sum: 28, Odd: 25, Pairs: 6, Found: 50, Forever: 25, Iterated: 12}
+
+	if testStruct != expected {
+		t.Errorf("struct value didn't matched got (%+v) expected (%+v)", testStruct, expected)
+		return
+	}
+
+	if _, err := vm.Enviroment.resolve("RTscoped"); err == nil {
+		t.Error(errors.New("variable declared in the loop leaked out of it"))
+	}
+}
+
+func TestLoopJumpsOptimized(t *testing.T) {
+	source := `let count(limit) {
+			let total = 0
+			let i = 0
+
+			for (i < limit) {
+				i = i + 1
+
+				if (i % 3) == 0 {
+					let skipped = i
+					continue
+				}
+
+				if i > 10 {
+					if true {
+						break
+					}
+				}
+
+				for {
+					total = total + 1
+					break
+				}
+			}
+
+			let after = total * 2
+
+			return after
+		}
+
+		let total = count(20)`
+
+	for _, optimize := range []bool{false, true} {
+		vm, err := GetVMWithOptions(source, "./", CompileOptions{Optimize: optimize})
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err = vm.Run(); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if total, err := vm.Get("total"); err != nil || total != 14 {
+			t.Errorf("expected 14 got %v (%v), optimized: %v", total, err, optimize)
+		}
+	}
+}
+
+func TestLocalSlots(t *testing.T) {
+	type TestStruct struct {
+		Sum      int `parts:"sum"`
+		Shadow   int `parts:"shadow"`
+		Implicit int `parts:"implicit"`
+		Dynamic  int `parts:"dynamic"`
+		Branch   int `parts:"branch"`
+		Gen      int `parts:"gen"`
+	}
+
+	vm, err := GetVMWithSource(`let sumTo(n) {
+			let total = 0
+			let i = 0
+
+			for (i < n) {
+				i = i + 1
+				total = total + i
+			}
+
+			return total
+		}
+
+		let shadowing(x) {
+			let y = x
+
+			if true {
+				let x = 10
+				y = y + x
+			}
+
+			return y + x
+		}
+
+		let implicitValue() {
+			let local = 7
+			local
+		}
+
+		let callee() { return hidden * 2 }
+
+		let caller() {
+			let hidden = 21
+			return callee()
+		}
+
+		let branching(flag) {
+			if flag {
+				let picked = 1
+			}
+
+			let picked = 2
+			return picked
+		}
+
+		let numbers*(limit) {
+			let n = 0
+
+			for (n < limit) {
+				n = n + 1
+				yield n
+			}
+		}
+
+		let gen = 0
+
+		for numbers(4) {
+			gen = gen + it
+		}
+
+		let sum = sumTo(10)
+		let shadow = shadowing(1)
+		let implicit = implicitValue()
+		let dynamic = caller()
+		let branch = branching(true)`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	sum := vm.Literals[slices.IndexFunc(vm.Literals, func(l *Literal) bool {
+		decl, ok := l.Value.(FunctionDeclaration)
+		return ok && len(decl.Params) == 1 && decl.Params[0] == "n"
+	})].Value.(FunctionDeclaration)
+
+	if !slices.Contains(sum.Body, B_DECLARE_LOCAL) || !slices.Contains(sum.Body, B_LOAD_LOCAL) || !slices.Contains(sum.Body, B_STORE_LOCAL) {
+		t.Errorf("expected function body to use local slots got %v", sum.Body)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	expected := TestStruct{Sum: 55, Shadow: 12, Implicit: 7, Dynamic: 42, Branch: 2, Gen: 10}
+
+	if testStruct != expected {
+		t.Errorf("struct value didn't matched got (%+v) expected (%+v)", testStruct, expected)
+	}
+}
+
+func TestLocalRedefinition(t *testing.T) {
+	_, err := RunString(`let f() {
+			let x = 1
+			let x = 2
+		}
+
+		f()`, "./")
+
+	if err == nil || !strings.Contains(err.Error(), "redefining variable in the same scope") {
+		t.Errorf("expected redefinition error got %v", err)
+	}
+}
+
+func TestArrayFunctions(t *testing.T) {
+	type TestStruct struct {
+		Sliced   []int  `parts:"sliced"`
+		Appended []int  `parts:"appended"`
+		Iterated int    `parts:"iterated"`
+		Has      bool   `parts:"has"`
+		Printed  string `parts:"printed"`
+	}
+
+	vm, err := GetVMWithSource(`let numbers = [0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11]
+		let sliced = Array.Slice(numbers, 8, 12)
+		let appended = Array.AppendAll([1, 2], [3, 4])
+		appended = appended + 5
+
+		let iterated = 0
+
+		for Array.Iterator(numbers) {
+			iterated = iterated + it
+		}
+
+		let has = Array.Has(numbers, 11)
+		let printed = String.From(numbers)`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	if !slices.Equal(testStruct.Sliced, []int{8, 9, 10, 11}) {
+		t.Errorf("unexpected slice got %v", testStruct.Sliced)
+	}
+
+	if !slices.Equal(testStruct.Appended, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("unexpected append result got %v", testStruct.Appended)
+	}
+
+	if testStruct.Iterated != 66 || !testStruct.Has {
+		t.Errorf("unexpected iteration result got (%+v)", testStruct)
+	}
+
+	if testStruct.Printed != "[0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11]" {
+		t.Errorf("list printed out of order got %s", testStruct.Printed)
+	}
+
+	if _, err = RunString("Array.Slice([1, 2], 1, 5)", "./"); err == nil {
+		t.Error("expected error slicing past the end")
+	}
+}
+
+func TestObjectOrder(t *testing.T) {
+	type TestStruct struct {
+		Keys      []string `parts:"keys"`
+		Printed   string   `parts:"printed"`
+		Equal     bool     `parts:"equal"`
+		Different bool     `parts:"different"`
+	}
+
+	vm, err := GetVMWithSource(`let obj = |> zeta: 1, alpha: 2, mid: 3, beta: 4, omega: 5 <|
+		obj.zeta = 6
+
+		let keys = Object.Keys(obj)
+		let printed = String.From(obj)
+		let equal = |> a: 1, b: [1, 2] <| == |> b: [1, 2], a: 1 <|
+		let different = |> a: 1, b: 2 <| == |> a: 1, b: 3 <|`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	if !slices.Equal(testStruct.Keys, []string{"zeta", "alpha", "mid", "beta", "omega"}) {
+		t.Errorf("keys out of insertion order got %v", testStruct.Keys)
+	}
+
+	if testStruct.Printed != `|>"RTzeta": 6, "RTalpha": 2, "RTmid": 3, "RTbeta": 4, "RTomega": 5<|` {
+		t.Errorf("object printed out of order got %s", testStruct.Printed)
+	}
+
+	if !testStruct.Equal || testStruct.Different {
+		t.Errorf("unexpected object equality got (%+v)", testStruct)
+	}
+
+	exported := vm.Enviroment.PartsObject()
+
+	if keys := exported.Keys(); !slices.Equal(keys, []string{"RTobj", "RTkeys", "RTprinted", "RTequal", "RTdifferent"}) {
+		t.Errorf("expected globals in the order they were declared got %v", keys)
+	}
+}
+
+func TestObjectEqualityCycle(t *testing.T) {
+	type TestStruct struct {
+		Same      bool `parts:"same"`
+		Cyclic    bool `parts:"cyclic"`
+		Different bool `parts:"different"`
+		Lists     bool `parts:"lists"`
+	}
+
+	vm, err := GetVMWithSource(`let o = |> a: 1 <|
+		o.a = o
+
+		let p = |> a: 1 <|
+		p.a = p
+
+		let q = |> a: |> a: 2 <| <|
+
+		let l = [1]
+		l[0] = l
+
+		let same = o == o
+		let cyclic = o == p
+		let different = o == q
+		let lists = l == l`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	expected := TestStruct{Same: true, Cyclic: true, Different: false, Lists: true}
+
+	if testStruct != expected {
+		t.Errorf("unexpected equality of self referencing values got (%+v) expected (%+v)", testStruct, expected)
+	}
+}
+
+func TestOptimizer(t *testing.T) {
+	type TestStruct struct {
+		Folded  int    `parts:"folded"`
+		Text    string `parts:"text"`
+		Branch  int    `parts:"branch"`
+		Merged  bool   `parts:"merged"`
+		Calls   int    `parts:"calls"`
+		Implied int    `parts:"implied"`
+	}
+
+	source := `let folded = 1 + 2 * 3
+		let text = "a" + "b"
+		let branch = 0
+
+		if true {
+			branch = 1
+		} else {
+			branch = 2
+		}
+
+		if false { branch = 3 }
+
+		let calls = 0
+
+		let count() {
+			calls = calls + 1
+
+			return 1
+		}
+
+		let merged = folded >= branch
+		let other = count() >= 1
+
+		let implicit() {
+			1
+
+			if false { 2 }
+		}
+
+		let implied = implicit() ?? 5`
+
+	parser := GetParserWithSource(source, "./")
+
+	_, literals, err := Compile(&parser, CompileOptions{Optimize: true})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	declared := map[int]bool{}
+
+	for _, literal := range literals {
+		if literal.LiteralType == IntLiteral {
+			declared[literal.Value.(int)] = true
+		}
+	}
+
+	if !declared[7] {
+		t.Errorf("expected folded literal in the pool got %v", literals)
+	}
+
+	vm, err := GetVMWithOptions(source, "./", CompileOptions{Optimize: true})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	expected := TestStruct{Folded: 7, Text: "ab", Branch: 1, Merged: true, Calls: 2, Implied: 5}
+
+	if testStruct != expected {
+		t.Errorf("unexpected optimized result got (%+v) expected (%+v)", testStruct, expected)
+	}
+
+	if _, err = RunStringWithOptions("let x = 1 // 0", "./", CompileOptions{Optimize: true}); err == nil {
+		t.Error("expected folding to leave failing operations for runtime")
+	}
+}
+
+func TestOptimizerKeepsFailingFolds(t *testing.T) {
+	type TestStruct struct {
+		X int `parts:"x"`
+	}
+
+	vm, err := GetVMWithOptions(`let f() = 7 % 0
+		let x = 1`, "./", CompileOptions{Optimize: true})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var testStruct TestStruct
+
+	ReadFromParts(vm, &testStruct)
+
+	if testStruct.X != 1 {
+		t.Errorf("field value didn't matched got (%d) expected (%d)", testStruct.X, 1)
+	}
+
+	if _, err = RunStringWithOptions("let x = 7 % 0", "./", CompileOptions{Optimize: true}); err == nil || !strings.Contains(err.Error(), "dividing by zero") {
+		t.Errorf("expected dividing by zero error got %v", err)
+	}
+
+	literals := []*Literal{{IntLiteral, "1"}, {IntLiteral, 2}}
+	code := []Bytecode{B_BIN_OP, B_OP_ADD, B_LITERAL, 0, B_LITERAL, 1}
+
+	optimized, _ := Optimize(code, literals)
+
+	if !slices.Equal(optimized, code) {
+		t.Errorf("expected operation that panics to be left unfolded got %v", optimized)
+	}
+}
+
+func TestOptimizerMergesComparison(t *testing.T) {
+	parser := GetParserWithSource("a >= b", "./")
+
+	code, err := parser.ParseAll()
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	literals := make([]*Literal, len(parser.Literals))
+
+	for idx, literal := range parser.Literals {
+		literals[idx] = &literal
+	}
+
+	optimized, _ := Optimize(code, literals)
+
+	expected := []Bytecode{B_BIN_OP, B_OP_GT_EQ, B_LITERAL, 2, B_LITERAL, 3}
+
+	if !slices.Equal(optimized, expected) {
+		t.Errorf("expected %v got %v", expected, optimized)
+	}
+
+	optimized, _ = Optimize([]Bytecode{B_NEW_SCOPE, B_NEW_SCOPE, B_END_SCOPE, B_END_SCOPE, B_LITERAL, 1}, literals)
+
+	if !slices.Equal(optimized, []Bytecode{B_LITERAL, 1}) {
+		t.Errorf("expected empty scopes to be removed got %v", optimized)
+	}
+
+	branch := []Bytecode{B_COND_JUMP, B_LITERAL, 1, 4, B_NEW_SCOPE, B_LITERAL, 2, B_END_SCOPE, B_JUMP, 4, B_NEW_SCOPE, B_LITERAL, 3, B_END_SCOPE}
+
+	optimized, _ = Optimize(joinCode(branch, []Bytecode{B_LITERAL, 0}), literals)
+
+	if !slices.Equal(optimized, []Bytecode{B_NEW_SCOPE, B_LITERAL, 2, B_END_SCOPE, B_LITERAL, 0}) {
+		t.Errorf("expected else branch to be removed got %v", optimized)
+	}
+
+	optimized, _ = Optimize(branch, literals)
+
+	if !slices.Equal(optimized, branch) {
+		t.Errorf("expected value of the last statement to be kept got %v", optimized)
+	}
+}
+
+func TestDeduplicatedLiteralsAreIndependent(t *testing.T) {
+	type TestStruct struct {
+		First  []int `parts:"first"`
+		Second []int `parts:"second"`
+	}
+
+	var testStruct TestStruct
+
+	err := RunAndRead(`let first = [1, 2]
+		let second = [1, 2]
+		first[0] = 5`, &testStruct)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !slices.Equal(testStruct.First, []int{5, 2}) || !slices.Equal(testStruct.Second, []int{1, 2}) {
+		t.Errorf("lists from the same literal share values got (%+v)", testStruct)
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	profiler := NewProfiler()
+
+	vm, err := GetVMWithOptions(`let fib(n) {
+			if n < 2 { return n }
+
+			return fib(n - 1) + fib(n - 2)
+		}
+
+		let total = fib(10)
+		let sliced = Array.Slice([1, 2, 3], 0, 2)`, "./", CompileOptions{Profiler: profiler})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	calls := map[string]int{}
+
+	for _, entry := range profiler.Entries() {
+		calls[fmt.Sprintf("%s (%s)", entry.Name, entry.Kind)] = entry.Calls
+
+		if entry.Self > entry.Total {
+			t.Errorf("self time longer than total for %s", entry.Name)
+		}
+	}
+
+	expected := map[string]int{"fib (function)": 177, "Array.Slice (native)": 1, "LetStmt (parser rule)": 3}
+
+	for name, count := range expected {
+		if calls[name] != count {
+			t.Errorf("expected %d calls of %s got %d", count, name, calls[name])
+		}
+	}
+
+	if calls["Keyword (scanner rule)"] == 0 {
+		t.Errorf("expected scanner rules to be profiled got %v", calls)
+	}
+
+	var report, out bytes.Buffer
+
+	if err = profiler.Report(&report); err != nil || !strings.Contains(report.String(), "fib (function)") {
+		t.Errorf("unexpected report (%v)\n%s", err, report.String())
+	}
+
+	if err = profiler.WriteProfile(&out); err != nil || !bytes.HasPrefix(out.Bytes(), []byte{0x1f, 0x8b}) {
+		t.Errorf("expected gzipped profile (%v)", err)
+	}
+}
+
+func TestProfilerSyntaxRules(t *testing.T) {
+	profiler := NewProfiler()
+
+	_, err := RunStringWithOptions("answer", "./", CompileOptions{Profiler: profiler, Syntax: `ClearParser()
+
+		AddParserRule(false, |>
+			Id: "Answer",
+			AdvanceToken: true,
+			Rule: fun(p) { return ParserCheck(p, TokenIdentifier, "answer") },
+			Parse: fun(p) { return [2, 1] }
+		<|)`})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, entry := range profiler.Entries() {
+		if entry.Name == "Answer" && entry.Kind == ProfileParserRule && entry.Calls == 1 {
+			return
+		}
+	}
+
+	t.Errorf("rule from the syntax part wasn't profiled got %v", profiler.Entries())
+}
+
+func TestDebugger(t *testing.T) {
+	source := `let add(a, b) {
+	let sum = a + b
+	sum
+}
+let x = 1
+let y = add(x, 2)
+let z = y * 2`
+
+	stops := []string{}
+	actions := []DebugAction{DebugStepOver, DebugStepOver, DebugStepInto, DebugStepOut, DebugContinue}
+
+	var inAdd []DebugScope
+
+	debugger := NewDebugger(func(stop DebugStop) DebugAction {
+		frame := stop.Frames[len(stop.Frames)-1]
+		stops = append(stops, fmt.Sprintf("%s %s:%d", stop.Reason, frame.Function, frame.Line))
+
+		if frame.Function == "add" {
+			inAdd = frame.Scopes()
+		}
+
+		action := actions[0]
+		actions = actions[1:]
+
+		return action
+	}, true)
+
+	debugger.SetBreakpoints("main.pts", []int{7})
+
+	vm, err := RunStringWithOptions(source, "main.pts", CompileOptions{Debugger: debugger})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []string{"entry main:1", "step main:5", "step main:6", "step add:2", "breakpoint main:7"}
+
+	if !slices.Equal(stops, expected) {
+		t.Errorf("expected stops %v got %v", expected, stops)
+		return
+	}
+
+	scopes := inAdd
+
+	if len(scopes) < 2 || scopes[1].Variables["a"].Value != 1 || scopes[1].Variables["b"].Value != 2 {
+		t.Errorf("expected arguments of add in the scopes got %v", scopes)
+	}
+
+	if !scopes[len(scopes)-1].Global || !vm.Enviroment.Has("RTz") {
+		t.Errorf("expected standard library in the last scope and finished program")
+	}
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	source := `let twice(n) {
+	n * 2
+}
+let a = twice(1)
+let b = twice(a)`
+
+	stops := []string{}
+
+	debugger := NewDebugger(func(stop DebugStop) DebugAction {
+		frame := stop.Frames[len(stop.Frames)-1]
+		stops = append(stops, fmt.Sprintf("%s %s:%d %s", stop.Reason, frame.Function, frame.Line, DebugValue(stop.LastExpr)))
+
+		return DebugContinue
+	}, false)
+
+	debugger.SetBreakpoints("./main.pts", []int{5})
+	debugger.SetFunctionBreakpoints([]string{"twice"})
+
+	if _, err := RunStringWithOptions(source, "main.pts", CompileOptions{Debugger: debugger}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []string{"function breakpoint twice:2 nil", "breakpoint main:5 2", "function breakpoint twice:2 nil"}
+
+	if !slices.Equal(stops, expected) {
+		t.Errorf("expected stops %v got %v", expected, stops)
+	}
+
+	debugger = NewDebugger(func(stop DebugStop) DebugAction { return DebugTerminate }, true)
+
+	if _, err := RunStringWithOptions(source, "main.pts", CompileOptions{Debugger: debugger}); !errors.Is(err, ErrDebugTerminated) {
+		t.Errorf("expected program to be terminated got %v", err)
+	}
+}
+
+func TestDebuggerExpressionFunction(t *testing.T) {
+	source := `let add(a, b) = a + b
+let noop() {}
+let x = add(1, 2)
+noop()
+let y = x`
+
+	stops := []string{}
+
+	var inAdd []DebugScope
+
+	debugger := NewDebugger(func(stop DebugStop) DebugAction {
+		frame := stop.Frames[len(stop.Frames)-1]
+		stops = append(stops, fmt.Sprintf("%s %s:%d", stop.Reason, frame.Function, frame.Line))
+
+		if frame.Function == "add" {
+			inAdd = frame.Scopes()
+		}
+
+		return DebugContinue
+	}, false)
+
+	debugger.SetFunctionBreakpoints([]string{"add", "noop"})
+
+	if _, err := RunStringWithOptions(source, "main.pts", CompileOptions{Debugger: debugger}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []string{"function breakpoint add:1"}
+
+	if !slices.Equal(stops, expected) {
+		t.Errorf("expected stops %v got %v", expected, stops)
+		return
+	}
+
+	if len(inAdd) == 0 || inAdd[0].Variables["a"] == nil || inAdd[0].Variables["a"].Value != 1 || inAdd[0].Variables["b"].Value != 2 {
+		t.Errorf("expected arguments of add in the scopes got %v", inAdd)
+	}
+}
+
+func TestDebuggerSyntaxRules(t *testing.T) {
+	stops := []string{}
+
+	debugger := NewDebugger(func(stop DebugStop) DebugAction {
+		frame := stop.Frames[len(stop.Frames)-1]
+		stops = append(stops, fmt.Sprintf("%s %s:%d", stop.Reason, frame.Source, frame.Line))
+
+		return DebugStepOver
+	}, false)
+
+	debugger.SetBreakpoints("syntax.pts", []int{8})
+
+	_, err := RunStringWithOptions("answer", "main.pts", CompileOptions{Debugger: debugger, SyntaxPath: "syntax.pts", Syntax: `ClearParser()
+
+AddParserRule(false, |>
+	Id: "Answer",
+	AdvanceToken: true,
+	Rule: fun(p) { return ParserCheck(p, TokenIdentifier, "answer") },
+	Parse: fun(p) {
+		let code = [2, 1]
+		return code
+	}
+<|)`})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []string{"breakpoint syntax.pts:8", "step syntax.pts:9", "step main.pts:1"}
+
+	if !slices.Equal(stops, expected) {
+		t.Errorf("expected stops %v got %v", expected, stops)
+	}
+}
+
+func TestDAPServer(t *testing.T) {
+	program := t.TempDir() + "/main.pts"
+
+	if err := os.WriteFile(program, []byte("let a = 1\nlet b = a + 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+
+	server := NewDAPServer(serverIn, serverOut)
+	client := NewDAPServer(clientIn, io.Discard)
+
+	go server.Serve()
+
+	//Pipes block, messages are read all the time so the server never waits on the test
+	messages := make(chan dapMessage, 64)
+
+	go func() {
+		for {
+			message, err := client.read()
+
+			if err != nil {
+				close(messages)
+				return
+			}
+
+			messages <- message
+		}
+	}()
+
+	seq := 0
+
+	request := func(command string, arguments any) {
+		seq++
+		data, _ := json.Marshal(map[string]any{"seq": seq, "type": "request", "command": command, "arguments": arguments})
+		fmt.Fprintf(clientOut, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+
+	//Skips everything until the message, returns it's body
+	wait := func(kind, name string) map[string]any {
+		for message := range messages {
+			if message.Type == "response" && message.Success != nil && !*message.Success {
+				t.Fatalf("request %s failed: %s", message.Command, message.Message)
+			}
+
+			if message.Type == kind && (message.Command == name || message.Event == name) {
+				body, _ := message.Body.(map[string]any)
+				return body
+			}
+		}
+
+		t.Fatalf("server stopped before %s %s", kind, name)
+
+		return nil
+	}
+
+	request("initialize", map[string]any{"adapterID": "parts"})
+	wait("event", "initialized")
+
+	request("launch", map[string]any{"program": program})
+	request("setBreakpoints", map[string]any{"source": map[string]any{"path": program}, "breakpoints": []map[string]any{{"line": 2}}})
+	request("configurationDone", nil)
+
+	if reason := wait("event", "stopped")["reason"]; reason != "breakpoint" {
+		t.Errorf("expected breakpoint stop got %v", reason)
+	}
+
+	request("stackTrace", map[string]any{"threadId": 1})
+	frames := wait("response", "stackTrace")["stackFrames"].([]any)
+
+	if line := frames[0].(map[string]any)["line"]; line != float64(2) {
+		t.Errorf("expected stop on line 2 got %v", line)
+	}
+
+	request("scopes", map[string]any{"frameId": frames[0].(map[string]any)["id"]})
+	scopes := wait("response", "scopes")["scopes"].([]any)
+
+	request("variables", map[string]any{"variablesReference": scopes[0].(map[string]any)["variablesReference"]})
+	variables := wait("response", "variables")["variables"].([]any)
+
+	if len(variables) != 1 || variables[0].(map[string]any)["name"] != "a" || variables[0].(map[string]any)["value"] != "1" {
+		t.Errorf("expected a = 1 got %v", variables)
+	}
+
+	request("continue", map[string]any{"threadId": 1})
+	wait("event", "terminated")
+
+	request("disconnect", nil)
+	wait("response", "disconnect")
+}
+
+type recordingHooks struct {
+	BaseHooks
+
+	events       []string
+	instructions int
+}
+
+func (h *recordingHooks) OnInstruction(op Bytecode, idx int) { h.instructions++ }
+
+func (h *recordingHooks) OnCall(fn PartsCallable, args []*Literal) {
+	h.events = append(h.events, fmt.Sprintf("call %d", len(args)))
+}
+
+func (h *recordingHooks) OnReturn(value *Literal) {
+	h.events = append(h.events, "return "+DebugValue(value))
+}
+
+func (h *recordingHooks) OnRaise(value *Literal) { h.events = append(h.events, "raise") }
+
+func TestHooks(t *testing.T) {
+	hooks := &recordingHooks{}
+
+	_, err := RunStringWithOptions(`let add(a, b) { a + b }
+let fail() { raise "bad" }
+let sum = add(1, 2)
+let res = fail()`, "./", CompileOptions{Hooks: hooks})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []string{"call 2", "return 3", "call 0", "raise", `return |>"RTValue": bad<|`}
+
+	if !slices.Equal(hooks.events, expected) {
+		t.Errorf("expected %v got %v", expected, hooks.events)
+	}
+
+	if hooks.instructions == 0 {
+		t.Errorf("expected instructions to be reported")
+	}
+}
+
+func TestTracer(t *testing.T) {
+	var out bytes.Buffer
+
+	tracer := NewTracer(&out)
+	tracer.SkipInstructions = true
+
+	_, err := RunStringWithOptions(`let add(a, b) { a + b }
+let sum = add(1, 2)`, "./", CompileOptions{Hooks: tracer})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := "call func(a,b) with (1, 2)\n  scope {\n  }\nreturn 3\n"
+
+	if out.String() != expected {
+		t.Errorf("expected trace %q got %q", expected, out.String())
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	coverage := NewCoverage()
+
+	_, err := RunStringWithOptions(`let sign(n) {
+	if n > 0 {
+		1
+	} else {
+		0
+	}
+}
+let a = sign(5)
+let i = 0
+for i < 3 {
+	i = i + 1
+}`, "main.pts", CompileOptions{Coverage: coverage})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	summary := coverage.Summary()
+
+	if summary != (CoverageSummary{Lines: 8, LinesHit: 7, Branches: 4, BranchesHit: 3}) {
+		t.Errorf("unexpected summary %v", summary)
+	}
+
+	var profile bytes.Buffer
+
+	if err = coverage.WriteProfile(&profile); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !strings.HasPrefix(profile.String(), "mode: count\nmain.pts:1.1,1.14 1 1\n") || !strings.Contains(profile.String(), "main.pts:5.1,5.4 1 0\n") || !strings.Contains(profile.String(), "main.pts:11.1,11.11 1 3\n") {
+		t.Errorf("unexpected profile %s", profile.String())
+	}
+
+	var page bytes.Buffer
+
+	if err = coverage.WriteHTML(&page); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !strings.Contains(page.String(), `<span class="miss">		0</span>`) || !strings.Contains(page.String(), `<span class="num">10</span><span class="count">1x T3 F1</span>`) {
+		t.Errorf("unexpected HTML %s", page.String())
+	}
+}
+
+func TestCoverageSyntaxPart(t *testing.T) {
+	coverage := NewCoverage()
+
+	_, err := RunStringWithOptions("answer", "main.pts", CompileOptions{Coverage: coverage, SyntaxPath: "syntax.pts", Syntax: `ClearParser()
+
+AddParserRule(false, |>
+	Id: "Answer",
+	AdvanceToken: true,
+	Rule: fun(p) { return ParserCheck(p, TokenIdentifier, "answer") },
+	Parse: fun(p) {
+		if ParserCheck(p, TokenIdentifier, "question") {
+			return [2, 0]
+		}
+		return [2, 1]
+	}
+<|)`})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if files := coverage.Files(); !slices.Equal(files, []string{"main.pts", "syntax.pts"}) {
+		t.Errorf("expected both files got %v", files)
+	}
+
+	lines := map[int]CoverageLine{}
+
+	for _, line := range coverage.Lines("syntax.pts") {
+		lines[line.Line] = line
+	}
+
+	if lines[8].True != 0 || lines[8].False != 1 || lines[9].Hits != 0 || lines[11].Hits != 1 {
+		t.Errorf("unexpected syntax part coverage %v", lines)
+	}
+}
+
+func TestFFIStruct(t *testing.T) {
+	type Stats struct{ HP int }
+
+	type Entity struct {
+		Name    string `parts:"name"`
+		Stats   Stats
+		Hidden  bool `parts:"-"`
+		Speed   float32
+		private int
+	}
+
+	entity := &Entity{Name: "orc", Stats: Stats{HP: 3}, Speed: 1}
+
+	vm, err := GetVMWithSource(`let before = entity.name
+entity.name = "goblin"
+entity.Speed = 2
+let stats = entity.Stats
+let hp = stats.HP
+stats.HP = hp + 4
+let shown = Object.Keys(entity)
+let copy = value
+copy.HP = 100`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	entityLit, _ := LiteralFromGo(entity)
+	valueLit, _ := LiteralFromGo(Stats{HP: 1})
+
+	vm.Enviroment.Values["RTentity"] = entityLit
+	vm.Enviroment.Values["RTvalue"] = valueLit
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if entity.Name != "goblin" || entity.Speed != 2 || entity.Stats.HP != 7 {
+		t.Errorf("expected changes in the Go value got %+v", entity)
+	}
+
+	if before := vm.Enviroment.Values["RTbefore"]; before.Value != "orc" {
+		t.Errorf("expected field read through tag got %v", before.Value)
+	}
+
+	if shown := vm.Enviroment.Values["RTshown"].pretify(); shown != "[name, Stats, Speed]" {
+		t.Errorf("expected only exported fields got %s", shown)
+	}
+
+	if back, _ := entityLit.ToGoTypes(vm); back != any(entity) {
+		t.Errorf("expected the same pointer back got %v", back)
+	}
+
+	if copied := vm.Enviroment.Values["RTvalue"].Value.(*FFIStruct).Interface().(Stats); copied.HP != 100 {
+		t.Errorf("expected struct passed by value to be editable as a copy got %v", copied)
+	}
+}
+
+func TestFFIStructAssign(t *testing.T) {
+	type Stats struct{ HP int }
+
+	type Entity struct {
+		Tags   []string
+		Scores map[string]int
+		Stats  Stats
+		Name   string
+	}
+
+	entity := &Entity{}
+
+	vm, err := GetVMWithSource(`ent.Tags = ["x", "y"]
+ent.Scores = |> a: 1, b: 2 <|
+ent.Stats = |> HP: 5 <|`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	entityLit, _ := LiteralFromGo(entity)
+	vm.Enviroment.Values["RTent"] = entityLit
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !slices.Equal(entity.Tags, []string{"x", "y"}) || entity.Scores["b"] != 2 || entity.Stats.HP != 5 {
+		t.Errorf("expected list, object and struct fields to be set got %+v", entity)
+	}
+
+	vm, err = GetVMWithSource(`ent.Name = 1`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	vm.Enviroment.Values["RTent"] = entityLit
+
+	if err = vm.Run(); err == nil || !strings.Contains(err.Error(), "can't set field Name") {
+		t.Errorf("expected error for mismatched field type got %v", err)
+	}
+}
+
+type testNode struct {
+	Name string
+	Next *testNode
+}
+
+func TestFFIStructCycle(t *testing.T) {
+	node := &testNode{Name: "a"}
+	node.Next = node
+
+	vm, err := GetVMWithSource(`let shown = String.From(node)
+let next = node.Next
+let name = next.Name`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	nodeLit, _ := LiteralFromGo(node)
+	vm.Enviroment.Values["RTnode"] = nodeLit
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if shown := vm.Enviroment.Values["RTshown"].Value; shown != `|>"RTName": a, "RTNext": <cycle><|` {
+		t.Errorf("expected cycle to be cut got %v", shown)
+	}
+
+	if name := vm.Enviroment.Values["RTname"].Value; name != "a" {
+		t.Errorf("expected field through the cycle got %v", name)
+	}
+}
+
+type testCounter struct{ Count int }
+
+func (c *testCounter) Add(n int) int {
+	c.Count += n
+
+	return c.Count
+}
+
+func (c *testCounter) Div(n int) (int, error) {
+	if n == 0 {
+		return 0, errors.New("division by zero")
+	}
+
+	return c.Count / n, nil
+}
+
+func (c *testCounter) Reset() error {
+	c.Count = 0
+
+	return nil
+}
+
+type testTemperature float64
+
+func (t *testTemperature) Fahrenheit() float64 {
+	return float64(*t)*9/5 + 32
+}
+
+func TestFFIMethods(t *testing.T) {
+	counter := &testCounter{Count: 4}
+	temp := testTemperature(100)
+
+	vm, err := GetVMWithSource(`let added = counter.Add(2)
+let half = counter.Div(2)
+let failed = counter.Div(0)
+let count = counter.Count
+let reset = counter.Reset()
+let hot = temp.Fahrenheit()`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	counterLit, _ := LiteralFromGo(counter)
+	tempLit, _ := LiteralFromGo(&temp)
+
+	vm.Enviroment.Values["RTcounter"] = counterLit
+	vm.Enviroment.Values["RTtemp"] = tempLit
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	values := vm.Enviroment.Values
+
+	if added := values["RTadded"]; added.Value != 6 {
+		t.Errorf("expected plain value from method without error got %s", added.pretify())
+	}
+
+	if half := values["RThalf"]; !IsResultOK(half) || half.Value.(PartsIndexable).GetByKey("RTValue").Value != 3 {
+		t.Errorf("expected Result.Ok(3) got %s", half.pretify())
+	}
+
+	if failed := values["RTfailed"]; !IsResultError(failed) || failed.Value.(PartsIndexable).GetByKey("RTValue").Value != "division by zero" {
+		t.Errorf("expected Result.Error got %s", failed.pretify())
+	}
+
+	if count := values["RTcount"]; count.Value != 6 {
+		t.Errorf("expected field next to methods got %s", count.pretify())
+	}
+
+	if reset := values["RTreset"]; !IsResultOK(reset) || counter.Count != 0 {
+		t.Errorf("expected Result.Ok and reset counter got %s (%d)", reset.pretify(), counter.Count)
+	}
+
+	if hot := values["RThot"]; hot.Value != 212.0 {
+		t.Errorf("expected method on pointer value got %s", hot.pretify())
+	}
+
+	if shown := counterLit.Value.(*FFIStruct).Keys(); !slices.Equal(shown, []string{"RTCount"}) {
+		t.Errorf("expected methods not to be listed got %v", shown)
+	}
+}
+
+func TestCallFromGo(t *testing.T) {
+	vm, err := RunString(`let greeting = "hi"
+let onSpawn(entity) {
+	let name = entity.name
+	let hp = entity.HP
+	entity.name = "spawned " + name
+	return hp * 2
+}
+let half(x: Int): Int { return x / 2 }
+let check(x) {
+	if x < 0 { raise "negative" }
+	return x
+}
+let handlers = |> onDeath: fun(name) { return name + " died" } <|
+let stats() { return |> hp: 3, tags: ["boss"] <| }`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if greeting, err := vm.Get("greeting"); err != nil || greeting != "hi" {
+		t.Errorf("expected 'hi' got %v (%v)", greeting, err)
+	}
+
+	if _, err := vm.Get("handlers.missing"); err == nil {
+		t.Error("expected error for missing key")
+	}
+
+	entity := &struct {
+		Name string `parts:"name"`
+		HP   int
+	}{Name: "orc", HP: 5}
+
+	if hp, err := CallAs[int64](vm, "onSpawn", entity); err != nil || hp != 10 || entity.Name != "spawned orc" {
+		t.Errorf("expected 10 and renamed entity got %v %+v (%v)", hp, entity, err)
+	}
+
+	if res, err := vm.Call("handlers.onDeath", "orc"); err != nil || res != "orc died" {
+		t.Errorf("expected 'orc died' got %v (%v)", res, err)
+	}
+
+	if _, err := vm.Call("half", "two"); err == nil {
+		t.Error("expected error for argument of wrong type")
+	}
+
+	if _, err := vm.Call("greeting"); err == nil {
+		t.Error("expected error calling a string")
+	}
+
+	var raised *RaisedError
+
+	if _, err := vm.Call("check", -1); !errors.As(err, &raised) || raised.Value.Value != "negative" {
+		t.Errorf("expected raised error got %v", err)
+	}
+
+	if res, err := CallAs[string](vm, "check", 3); err == nil {
+		t.Errorf("expected conversion error got %q", res)
+	}
+
+	type Stats struct {
+		HP   int      `parts:"hp"`
+		Tags []string `parts:"tags"`
+	}
+
+	if stats, err := CallAs[Stats](vm, "stats"); err != nil || stats.HP != 3 || stats.Tags[0] != "boss" {
+		t.Errorf("expected stats decoded into struct got %+v (%v)", stats, err)
+	}
+}
+
+func TestHelperSliceOfStructs(t *testing.T) {
+	type TestStruct struct {
+		Drops []struct {
+			Item string `parts:"item"`
+		} `parts:"drops"`
+	}
+
+	var testStruct TestStruct
+
+	if err := RunAndRead(`let drops = [|> item: "sword" <|, |> item: "shield" <|]`, &testStruct); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(testStruct.Drops) != 2 || testStruct.Drops[1].Item != "shield" {
+		t.Errorf("expected two drops got %+v", testStruct.Drops)
+	}
+}
+
+type testLevel int
+
+func (l *testLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "easy":
+		*l = 1
+	case "hard":
+		*l = 2
+	default:
+		return fmt.Errorf("unknown level %s", text)
+	}
+
+	return nil
+}
+
+func (l testLevel) MarshalText() ([]byte, error) {
+	switch l {
+	case 1:
+		return []byte("easy"), nil
+	case 2:
+		return []byte("hard"), nil
+	}
+
+	return nil, fmt.Errorf("unknown level %d", l)
+}
+
+type testVersion struct{ Major, Minor int }
+
+func (v *testVersion) UnmarshalParts(value *Literal) error {
+	if value.LiteralType != ParsedListLiteral || value.Value.(*PartsList).Length() != 2 {
+		return errors.New("version should be [major, minor]")
+	}
+
+	v.Major = value.Value.(*PartsList).Values[0].Value.(int)
+	v.Minor = value.Value.(*PartsList).Values[1].Value.(int)
+
+	return nil
+}
+
+func TestUnmarshal(t *testing.T) {
+	type Item struct {
+		Name  string `parts:"name"`
+		Count *int   `parts:"count"`
+	}
+
+	type Config struct {
+		Title    string            `parts:"title,required"`
+		Port     uint16            `parts:"port,default=8080"`
+		Host     string            `parts:"host,default=localhost"`
+		Timeout  time.Duration     `parts:"timeout"`
+		Level    testLevel         `parts:"level"`
+		Version  *testVersion      `parts:"version"`
+		Items    []*Item           `parts:"items"`
+		Grid     [][]int           `parts:"grid"`
+		Groups   map[string][]Item `parts:"groups"`
+		Extra    any               `parts:"extra"`
+		Owner    *string           `parts:"owner,omitempty,default=admin"`
+		Callback func(args ...any) (any, error)
+		Ignored  int `parts:"-"`
+	}
+
+	config := Config{Ignored: 7}
+
+	err := Unmarshal(`let title = "server"
+let timeout = "1m30s"
+let level = "hard"
+let version = [1, 2]
+let items = [|> name: "a", count: 2 <|, |> name: "b" <|]
+let grid = [[1, 2], [3]]
+let groups = |> first: [|> name: "c" <|] <|
+let extra = |> list: [1, "two"], flag: true <|
+let owner = nil
+let Callback = fun(x) { return x + 1 }`, &config)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if config.Title != "server" || config.Port != 8080 || config.Host != "localhost" || config.Timeout != 90*time.Second || config.Level != 2 || config.Ignored != 7 {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	if config.Version == nil || *config.Version != (testVersion{1, 2}) {
+		t.Errorf("expected version 1.2 got %+v", config.Version)
+	}
+
+	if len(config.Items) != 2 || *config.Items[0].Count != 2 || config.Items[1].Count != nil || config.Items[1].Name != "b" {
+		t.Errorf("unexpected items %+v", config.Items)
+	}
+
+	if len(config.Grid) != 2 || config.Grid[1][0] != 3 || config.Groups["first"][0].Name != "c" {
+		t.Errorf("unexpected grid %v or groups %v", config.Grid, config.Groups)
+	}
+
+	if extra, ok := config.Extra.(map[string]any); !ok || extra["flag"] != true || extra["list"].([]any)[1] != "two" {
+		t.Errorf("unexpected extra %#v", config.Extra)
+	}
+
+	if config.Owner == nil || *config.Owner != "admin" {
+		t.Errorf("expected default owner got %v", config.Owner)
+	}
+
+	if res, err := config.Callback(1); err != nil || res != 2 {
+		t.Errorf("expected callback result 2 got %v (%v)", res, err)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	type Item struct {
+		Name string `parts:"name"`
+	}
+
+	type Config struct {
+		Title string `parts:"title,required"`
+		Level uint8  `parts:"level"`
+		Items []Item `parts:"items"`
+	}
+
+	tests := map[string]string{
+		`let level = 1`:                    "title: required value is missing",
+		`let title = "x"; let level = 300`: "level: 300 overflows uint8",
+		`let title = "x"; let items = [|> name: "a" <|, |> name: 2 <|]`: "items[1].name: expected String got Int",
+		`let title = "x"; let items = |> name: "a" <|`:                  "items: expected Array got Object",
+	}
+
+	for code, expected := range tests {
+		var config Config
+		var unmarshalErr *UnmarshalError
+
+		err := Unmarshal(code, &config)
+
+		if !errors.As(err, &unmarshalErr) || err.Error() != expected {
+			t.Errorf("expected error '%s' got %v", expected, err)
+		}
+	}
+
+	if err := Unmarshal(`let x = 1`, Config{}); err == nil {
+		t.Error("expected error for value that isn't a pointer")
+	}
+}
+
+func TestUnmarshalCycle(t *testing.T) {
+	type Node struct {
+		A *Node `parts:"a"`
+	}
+
+	source := `let o = |> a: 1 <|
+		o.a = o`
+
+	var plain struct {
+		O any `parts:"o"`
+	}
+
+	var unmarshalErr *UnmarshalError
+
+	if err := Unmarshal(source, &plain); !errors.As(err, &unmarshalErr) || unmarshalErr.Path != "o[a]" || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected cycle error at o[a] got %v", err)
+	}
+
+	var typed struct {
+		O Node `parts:"o"`
+	}
+
+	if err := Unmarshal(source, &typed); !errors.As(err, &unmarshalErr) || unmarshalErr.Path != "o.a" || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected cycle error at o.a got %v", err)
+	}
+
+	var shared struct {
+		Pair any `parts:"pair"`
+	}
+
+	if err := Unmarshal(`let s = |> a: 1 <|
+		let pair = [s, s]`, &shared); err != nil {
+		t.Errorf("unexpected error for value used twice %v", err)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	type Loot struct {
+		Exp  int `parts:"exp"`
+		Gold int `parts:"gold"`
+	}
+
+	type Data struct {
+		Name  string         `parts:"name"`
+		Loot  Loot           `parts:"loot"`
+		Tags  []string       `parts:"tags"`
+		Notes string         `parts:"notes,omitempty"`
+		Keys  map[string]int `parts:"keys"`
+	}
+
+	data := Data{Name: "orc", Loot: Loot{Exp: 100, Gold: -5}, Tags: []string{"a", `say "hi"`}, Keys: map[string]int{"max hp": 1, "b": 2}}
+
+	out, err := Marshal(data)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := "let name = \"orc\"\n" +
+		"let loot = |>\n\texp: 100,\n\tgold: 0 - 5\n<|\n" +
+		"let tags = [\n\t\"a\",\n\t`say \"hi\"`\n]\n" +
+		"let keys = |>\n\tb: 2,\n\t\"max hp\": 1\n<|\n"
+
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	out, err = MarshalWithOptions(map[string]any{"loot": data.Loot, "list": []int{1, 2}}, MarshalOptions{})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if expected := "let list = [1, 2]\nlet loot = |> exp: 100, gold: 0 - 5 <|\n"; string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	if _, err := Marshal(struct{ Speed float64 }{1.5}); err == nil {
+		t.Error("expected error for fraction")
+	}
+}
+
+func TestMarshalCycle(t *testing.T) {
+	type Node struct {
+		Name string `parts:"name"`
+		Next *Node  `parts:"next"`
+	}
+
+	node := &Node{Name: "a"}
+	node.Next = node
+
+	_, err := Marshal(node)
+
+	var marshalErr *MarshalError
+
+	if !errors.As(err, &marshalErr) || marshalErr.Path != "next.next" || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected cycle error at next.next got %v", err)
+	}
+
+	list := map[string]any{}
+	list["self"] = []any{list}
+
+	if _, err = Marshal(list); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected cycle error got %v", err)
+	}
+
+	shared := &Node{Name: "b"}
+
+	out, err := MarshalWithOptions(struct {
+		First  *Node `parts:"first"`
+		Second *Node `parts:"second"`
+	}{shared, shared}, MarshalOptions{})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := "let first = |> name: \"b\", next: nil <|\nlet second = |> name: \"b\", next: nil <|\n"
+
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	type Item struct {
+		Name  string `parts:"name"`
+		Count *int   `parts:"count,omitempty"`
+		Path  string `parts:"path"`
+		Level testLevel
+	}
+
+	type Save struct {
+		Player   string            `parts:"player"`
+		Health   uint8             `parts:"health"`
+		Speed    float32           `parts:"speed"`
+		Alive    bool              `parts:"alive"`
+		Cooldown time.Duration     `parts:"cooldown"`
+		Items    []Item            `parts:"items"`
+		Grid     [][]int           `parts:"grid"`
+		Scores   map[int]string    `parts:"scores"`
+		Stats    map[string]any    `parts:"stats"`
+		Flags    map[string]bool   `parts:"flags"`
+		Optional *Item             `parts:"optional"`
+		Nested   map[string][]Item `parts:"nested"`
+	}
+
+	count := 3
+
+	save := Save{
+		Player:   "hero",
+		Health:   200,
+		Speed:    3,
+		Alive:    true,
+		Cooldown: 1500 * time.Millisecond,
+		Items:    []Item{{Name: "sword", Count: &count, Path: "C:\\items\n", Level: 1}, {Name: "key", Level: 2}},
+		Grid:     [][]int{{1, -2}, {}},
+		Scores:   map[int]string{1: "first", 10: "tenth"},
+		Stats:    map[string]any{"str": 5, "tags": []any{"x", true}},
+		Flags:    map[string]bool{"if": true},
+		Nested:   map[string][]Item{"chest": {{Name: "gold", Level: 1}}},
+	}
+
+	out, err := Marshal(&save)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var loaded Save
+
+	if err := Unmarshal(string(out), &loaded); err != nil {
+		t.Errorf("%v\n%s", err, out)
+		return
+	}
+
+	if !reflect.DeepEqual(save, loaded) {
+		t.Errorf("round trip changed the value\nexpected %+v\ngot %+v\nsource:\n%s", save, loaded, out)
+	}
+}
+
+func TestModules(t *testing.T) {
+	inits := 0
+
+	global := &Module{
+		Name:      "dice",
+		Functions: map[string]any{"Roll": func(sides int) int { return sides }},
+		Constants: map[string]any{"Sides": 6},
+		Init: func() error {
+			inits++
+			return nil
+		},
+	}
+
+	if err := RegisterModule(global); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := RegisterModule(&Module{Name: "dice"}); err == nil {
+		t.Error("expected error registering module twice")
+	}
+
+	if inits != 0 {
+		t.Errorf("expected lazy init got %d calls", inits)
+	}
+
+	vm, err := GetVMWithSource(`import module "dice"
+import module "Array" as Arr
+import module "world"
+let roll() {
+	import module "dice" as d
+	return d.Roll(d.Sides)
+}
+let rolled = roll()
+let length = Arr.Length([1, 2])
+let spawned = world.Spawn("orc")`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	vm.RegisterModule(&Module{
+		Name:      "world",
+		Functions: map[string]any{"Spawn": func(name string) string { return name + " spawned" }},
+	})
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	values := vm.Enviroment.Values
+
+	if values["RTrolled"].Value != 6 || values["RTlength"].Value != 2 || values["RTspawned"].Value != "orc spawned" {
+		t.Errorf("unexpected values rolled=%s length=%s spawned=%s", values["RTrolled"].pretify(), values["RTlength"].pretify(), values["RTspawned"].pretify())
+	}
+
+	if inits != 1 {
+		t.Errorf("expected single init got %d", inits)
+	}
+
+	if _, err := RunString(`import module "world"`, "./"); err == nil || !strings.Contains(err.Error(), "unknown module 'world'") {
+		t.Errorf("expected VM module to be hidden from other VMs got %v", err)
+	}
+
+	RegisterModule(&Module{Name: "broken", Init: func() error { return errors.New("no database") }})
+
+	if _, err := RunString(`import module "broken"`, "./"); err == nil || !strings.Contains(err.Error(), "no database") {
+		t.Errorf("expected init error got %v", err)
+	}
+
+	if _, err := RunString(`import module "game/items"`, "./"); err == nil {
+		t.Error("expected error for module name without alias")
+	}
+}
+
+func TestMetamethods(t *testing.T) {
+	vm, err := GetVMWithSource(`let add(a, b) {
+	let ax = a.x
+	let bx = b.x
+	let ay = a.y
+	let by = b.y
+	return vec(ax + bx, ay + by)
+}
+let eq(a, b) {
+	let ax = a.x
+	let bx = b.x
+	let ay = a.y
+	let by = b.y
+	return (ax == bx) * (ay == by)
+}
+let lt(a, b) {
+	let ax = a.x
+	let bx = b.x
+	return ax < bx
+}
+let show(v) {
+	let x = String.From(v.x)
+	let y = String.From(v.y)
+	return "(" + x + ", " + y + ")"
+}
+let scale(v, n) {
+	let x = v.x
+	let y = v.y
+	return vec(x * n, y * n)
+}
+let defaults = |> z: 0 <|
+let vec(x, y) {
+	let v = |> x: x, y: y, __add: add, __eq: eq, __lt: lt, __str: show, __call: scale, __index: defaults <|
+	return v
+}
+let sum = vec(1, 2) + vec(3, 4)
+let sumX = sum.x
+let same = vec(1, 2) == vec(1, 2)
+let different = vec(1, 2) == vec(1, 3)
+let less = vec(1, 2) < vec(3, 0)
+let greater = vec(1, 2) > vec(3, 0)
+let lessEq = vec(1, 2) <= vec(1, 2)
+let text = "at " + sum
+let shown = String.From(sum)
+let scaled = sum(2)
+let scaledY = scaled.y
+let z = sum.z
+let dynamic = |> __index: fun(obj, key) { return key + "?" } <|
+let missing = dynamic.anything`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.Run(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := map[string]any{
+		"RTsumX": 4, "RTsame": true, "RTdifferent": false, "RTless": true, "RTgreater": false, "RTlessEq": true,
+		"RTtext": "at (4, 6)", "RTshown": "(4, 6)", "RTscaledY": 12, "RTz": 0, "RTmissing": "anything?",
+	}
+
+	for key, value := range expected {
+		if got := vm.Enviroment.Values[key]; got == nil || got.Value != value {
+			t.Errorf("expected %s to be %v got %s", key, value, got.pretify())
+		}
+	}
+
+	if _, err := RunString(`let a = |> x: 1 <| + 1`, "./"); err == nil {
+		t.Error("expected error adding object without __add")
+	}
+
+	if _, err := RunString(`let a = |> __lt: fun(a, b) { return 1 } <| < 1`, "./"); err == nil || !strings.Contains(err.Error(), "expected __lt to return Bool") {
+		t.Errorf("expected __lt result error got %v", err)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema, err := ParseSchema(`let Id = |> type: "String", required: true <|
+let HP = |> type: "Int", min: 1, max: 1000 <|
+let Name = |> type: "String", required: true <|
+let Loot = |> type: "List", items: |> type: "Object", fields: |> Type: |> type: "Int", enum: [1, 2] <|, Count: |> type: "Int", required: true <| <| <| <|`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	source := `let Id = 5
+let HP = 3000
+let Loot = [
+	|> Type: 1, Count: 130 <|,
+	|> Type: 3 <|
+]`
+
+	err = schema.Validate(source, "./")
+
+	var validationErr *ValidationError
+
+	if !errors.As(err, &validationErr) {
+		t.Errorf("expected validation error got %v", err)
+		return
+	}
+
+	expected := []Violation{
+		{Path: "HP", Line: 2, Message: "value 3000 is more than maximum 1000"},
+		{Path: "Id", Line: 1, Message: "expected String got Int"},
+		{Path: "Loot[1].Count", Line: 3, Message: "required value is missing"},
+		{Path: "Loot[1].Type", Line: 3, Message: "expected one of 1, 2 got 3"},
+		{Path: "Name", Line: 0, Message: "required value is missing"},
+	}
+
+	if !reflect.DeepEqual(validationErr.Violations, expected) {
+		t.Errorf("expected %v got %v", expected, validationErr.Violations)
+	}
+
+	if err := schema.Validate(`let Id = "LV0_Dragon"
+let Name = "Smok"
+let Loot = [|> Type: 2, Count: 1 <|]`, "./"); err != nil {
+		t.Errorf("expected valid source got %v", err)
+	}
+
+	if _, err := ParseSchema(`let HP = "Integer"`, "./"); err == nil {
+		t.Error("expected error for unknown type")
+	}
+}
+
+func TestSchemaFor(t *testing.T) {
+	type loot struct {
+		Type  int `parts:"Type,enum=1|2"`
+		Count uint
+	}
+
+	type monster struct {
+		Id    string  `parts:",required"`
+		HP    int     `parts:",min=1,max=1000"`
+		Speed float64 `parts:"SPD"`
+		Boss  *monster
+		Loot  []loot
+	}
+
+	schema, err := SchemaFor(&monster{})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = schema.Validate(`let HP = 0
+let SPD = 2
+let Boss = |> Id: "Smok", SPD: "fast" <|
+let Loot = [|> Type: 1, Count: 0 - 1 <|]`, "./")
+
+	var validationErr *ValidationError
+
+	if !errors.As(err, &validationErr) {
+		t.Errorf("expected validation error got %v", err)
+		return
+	}
+
+	paths := []string{}
+
+	for _, violation := range validationErr.Violations {
+		paths = append(paths, violation.Path)
+	}
+
+	if !reflect.DeepEqual(paths, []string{"Boss.SPD", "HP", "Id", "Loot[0].Count"}) {
+		t.Errorf("unexpected violations %v", validationErr.Violations)
+	}
+
+	if _, err := SchemaFor(struct {
+		HP int `parts:",min=low"`
+	}{}); err == nil {
+		t.Error("expected error for invalid min option")
+	}
+}
+
+func TestGenerateGo(t *testing.T) {
+	var vms []*VM
+
+	for _, source := range []string{
+		`let HP = 300
+let Loot = [|> Type: 1, Count: 130 <|, |> Type: 2 <|]
+let heal(n) { return n }`,
+		`let HP = 10
+let Speed = 2
+let Loot = [|> Type: 3, Count: nil <|]`,
+	} {
+		vm, err := GetVMWithSource(source, "./")
+
+		if err == nil {
+			err = vm.Run()
+		}
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		vms = append(vms, vm)
+	}
+
+	schema, err := InferSchema(vms...)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	code, err := GenerateGo(schema, GenerateOptions{Package: "data", Name: "Monster"})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, expected := range []string{
+		"package data",
+		"type Monster struct {\n\tHP    int           `parts:\"HP,required\"`\n\tLoot  []MonsterLoot `parts:\"Loot,required\"`\n\tSpeed int           `parts:\"Speed\"`\n}",
+		"type MonsterLoot struct {\n\tCount *int `parts:\"Count\"`\n\tType  int  `parts:\"Type,required\"`\n}",
+		"func LoadMonster(source string) (*Monster, error)",
+		"func LoadMonsterFile(path string) (*Monster, error)",
+	} {
+		if !strings.Contains(string(code), expected) {
+			t.Errorf("expected generated code to contain %q got:\n%s", expected, code)
+		}
+	}
+
+	if _, err := GenerateGo(schema, GenerateOptions{Name: "bad name"}); err == nil {
+		t.Error("expected error for invalid type name")
+	}
+}
+
+type testContextKey string
+
+func TestFFIVariadicAndContext(t *testing.T) {
+	vm, err := GetVMWithSource(`let player = "tfo"
+let total = sum(1, 2, 3)
+let empty = sum()
+let found = defined("player")
+let owner = fromContext()
+let kinds = kind(1, "a", [])
+let shown = String.From(damage)
+let shownSum = String.From(sum)`, "./")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	vm.Enviroment.DefineFunction("sum", func(numbers ...int) int {
+		total := 0
+
+		for _, n := range numbers {
+			total += n
+		}
+
+		return total
+	}, "numbers")
+
+	vm.Enviroment.DefineFunction("defined", func(vm *VM, name string) bool { return vm.Enviroment.Has("RT" + name) })
+	vm.Enviroment.DefineFunction("fromContext", func(ctx context.Context) string { return ctx.Value(testContextKey("owner")).(string) })
+
+	vm.Enviroment.DefineFunction("kind", func(first *Literal, rest ...any) string {
+		kinds := []string{TypeHintOf(first).String()}
+
+		for _, value := range rest {
+			kinds = append(kinds, TypeHintOf(value.(*Literal)).String())
+		}
+
+		return strings.Join(kinds, " ")
+	})
+
+	if err := vm.Enviroment.DefineFunction("damage", func(target string, amount int) string { return target }, "target", "amount"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = vm.RunContext(context.WithValue(context.Background(), testContextKey("owner"), "host")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := map[string]any{
+		"RTtotal": 6, "RTempty": 0, "RTfound": true, "RTowner": "host", "RTkinds": "Int String List",
+		"RTshown": "func(target,amount)", "RTshownSum": "func(...numbers)",
+	}
+
+	for key, value := range expected {
+		if got := vm.Enviroment.Values[key]; got == nil || got.Value != value {
+			t.Errorf("expected %s to be %v got %s", key, value, got.pretify())
+		}
+	}
+
+	vm, _ = GetVMWithSource(`damage("orc", "a lot")`, "./")
+	vm.Enviroment.DefineFunction("damage", func(target string, amount int) string { return target }, "target", "amount")
+
+	if err = vm.Run(); err == nil || !strings.Contains(err.Error(), "invalid argument 'amount', expected Int (int) got String") {
+		t.Errorf("expected error with argument name got %v", err)
+	}
+
+	if _, err := NewFFIFunction(func(ctx context.Context, a, b int) {}, "a"); err == nil {
+		t.Error("expected error for missing argument name")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	vm, _ = GetVMWithSource(`let a = 1`, "./")
+
+	if err = vm.RunContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled error got %v", err)
+	}
+}
+
+func TestRunContextStopsLoopsAndCalls(t *testing.T) {
+	sources := []string{
+		`let spin() {
+			for true { tick() }
+		}
+
+		spin()`,
+		`let deep(n) {
+			tick()
+			deep(n + 1)
+		}
+
+		deep(0)`,
+	}
+
+	for _, source := range sources {
+		vm, err := GetVMWithSource(source, "./")
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ticks := 0
+
+		vm.Enviroment.DefineFunction("tick", func() {
+			if ticks++; ticks == 3 {
+				cancel()
+			}
+		})
+
+		if err = vm.RunContext(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected canceled error got %v", err)
+		}
+
+		if ticks != 3 {
+			t.Errorf("expected code to stop right after cancel got (%d) ticks", ticks)
+		}
+	}
+}